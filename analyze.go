@@ -0,0 +1,432 @@
+package spiker
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AnalyzeOptions options of the static analysis
+type AnalyzeOptions struct {
+	Variables []string // variables provided by the host scope
+	Functions []string // functions provided by the host, besides the builtin functions of engine
+}
+
+// DiagnosticKind kind of the problem reported by the static analysis
+type DiagnosticKind string
+
+// Supported diagnostic kind
+const (
+	DiagnosticUndefinedVariable DiagnosticKind = "undefined-variable"
+	DiagnosticUndefinedFunction DiagnosticKind = "undefined-function"
+	DiagnosticArgumentCount     DiagnosticKind = "argument-count"
+	DiagnosticUnreachable       DiagnosticKind = "unreachable"
+	DiagnosticUnusedAssignment  DiagnosticKind = "unused-assignment"
+	DiagnosticTypeMismatch      DiagnosticKind = "type-mismatch" // reported by TypeCheck
+)
+
+// Diagnostic problem reported by the static analysis
+type Diagnostic struct {
+	Kind    DiagnosticKind
+	Line    int
+	Column  int
+	Offset  int
+	Message string
+	Node    AstNode
+}
+
+// String .
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Kind)
+}
+
+// the builtin functions which read their parameters only
+var pureBuiltins = map[string]bool{"export": true, "len": true, "exist": true, "del": true, "print": true}
+
+// the builtin functions whose parameter is a variable reference, not a value
+var refBuiltins = map[string]bool{"exist": true, "del": true}
+
+// Analyze report the problems of the ast nodes with the builtin functions of default engine,
+// see Engine.Analyze
+func Analyze(nodeList []AstNode, opts AnalyzeOptions) []Diagnostic {
+	return defaultEngine.Analyze(nodeList, opts)
+}
+
+// Analyze report the problems of the ast nodes without running them, sorted by position:
+//
+// - read of variable which is never assigned, and not provided by the host
+// - call to function which is neither defined by the script nor the builtin functions
+// - call to script function with wrong argument count
+// - statement after return, break or continue
+// - assignment which is never read: overwritten before read,
+// or a variable of function that is never read
+//
+// The variables of global scope are not reported as unused, they may be read by the host.
+func (e *Engine) Analyze(nodeList []AstNode, opts AnalyzeOptions) []Diagnostic {
+	a := &analyzer{functions: make(map[string]bool)}
+	e.mu.RLock()
+	for name := range e.builtins {
+		a.functions[name] = true
+	}
+	e.mu.RUnlock()
+	for _, name := range opts.Functions {
+		a.functions[name] = true
+	}
+
+	a.global = newAnalyzeScope(nil, nodeList)
+	for _, name := range opts.Variables {
+		a.global.vars[name] = true
+	}
+	a.analyzeScope(a.global, nodeList)
+
+	sort.SliceStable(a.diags, func(i, j int) bool {
+		return a.diags[i].Offset < a.diags[j].Offset
+	})
+	return a.diags
+}
+
+type analyzer struct {
+	functions map[string]bool // builtin and host functions
+	global    *analyzeScope
+	diags     []Diagnostic
+}
+
+// variables and functions of the global scope or a function body
+type analyzeScope struct {
+	fnd     *NodeFuncDef              // nil for global scope
+	vars    map[string]bool           // assigned variables and parameters
+	funcs   map[string][]*NodeFuncDef // defined functions
+	reads   map[string]bool           // read variables
+	assigns []*NodeAssignOp           // assignments
+	tails   map[AstNode]bool          // the statements whose value is the function result
+}
+
+func newAnalyzeScope(fnd *NodeFuncDef, body []AstNode) *analyzeScope {
+	s := &analyzeScope{
+		fnd:   fnd,
+		vars:  make(map[string]bool),
+		funcs: make(map[string][]*NodeFuncDef),
+		reads: make(map[string]bool),
+		tails: make(map[AstNode]bool),
+	}
+	if fnd != nil {
+		for _, p := range fnd.Params {
+			s.vars[p.Name.Value] = true
+		}
+		s.markTails(body)
+	}
+	for _, node := range body {
+		s.declare(node)
+	}
+	return s
+}
+
+// declare the variables and functions of scope, the nested function bodies are skipped
+func (s *analyzeScope) declare(node AstNode) {
+	walkScope(node, func(node AstNode) {
+		switch node := node.(type) {
+		case *NodeAssignOp:
+			// the compound assignment reads the variable first
+			if node.Op == SymbolAssign {
+				s.vars[node.Var.Value] = true
+			}
+		case *NodeFuncDef:
+			s.funcs[node.Name.Value] = append(s.funcs[node.Name.Value], node)
+		}
+	})
+}
+
+// mark the last statements of body, their value is the function result
+func (s *analyzeScope) markTails(body []AstNode) {
+	if len(body) == 0 {
+		return
+	}
+	last := body[len(body)-1]
+	s.tails[last] = true
+	switch last := last.(type) {
+	case *NodeIf:
+		for n := last; n != nil; n = n.ElseIf {
+			s.markTails(n.Body)
+		}
+		s.markTails(last.Else)
+	case *NodeWhile:
+		s.markTails(last.Body)
+	}
+}
+
+// return the script functions of name visible in scope,
+// the function body could call the functions of itself and the global scope
+func (a *analyzer) lookupFunc(s *analyzeScope, name string) []*NodeFuncDef {
+	if defs := s.funcs[name]; len(defs) > 0 {
+		return defs
+	}
+	return a.global.funcs[name]
+}
+
+func (a *analyzer) report(kind DiagnosticKind, node AstNode, format string, args ...interface{}) {
+	d := Diagnostic{Kind: kind, Message: fmt.Sprintf(format, args...), Node: node}
+	d.Line, d.Column, d.Offset = nodePosition(node)
+	a.diags = append(a.diags, d)
+}
+
+// analyze the statements of the global scope or a function body
+func (a *analyzer) analyzeScope(s *analyzeScope, body []AstNode) {
+	a.analyzeList(s, body, s.fnd == nil)
+
+	if s.fnd == nil {
+		return
+	}
+	for _, as := range s.assigns {
+		if !s.reads[as.Var.Value] && !s.tails[as] {
+			a.report(DiagnosticUnusedAssignment, as, "%s is assigned but never used", as.Var.Value)
+		}
+	}
+}
+
+// analyze the statement list, `top` means the top level statements of program,
+// where the return, break and continue do nothing
+func (a *analyzer) analyzeList(s *analyzeScope, nodes []AstNode, top bool) {
+	terminated := false
+	for idx, node := range nodes {
+		if terminated {
+			a.report(DiagnosticUnreachable, node, "unreachable code")
+			terminated = false
+		}
+		a.analyze(s, node)
+
+		if as, ok := node.(*NodeAssignOp); ok && as.Op == SymbolAssign {
+			a.checkOverwritten(as, nodes[idx+1:])
+		}
+		if !top && terminates(node) {
+			terminated = true
+		}
+	}
+}
+
+// report the assignment overwritten by the following statements before read
+func (a *analyzer) checkOverwritten(as *NodeAssignOp, next []AstNode) {
+	name := as.Var.Value
+	for _, node := range next {
+		if next, ok := node.(*NodeAssignOp); ok && next.Var.Value == name && next.Op == SymbolAssign {
+			if !mayRead(next.Expr, name) {
+				a.report(DiagnosticUnusedAssignment, as, "%s is overwritten before used", name)
+			}
+			return
+		}
+		if mayRead(node, name) || mayLeave(node) {
+			return
+		}
+	}
+}
+
+func (a *analyzer) analyze(s *analyzeScope, node AstNode) {
+	switch node := node.(type) {
+	case *NodeVariable:
+		s.reads[node.Value] = true
+		if !s.vars[node.Value] {
+			a.report(DiagnosticUndefinedVariable, node, "undefined variable %s", node.Value)
+		}
+
+	case *NodeAssignOp:
+		a.analyze(s, node.Expr)
+		if node.Op != SymbolAssign && !s.vars[node.Var.Value] {
+			a.report(DiagnosticUndefinedVariable, node, "undefined variable %s", node.Var.Value)
+		}
+		s.assigns = append(s.assigns, node)
+
+	case *NodeUnaryOp:
+		a.analyze(s, node.Right)
+
+	case *NodeBinaryOp:
+		a.analyze(s, node.Left)
+		a.analyze(s, node.Right)
+
+	case *NodeList:
+		for _, v := range node.List {
+			a.analyze(s, v)
+		}
+
+	case *NodeMap:
+		for k, v := range node.Map {
+			a.analyze(s, k)
+			a.analyze(s, v)
+		}
+
+	case *NodeVarIndex:
+		a.analyze(s, node.Var)
+		a.analyze(s, node.Index)
+
+	case *NodeFuncCallOp:
+		a.analyzeCall(s, node)
+
+	case *NodeFuncDef:
+		fs := newAnalyzeScope(node, node.Body)
+		a.analyzeScope(fs, node.Body)
+
+	case *NodeIf:
+		for n := node; n != nil; n = n.ElseIf {
+			a.analyze(s, n.Expr)
+			a.analyzeList(s, n.Body, false)
+		}
+		a.analyzeList(s, node.Else, false)
+
+	case *NodeWhile:
+		a.analyze(s, node.Expr)
+		a.analyzeList(s, node.Body, false)
+
+	case *NodeReturn:
+		for _, v := range node.Tuples {
+			a.analyze(s, v)
+		}
+	}
+}
+
+func (a *analyzer) analyzeCall(s *analyzeScope, fnc *NodeFuncCallOp) {
+	name := fnc.Name.Value
+	defs := a.lookupFunc(s, name)
+	switch {
+	case len(defs) > 0:
+		// the redefined function may have different parameters
+		if n := len(defs[0].Params); n != len(fnc.Params) && sameParamCount(defs) {
+			a.report(DiagnosticArgumentCount, &fnc.Name,
+				"%s() expects %d parameters, %d given", name, n, len(fnc.Params))
+		}
+	case !a.functions[name]:
+		a.report(DiagnosticUndefinedFunction, &fnc.Name, "undefined function %s()", name)
+	}
+
+	for _, p := range fnc.Params {
+		// variable reference, such as exist(a) and del(a["b"])
+		if len(defs) == 0 && refBuiltins[name] {
+			if root := rootVariable(p); root != nil {
+				s.reads[root.Value] = true
+				if vi, ok := p.(*NodeVarIndex); ok {
+					a.analyze(s, vi.Index)
+				}
+				continue
+			}
+		}
+		a.analyze(s, p)
+	}
+}
+
+// report whether all the functions have the same parameter count
+func sameParamCount(defs []*NodeFuncDef) bool {
+	for _, def := range defs[1:] {
+		if len(def.Params) != len(defs[0].Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// return the variable of variable reference, nil if it isn't
+func rootVariable(node AstNode) *NodeVariable {
+	switch node := node.(type) {
+	case *NodeVariable:
+		return node
+	case *NodeVarIndex:
+		return rootVariable(node.Var)
+	}
+	return nil
+}
+
+// report whether the statement always ends the statement list
+func terminates(node AstNode) bool {
+	switch node := node.(type) {
+	case *NodeReturn, *NodeBreak, *NodeContinue:
+		return true
+	case *NodeIf:
+		// all branches end
+		for n := node; n != nil; n = n.ElseIf {
+			if !terminatesList(n.Body) {
+				return false
+			}
+		}
+		return len(node.Else) > 0 && terminatesList(node.Else)
+	}
+	return false
+}
+
+func terminatesList(nodes []AstNode) bool {
+	for _, node := range nodes {
+		if terminates(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// report whether the node may read the variable,
+// the unknown functions may read any variable of the scope
+func mayRead(node AstNode, name string) (read bool) {
+	walkScope(node, func(node AstNode) {
+		switch node := node.(type) {
+		case *NodeVariable:
+			read = read || node.Value == name
+		case *NodeAssignOp:
+			read = read || (node.Op != SymbolAssign && node.Var.Value == name)
+		case *NodeFuncCallOp:
+			read = read || !pureBuiltins[node.Name.Value]
+		}
+	})
+	return
+}
+
+// report whether the node may leave the statement list
+func mayLeave(node AstNode) (leave bool) {
+	walkScope(node, func(node AstNode) {
+		switch node.(type) {
+		case *NodeReturn, *NodeBreak, *NodeContinue:
+			leave = true
+		}
+	})
+	return
+}
+
+// walk the node and its children in the same scope, the function body is skipped
+func walkScope(node AstNode, fn func(AstNode)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+
+	walkList := func(nodes []AstNode) {
+		for _, v := range nodes {
+			walkScope(v, fn)
+		}
+	}
+
+	switch node := node.(type) {
+	case *NodeAssignOp:
+		walkScope(node.Expr, fn)
+	case *NodeUnaryOp:
+		walkScope(node.Right, fn)
+	case *NodeBinaryOp:
+		walkScope(node.Left, fn)
+		walkScope(node.Right, fn)
+	case *NodeList:
+		walkList(node.List)
+	case *NodeMap:
+		for k, v := range node.Map {
+			walkScope(k, fn)
+			walkScope(v, fn)
+		}
+	case *NodeVarIndex:
+		walkScope(node.Var, fn)
+		walkScope(node.Index, fn)
+	case *NodeFuncCallOp:
+		walkList(node.Params)
+	case *NodeIf:
+		walkScope(node.Expr, fn)
+		walkList(node.Body)
+		if node.ElseIf != nil {
+			walkScope(node.ElseIf, fn)
+		}
+		walkList(node.Else)
+	case *NodeWhile:
+		walkScope(node.Expr, fn)
+		walkList(node.Body)
+	case *NodeReturn:
+		walkList(node.Tuples)
+	}
+}
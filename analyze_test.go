@@ -0,0 +1,193 @@
+package spiker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"valid", `
+price = 10;
+total = price * count;
+add = (a, b) -> a + b;
+export(add(total, 1));
+`, nil},
+		{"undefined-variable", `
+a = 1;
+if (a > 1) {
+    b = a + rate;
+}
+c += 1;
+`, []string{
+			"4:13: undefined variable rate (undefined-variable)",
+			"6:1: undefined variable c (undefined-variable)",
+		}},
+		{"function-scope", `
+rate = 2;
+f = x -> x * rate;
+f(1);
+`, []string{
+			"3:14: undefined variable rate (undefined-variable)",
+		}},
+		{"variable-reference", `
+if (exist(rate) && exist(dict["key"])) {
+    del(tmp);
+}
+`, nil},
+		{"undefined-function", `
+a = max(1, 2);
+f = () -> g();
+g = () -> 1;
+f();
+`, []string{
+			"2:5: undefined function max() (undefined-function)",
+		}},
+		{"nested-function", `
+f = () -> {
+    k = () -> 1;
+    g = () -> k();
+    g();
+};
+f();
+`, []string{
+			"4:15: undefined function k() (undefined-function)",
+		}},
+		{"argument-count", `
+add = (a, b) -> a + b;
+add(1);
+add(1, 2, 3);
+len(1, 2);
+`, []string{
+			"3:1: add() expects 2 parameters, 1 given (argument-count)",
+			"4:1: add() expects 2 parameters, 3 given (argument-count)",
+		}},
+		{"redefined-function", `
+f = a -> a;
+f = (a, b) -> a + b;
+f(1);
+`, nil},
+		{"unreachable", `
+f = x -> {
+    while (x > 0) {
+        x -= 1;
+        if (x == 5) {
+            break;
+            x = 0;
+        }
+        continue;
+        x = 1;
+    }
+    if (x) {
+        return 1;
+    } else {
+        return 2;
+    }
+    x;
+};
+f(10);
+`, []string{
+			"7:13: unreachable code (unreachable)",
+			"10:9: unreachable code (unreachable)",
+			"17:5: unreachable code (unreachable)",
+		}},
+		{"top-level-return", `
+a = 1;
+return;
+a = 2;
+`, nil},
+		{"overwritten", `
+a = 1;
+a = 2;
+b = 1;
+b = b + 1;
+c = 1;
+if (b) {
+    c = 2;
+}
+c = 3;
+d = 1;
+print();
+d = 2;
+e = 1;
+check();
+e = 2;
+`, []string{
+			"2:1: a is overwritten before used (unused-assignment)",
+			"6:1: c is overwritten before used (unused-assignment)",
+			"11:1: d is overwritten before used (unused-assignment)",
+		}},
+		{"unused", `
+f = x -> {
+    tmp = x * 2;
+    n = 0;
+    n += 1;
+    i = 0;
+    while (i < x) {
+        i += 1;
+    }
+    y = x;
+};
+f(1);
+`, []string{
+			"3:5: tmp is assigned but never used (unused-assignment)",
+			"4:5: n is assigned but never used (unused-assignment)",
+			"5:5: n is assigned but never used (unused-assignment)",
+		}},
+		{"unused-tail", `
+f = x -> {
+    if (x) {
+        y = 1;
+    } else {
+        y = 2;
+    }
+};
+f(1);
+`, nil},
+	}
+
+	opts := spiker.AnalyzeOptions{Variables: []string{"count"}, Functions: []string{"check"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, err := spiker.ParseAst(tt.code)
+			if err != nil {
+				t.Fatalf("ParseAst() error = %v", err)
+			}
+
+			var got []string
+			for _, d := range spiker.Analyze(ast, opts) {
+				got = append(got, d.String())
+				if d.Node == nil {
+					t.Errorf("Diagnostic %s has no node", d)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_Analyze(t *testing.T) {
+	ast, err := spiker.ParseAst(`a = double(2);`)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	if got := spiker.Analyze(ast, spiker.AnalyzeOptions{}); len(got) != 1 || got[0].Kind != spiker.DiagnosticUndefinedFunction {
+		t.Errorf("Analyze() = %v", got)
+	}
+
+	e := spiker.New(spiker.WithFunc("double", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		return spiker.EvalExpr(fnc.Params[0], scope).(float64) * 2
+	}))
+	if got := e.Analyze(ast, spiker.AnalyzeOptions{}); len(got) != 0 {
+		t.Errorf("Engine.Analyze() = %v", got)
+	}
+}
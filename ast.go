@@ -1,17 +1,124 @@
 package spiker
 
+import "fmt"
+
 // AstNode AST node interface
 type AstNode interface {
 	Format() string
 	Raw() *Token
+	Pos() Position // the position of the first character of node
+	End() Position // the position immediately after the node
+}
+
+// Position the position in source, the line and column start at 1,
+// the column counts characters and the offset counts bytes
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// IsValid whether the position is known
+func (pos Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+// String .
+func (pos Position) String() string {
+	if !pos.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
 }
 
 // Ast syntax parsing infrastructure
 type Ast struct {
 	raw *Token
+	end *Token // the last token of node, such as the closing "]", the raw token if nil
+
+	comments *Comments // the comments of statement
 }
 
 // Raw return the token
 func (ast Ast) Raw() *Token {
 	return ast.raw
 }
+
+// Pos return the position of the raw token
+func (ast Ast) Pos() Position {
+	return tokenPos(ast.raw)
+}
+
+// End return the position after the last token
+func (ast Ast) End() Position {
+	if ast.end != nil {
+		return tokenEnd(ast.end)
+	}
+	return tokenEnd(ast.raw)
+}
+
+// return the start position of token
+func tokenPos(tok *Token) Position {
+	if tok == nil {
+		return Position{}
+	}
+	return Position{Line: tok.line, Column: tok.col, Offset: tok.offset}
+}
+
+// return the position after token
+func tokenEnd(tok *Token) Position {
+	if tok == nil {
+		return Position{}
+	}
+	return Position{Line: tok.endLine, Column: tok.endCol, Offset: tok.endOffset}
+}
+
+// return a token covers the position range, for the synthetic nodes
+func spanToken(pos, end Position) *Token {
+	return &Token{
+		line: pos.Line, col: pos.Column, offset: pos.Offset,
+		endLine: end.Line, endCol: end.Column, endOffset: end.Offset,
+	}
+}
+
+// return the enclosing parentheses of node, the parser drops them
+func parenOf(node AstNode) *Token {
+	if raw := node.Raw(); raw != nil && raw.paren != nil {
+		return raw.paren
+	}
+	return nil
+}
+
+// return the start position of node including the parentheses, or the default if unknown
+func startOf(node AstNode, def Position) Position {
+	if node != nil {
+		if paren := parenOf(node); paren != nil {
+			return tokenPos(paren)
+		}
+		if pos := node.Pos(); pos.IsValid() {
+			return pos
+		}
+	}
+	return def
+}
+
+// return the end position of node including the parentheses, or the default if unknown
+func endOf(node AstNode, def Position) Position {
+	if node != nil {
+		if paren := parenOf(node); paren != nil && paren.end != nil {
+			return tokenEnd(paren.end)
+		}
+		if end := node.End(); end.IsValid() {
+			return end
+		}
+	}
+	return def
+}
+
+// return the end position of the last node, or the default if unknown
+func endOfList(nodes []AstNode, def Position) Position {
+	if len(nodes) == 0 {
+		return def
+	}
+	return endOf(nodes[len(nodes)-1], def)
+}
@@ -1,10 +1,5 @@
 package spiker
 
-import (
-	"fmt"
-	"strings"
-)
-
 // NodeFuncDef function define
 type NodeFuncDef struct {
 	Ast
@@ -16,27 +11,20 @@ type NodeFuncDef struct {
 
 // Format .
 func (fn NodeFuncDef) Format() string {
-	var ps []string
-	for _, v := range fn.Params {
-		ps = append(ps, v.Format())
-	}
-	var p = strings.Join(ps, ", ")
-	if len(ps) > 1 {
-		p = "(" + p + ")"
-	}
+	return defaultPrinter.expr(&fn, -1, 0)
+}
 
-	var b string
-	var l = len(fn.Body)
-	if l == 0 {
-		b = "{}"
-	} else if l == 1 && fn.SingleStmt {
-		b = fn.Body[0].Format()
-	} else {
-		var str = formatBody(fn.Body)
-		b = "{\n" + str + "}"
-	}
+// Pos .
+func (fn NodeFuncDef) Pos() Position {
+	return startOf(fn.Name, fn.Ast.Pos())
+}
 
-	return fmt.Sprintf("%s = %s -> %s;", fn.Name.Format(), p, b)
+// End .
+func (fn NodeFuncDef) End() Position {
+	if fn.Ast.end != nil {
+		return fn.Ast.End()
+	}
+	return endOfList(fn.Body, fn.Ast.End())
 }
 
 // NodeParam function param
@@ -0,0 +1,495 @@
+package spiker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// AstVersion the version of JSON schema of MarshalAst
+const AstVersion = 1
+
+// the JSON document of ast nodes
+type jsonProgram struct {
+	Version int         `json:"version"`
+	Nodes   []*jsonNode `json:"nodes"`
+}
+
+// the JSON object of ast node, the fields are used by the node types:
+//
+// - Variable, String, Number, Bool: value
+// - List: list
+// - Map: entries, in the order of source
+// - BinaryOp: left, op, right
+// - UnaryOp: op, right
+// - AssignOp: var, op, expr
+// - FuncCallOp: name, params
+// - VarIndex: var, index, member
+// - FuncDef: name, params, body, single
+// - Param: name, default
+// - If: expr, body, elseIf, else
+// - While: expr, body
+// - Return: tuples
+// - Continue, Break: no field
+//
+// the absent list field is nil, and the present one is never nil
+type jsonNode struct {
+	Type    string        `json:"type"`
+	Pos     *jsonPos      `json:"pos,omitempty"`
+	End     *jsonPos      `json:"end,omitempty"`
+	Paren   *jsonSpan     `json:"paren,omitempty"`
+	Comment *jsonComments `json:"comments,omitempty"`
+	Value   interface{}   `json:"value,omitempty"`
+	Default interface{}   `json:"default,omitempty"`
+	Op      Symbol        `json:"op,omitempty"`
+	Name    *jsonNode     `json:"name,omitempty"`
+	Var     *jsonNode     `json:"var,omitempty"`
+	Left    *jsonNode     `json:"left,omitempty"`
+	Right   *jsonNode     `json:"right,omitempty"`
+	Expr    *jsonNode     `json:"expr,omitempty"`
+	Index   *jsonNode     `json:"index,omitempty"`
+	Member  bool          `json:"member,omitempty"`
+	Single  bool          `json:"single,omitempty"`
+	List    *[]*jsonNode  `json:"list,omitempty"`
+	Entries *[]*jsonEntry `json:"entries,omitempty"`
+	Params  *[]*jsonNode  `json:"params,omitempty"`
+	Body    *[]*jsonNode  `json:"body,omitempty"`
+	ElseIf  *jsonNode     `json:"elseIf,omitempty"`
+	Else    *[]*jsonNode  `json:"else,omitempty"`
+	Tuples  *[]*jsonNode  `json:"tuples,omitempty"`
+}
+
+// the position in source, the pos is the raw token of node, used by the errors,
+// and the end is the position after node
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// the enclosing parentheses of grouped expression
+type jsonSpan struct {
+	Pos jsonPos `json:"pos"`
+	End jsonPos `json:"end"`
+}
+
+// the comments of statement
+type jsonComments struct {
+	Leading    []*jsonComment `json:"leading,omitempty"`
+	Trailing   *jsonComment   `json:"trailing,omitempty"`
+	Footer     []*jsonComment `json:"footer,omitempty"`
+	Body       []*jsonComment `json:"body,omitempty"`
+	Else       []*jsonComment `json:"else,omitempty"`
+	BeforeElse []*jsonComment `json:"beforeElse,omitempty"`
+}
+
+type jsonComment struct {
+	Text string  `json:"text"`
+	Pos  jsonPos `json:"pos"`
+	End  jsonPos `json:"end"`
+}
+
+// the key and value of NodeMap
+type jsonEntry struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// MarshalAst encode the ast nodes to JSON, with the positions of nodes
+func MarshalAst(nodes []AstNode) (data []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("marshal ast: %v", e)
+		}
+	}()
+
+	doc := jsonProgram{Version: AstVersion, Nodes: make([]*jsonNode, 0, len(nodes))}
+	for _, node := range nodes {
+		doc.Nodes = append(doc.Nodes, encodeNode(node))
+	}
+
+	// keep the operators readable, such as `<` and `&&`
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("marshal ast: %v", err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// UnmarshalAst decode the ast nodes from the JSON encoded by MarshalAst
+func UnmarshalAst(data []byte) (nodes []AstNode, err error) {
+	var doc jsonProgram
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal ast: %v", err)
+	}
+	if doc.Version != AstVersion {
+		return nil, fmt.Errorf("unmarshal ast: unsupported version %d", doc.Version)
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			nodes, err = nil, fmt.Errorf("unmarshal ast: %v", e)
+		}
+	}()
+
+	nodes = make([]AstNode, 0, len(doc.Nodes))
+	for _, jn := range doc.Nodes {
+		nodes = append(nodes, decodeNode(jn))
+	}
+
+	return
+}
+
+// encode the position of token
+func encodePos(tok *Token) *jsonPos {
+	if tok == nil {
+		return nil
+	}
+	return &jsonPos{Line: tok.line, Column: tok.col, Offset: tok.offset}
+}
+
+// encode the end position of node
+func encodeEnd(node AstNode) *jsonPos {
+	end := node.End()
+	if !end.IsValid() {
+		return nil
+	}
+	return &jsonPos{Line: end.Line, Column: end.Column, Offset: end.Offset}
+}
+
+// encode the node list, keep nil as absent
+func encodeNodes(nodes []AstNode) *[]*jsonNode {
+	if nodes == nil {
+		return nil
+	}
+	list := make([]*jsonNode, 0, len(nodes))
+	for _, node := range nodes {
+		list = append(list, encodeNode(node))
+	}
+	return &list
+}
+
+func encodeVariable(nv NodeVariable) *jsonNode {
+	return &jsonNode{Type: "Variable", Pos: encodePos(nv.raw), End: encodeEnd(nv), Value: nv.Value}
+}
+
+func encodeNode(node AstNode) *jsonNode {
+	if node == nil {
+		return nil
+	}
+
+	jn := encodeFields(node)
+	jn.End = encodeEnd(node)
+	if paren := parenOf(node); paren != nil && paren.end != nil {
+		end := tokenEnd(paren.end)
+		jn.Paren = &jsonSpan{
+			Pos: *encodePos(paren),
+			End: jsonPos{Line: end.Line, Column: end.Column, Offset: end.Offset},
+		}
+	}
+	if cs := commentsOf(node); cs != nil {
+		jn.Comment = &jsonComments{
+			Leading:    encodeComments(cs.Leading),
+			Trailing:   encodeComment(cs.Trailing),
+			Footer:     encodeComments(cs.Footer),
+			Body:       encodeComments(cs.Body),
+			Else:       encodeComments(cs.Else),
+			BeforeElse: encodeComments(cs.BeforeElse),
+		}
+	}
+	return jn
+}
+
+func encodeComment(c *Comment) *jsonComment {
+	if c == nil {
+		return nil
+	}
+	return &jsonComment{
+		Text: c.Text,
+		Pos:  jsonPos{Line: c.Pos.Line, Column: c.Pos.Column, Offset: c.Pos.Offset},
+		End:  jsonPos{Line: c.End.Line, Column: c.End.Column, Offset: c.End.Offset},
+	}
+}
+
+func encodeComments(cs []*Comment) []*jsonComment {
+	var list []*jsonComment
+	for _, c := range cs {
+		list = append(list, encodeComment(c))
+	}
+	return list
+}
+
+// encode the type and fields of node
+func encodeFields(node AstNode) *jsonNode {
+	switch n := node.(type) {
+	case *NodeVariable:
+		return encodeVariable(*n)
+
+	case *NodeString:
+		return &jsonNode{Type: "String", Pos: encodePos(n.raw), Value: n.Value}
+
+	case *NodeNumber:
+		return &jsonNode{Type: "Number", Pos: encodePos(n.raw), Value: n.Value}
+
+	case *NodeBool:
+		return &jsonNode{Type: "Bool", Pos: encodePos(n.raw), Value: n.Value}
+
+	case *NodeList:
+		return &jsonNode{Type: "List", Pos: encodePos(n.raw), List: encodeNodes(n.List)}
+
+	case *NodeMap:
+		return &jsonNode{Type: "Map", Pos: encodePos(n.raw), Entries: encodeEntries(n.Map)}
+
+	case *NodeBinaryOp:
+		return &jsonNode{Type: "BinaryOp", Pos: encodePos(n.raw), Left: encodeNode(n.Left), Op: n.Op, Right: encodeNode(n.Right)}
+
+	case *NodeUnaryOp:
+		return &jsonNode{Type: "UnaryOp", Pos: encodePos(n.raw), Op: n.Op, Right: encodeNode(n.Right)}
+
+	case *NodeAssignOp:
+		return &jsonNode{Type: "AssignOp", Pos: encodePos(n.raw), Var: encodeVariable(n.Var), Op: n.Op, Expr: encodeNode(n.Expr)}
+
+	case *NodeFuncCallOp:
+		return &jsonNode{Type: "FuncCallOp", Pos: encodePos(n.raw), Name: encodeVariable(n.Name), Params: encodeNodes(n.Params)}
+
+	case *NodeVarIndex:
+		return &jsonNode{Type: "VarIndex", Pos: encodePos(n.raw), Var: encodeNode(n.Var), Index: encodeNode(n.Index), Member: n.Member}
+
+	case *NodeFuncDef:
+		jn := &jsonNode{Type: "FuncDef", Pos: encodePos(n.raw), Name: encodeVariable(n.Name), Body: encodeNodes(n.Body), Single: n.SingleStmt}
+		if n.Params != nil {
+			params := make([]*jsonNode, 0, len(n.Params))
+			for _, p := range n.Params {
+				params = append(params, &jsonNode{Type: "Param", Pos: encodePos(p.raw), End: encodeEnd(p), Name: encodeVariable(p.Name), Default: p.Default})
+			}
+			jn.Params = &params
+		}
+		return jn
+
+	case *NodeIf:
+		jn := &jsonNode{Type: "If", Pos: encodePos(n.raw), Expr: encodeNode(n.Expr), Body: encodeNodes(n.Body), Else: encodeNodes(n.Else)}
+		if n.ElseIf != nil {
+			jn.ElseIf = encodeNode(n.ElseIf)
+		}
+		return jn
+
+	case *NodeWhile:
+		return &jsonNode{Type: "While", Pos: encodePos(n.raw), Expr: encodeNode(n.Expr), Body: encodeNodes(n.Body)}
+
+	case *NodeReturn:
+		return &jsonNode{Type: "Return", Pos: encodePos(n.raw), Tuples: encodeNodes(n.Tuples)}
+
+	case *NodeContinue:
+		return &jsonNode{Type: "Continue", Pos: encodePos(n.raw)}
+
+	case *NodeBreak:
+		return &jsonNode{Type: "Break", Pos: encodePos(n.raw)}
+	}
+
+	panic(fmt.Sprintf("unsupported node type %T", node))
+}
+
+// encode the entries of map, in the order of source
+func encodeEntries(m map[AstNode]AstNode) *[]*jsonEntry {
+	if m == nil {
+		return nil
+	}
+
+	list := make([]*jsonEntry, 0, len(m))
+	for _, e := range sortedEntries(m) {
+		list = append(list, &jsonEntry{Key: encodeNode(e.key), Value: encodeNode(e.value)})
+	}
+	return &list
+}
+
+// decode the positions of node to tokens
+func decodeAst(jn *jsonNode) (ast Ast) {
+	if pos := jn.Pos; pos != nil {
+		ast.raw = &Token{line: pos.Line, col: pos.Column, offset: pos.Offset}
+	}
+	if end := jn.End; end != nil {
+		ast.end = &Token{endLine: end.Line, endCol: end.Column, endOffset: end.Offset}
+	}
+	if paren := jn.Paren; paren != nil {
+		if ast.raw == nil {
+			ast.raw = &Token{}
+		}
+		ast.raw.paren = spanToken(
+			Position{Line: paren.Pos.Line, Column: paren.Pos.Column, Offset: paren.Pos.Offset},
+			Position{Line: paren.End.Line, Column: paren.End.Column, Offset: paren.End.Offset},
+		)
+		ast.raw.paren.end = ast.raw.paren
+	}
+	if cs := jn.Comment; cs != nil {
+		ast.comments = &Comments{
+			Leading:    decodeComments(cs.Leading),
+			Trailing:   decodeComment(cs.Trailing),
+			Footer:     decodeComments(cs.Footer),
+			Body:       decodeComments(cs.Body),
+			Else:       decodeComments(cs.Else),
+			BeforeElse: decodeComments(cs.BeforeElse),
+		}
+	}
+	return
+}
+
+func decodeComment(jc *jsonComment) *Comment {
+	if jc == nil {
+		return nil
+	}
+	return &Comment{
+		Text: jc.Text,
+		Pos:  Position{Line: jc.Pos.Line, Column: jc.Pos.Column, Offset: jc.Pos.Offset},
+		End:  Position{Line: jc.End.Line, Column: jc.End.Column, Offset: jc.End.Offset},
+	}
+}
+
+func decodeComments(list []*jsonComment) []*Comment {
+	var cs []*Comment
+	for _, jc := range list {
+		cs = append(cs, decodeComment(jc))
+	}
+	return cs
+}
+
+func decodeNodes(list *[]*jsonNode) []AstNode {
+	if list == nil {
+		return nil
+	}
+	nodes := make([]AstNode, 0, len(*list))
+	for _, jn := range *list {
+		nodes = append(nodes, decodeNode(jn))
+	}
+	return nodes
+}
+
+// decode the required child node
+func decodeChild(jn *jsonNode, field string, child *jsonNode) AstNode {
+	if child == nil {
+		panic(fmt.Sprintf("missing %s of %s node", field, jn.Type))
+	}
+	return decodeNode(child)
+}
+
+func decodeVariable(jn *jsonNode, field string, child *jsonNode) NodeVariable {
+	if child == nil {
+		panic(fmt.Sprintf("missing %s of %s node", field, jn.Type))
+	}
+	nv, ok := decodeNode(child).(*NodeVariable)
+	if !ok {
+		panic(fmt.Sprintf("%s of %s node must be Variable, but got %s", field, jn.Type, child.Type))
+	}
+	return *nv
+}
+
+func decodeOp(jn *jsonNode) Symbol {
+	if jn.Op == "" {
+		panic(fmt.Sprintf("missing op of %s node", jn.Type))
+	}
+	return jn.Op
+}
+
+func decodeNode(jn *jsonNode) AstNode {
+	if jn == nil {
+		return nil
+	}
+
+	ast := decodeAst(jn)
+	switch jn.Type {
+	case "Variable", "String":
+		s, ok := jn.Value.(string)
+		if !ok {
+			panic(fmt.Sprintf("value of %s node must be string", jn.Type))
+		}
+		if jn.Type == "Variable" {
+			return &NodeVariable{Ast: ast, Value: s}
+		}
+		return &NodeString{Ast: ast, Value: s}
+
+	case "Number":
+		if jn.Value == nil {
+			return &NodeNumber{Ast: ast}
+		}
+		f, ok := jn.Value.(float64)
+		if !ok {
+			panic("value of Number node must be number")
+		}
+		return &NodeNumber{Ast: ast, Value: f}
+
+	case "Bool":
+		b, _ := jn.Value.(bool)
+		return &NodeBool{Ast: ast, Value: b}
+
+	case "List":
+		return &NodeList{Ast: ast, List: decodeNodes(jn.List)}
+
+	case "Map":
+		nm := &NodeMap{Ast: ast}
+		if jn.Entries != nil {
+			nm.Map = make(map[AstNode]AstNode, len(*jn.Entries))
+			for _, e := range *jn.Entries {
+				if e == nil {
+					panic("missing entry of Map node")
+				}
+				nm.Map[decodeChild(jn, "key", e.Key)] = decodeChild(jn, "value", e.Value)
+			}
+		}
+		return nm
+
+	case "BinaryOp":
+		return &NodeBinaryOp{Ast: ast, Left: decodeChild(jn, "left", jn.Left), Op: decodeOp(jn), Right: decodeChild(jn, "right", jn.Right)}
+
+	case "UnaryOp":
+		return &NodeUnaryOp{Ast: ast, Op: decodeOp(jn), Right: decodeChild(jn, "right", jn.Right)}
+
+	case "AssignOp":
+		return &NodeAssignOp{Ast: ast, Var: decodeVariable(jn, "var", jn.Var), Op: decodeOp(jn), Expr: decodeChild(jn, "expr", jn.Expr)}
+
+	case "FuncCallOp":
+		return &NodeFuncCallOp{Ast: ast, Name: decodeVariable(jn, "name", jn.Name), Params: decodeNodes(jn.Params)}
+
+	case "VarIndex":
+		return &NodeVarIndex{Ast: ast, Var: decodeChild(jn, "var", jn.Var), Index: decodeChild(jn, "index", jn.Index), Member: jn.Member}
+
+	case "FuncDef":
+		fnd := &NodeFuncDef{Ast: ast, Name: decodeVariable(jn, "name", jn.Name), Body: decodeNodes(jn.Body), SingleStmt: jn.Single}
+		if jn.Params != nil {
+			fnd.Params = make([]NodeParam, 0, len(*jn.Params))
+			for _, p := range *jn.Params {
+				if p == nil || p.Type != "Param" {
+					panic("params of FuncDef node must be Param")
+				}
+				fnd.Params = append(fnd.Params, NodeParam{Ast: decodeAst(p), Name: decodeVariable(p, "name", p.Name), Default: p.Default})
+			}
+		}
+		return fnd
+
+	case "If":
+		ifs := &NodeIf{Ast: ast, Expr: decodeChild(jn, "expr", jn.Expr), Body: decodeNodes(jn.Body), Else: decodeNodes(jn.Else)}
+		if jn.ElseIf != nil {
+			elseIf, ok := decodeNode(jn.ElseIf).(*NodeIf)
+			if !ok {
+				panic("elseIf of If node must be If, but got " + jn.ElseIf.Type)
+			}
+			ifs.ElseIf = elseIf
+		}
+		return ifs
+
+	case "While":
+		return &NodeWhile{Ast: ast, Expr: decodeChild(jn, "expr", jn.Expr), Body: decodeNodes(jn.Body)}
+
+	case "Return":
+		return &NodeReturn{Ast: ast, Tuples: decodeNodes(jn.Tuples)}
+
+	case "Continue":
+		return &NodeContinue{ast}
+
+	case "Break":
+		return &NodeBreak{ast}
+	}
+
+	panic(fmt.Sprintf("unknown node type %q", jn.Type))
+}
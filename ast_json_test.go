@@ -0,0 +1,152 @@
+package spiker_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestMarshalAst(t *testing.T) {
+	ast, err := spiker.ParseAst(`a = ["k": -1, 2]; if (a.k < 0) { b = 1; } else if (!a) { break; } else {}`)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	got, err := spiker.MarshalAst(ast)
+	if err != nil {
+		t.Fatalf("MarshalAst() error = %v", err)
+	}
+
+	want := `{"version":1,"nodes":[` +
+		`{"type":"AssignOp","pos":{"line":1,"column":3,"offset":2},"end":{"line":1,"column":17,"offset":16},"op":"=",` +
+		`"var":{"type":"Variable","pos":{"line":1,"column":1,"offset":0},"end":{"line":1,"column":2,"offset":1},"value":"a"},` +
+		`"expr":{"type":"Map","pos":{"line":1,"column":5,"offset":4},"end":{"line":1,"column":17,"offset":16},"entries":[` +
+		`{"key":{"type":"String","pos":{"line":1,"column":6,"offset":5},"end":{"line":1,"column":9,"offset":8},"value":"k"},` +
+		`"value":{"type":"UnaryOp","pos":{"line":1,"column":11,"offset":10},"end":{"line":1,"column":13,"offset":12},"op":"-","right":{"type":"Number","pos":{"line":1,"column":12,"offset":11},"end":{"line":1,"column":13,"offset":12},"value":1}}},` +
+		`{"key":{"type":"Number","pos":{"line":1,"column":15,"offset":14},"end":{"line":1,"column":15,"offset":14},"value":0},"value":{"type":"Number","pos":{"line":1,"column":15,"offset":14},"end":{"line":1,"column":16,"offset":15},"value":2}}]}},` +
+		`{"type":"If","pos":{"line":1,"column":19,"offset":18},"end":{"line":1,"column":74,"offset":73},` +
+		`"expr":{"type":"BinaryOp","pos":{"line":1,"column":27,"offset":26},"end":{"line":1,"column":30,"offset":29},"paren":{"pos":{"line":1,"column":22,"offset":21},"end":{"line":1,"column":31,"offset":30}},"op":"<",` +
+		`"left":{"type":"VarIndex","pos":{"line":1,"column":24,"offset":23},"end":{"line":1,"column":26,"offset":25},"var":{"type":"Variable","pos":{"line":1,"column":23,"offset":22},"end":{"line":1,"column":24,"offset":23},"value":"a"},"index":{"type":"String","pos":{"line":1,"column":25,"offset":24},"end":{"line":1,"column":26,"offset":25},"value":"k"},"member":true},` +
+		`"right":{"type":"Number","pos":{"line":1,"column":29,"offset":28},"end":{"line":1,"column":30,"offset":29},"value":0}},` +
+		`"body":[{"type":"AssignOp","pos":{"line":1,"column":36,"offset":35},"end":{"line":1,"column":39,"offset":38},"op":"=","var":{"type":"Variable","pos":{"line":1,"column":34,"offset":33},"end":{"line":1,"column":35,"offset":34},"value":"b"},"expr":{"type":"Number","pos":{"line":1,"column":38,"offset":37},"end":{"line":1,"column":39,"offset":38},"value":1}}],` +
+		`"elseIf":{"type":"If","pos":{"line":1,"column":48,"offset":47},"end":{"line":1,"column":74,"offset":73},` +
+		`"expr":{"type":"UnaryOp","pos":{"line":1,"column":52,"offset":51},"end":{"line":1,"column":54,"offset":53},"paren":{"pos":{"line":1,"column":51,"offset":50},"end":{"line":1,"column":55,"offset":54}},"op":"!","right":{"type":"Variable","pos":{"line":1,"column":53,"offset":52},"end":{"line":1,"column":54,"offset":53},"value":"a"}},` +
+		`"body":[{"type":"Break","pos":{"line":1,"column":58,"offset":57},"end":{"line":1,"column":63,"offset":62}}],"else":[]}}]}`
+	if string(got) != want {
+		t.Errorf("MarshalAst() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMarshalAst_Comments(t *testing.T) {
+	code := "if (a) {\n    # todo\n} # one\nelse {\n    # none\n}"
+	ast, err := spiker.ParseAst(code)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	got, err := spiker.MarshalAst(ast)
+	if err != nil {
+		t.Fatalf("MarshalAst() error = %v", err)
+	}
+	want := `"comments":{` +
+		`"body":[{"text":"# todo","pos":{"line":2,"column":5,"offset":13},"end":{"line":2,"column":11,"offset":19}}],` +
+		`"else":[{"text":"# none","pos":{"line":5,"column":5,"offset":39},"end":{"line":5,"column":11,"offset":45}}],` +
+		`"beforeElse":[{"text":"# one","pos":{"line":3,"column":3,"offset":22},"end":{"line":3,"column":8,"offset":27}}]}`
+	if !strings.Contains(string(got), want) {
+		t.Errorf("MarshalAst() =\n%s\nwant comments\n%s", got, want)
+	}
+
+	decoded, err := spiker.UnmarshalAst(got)
+	if err != nil {
+		t.Fatalf("UnmarshalAst() error = %v", err)
+	}
+	if formatted, _ := spiker.FormatAst(decoded); formatted != code {
+		t.Errorf("FormatAst() = %q, want %q", formatted, code)
+	}
+}
+
+func TestUnmarshalAst(t *testing.T) {
+	for _, file := range srcTests {
+		t.Run(file, func(t *testing.T) {
+			ast, err := spiker.ParseAst(readFile(file))
+			if err != nil {
+				t.Fatalf("ParseAst() error = %v", err)
+			}
+
+			data, err := spiker.MarshalAst(ast)
+			if err != nil {
+				t.Fatalf("MarshalAst() error = %v", err)
+			}
+			decoded, err := spiker.UnmarshalAst(data)
+			if err != nil {
+				t.Fatalf("UnmarshalAst() error = %v", err)
+			}
+
+			// the same JSON
+			again, err := spiker.MarshalAst(decoded)
+			if err != nil || string(again) != string(data) {
+				t.Errorf("MarshalAst(UnmarshalAst()) = %s, %v", again, err)
+			}
+
+			// the same format
+			want, _ := spiker.FormatAst(ast)
+			got, err := spiker.FormatAst(decoded)
+			if err != nil || got != want {
+				t.Errorf("FormatAst() = %q, %v, want %q", got, err, want)
+			}
+
+			// the same result
+			wantVal, wantErr := spiker.Evaluator(ast)
+			gotVal, gotErr := spiker.Evaluator(decoded)
+			if !reflect.DeepEqual(gotVal, wantVal) || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("Evaluator() = %v, %v, want %v, %v", gotVal, gotErr, wantVal, wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalAst_Position(t *testing.T) {
+	ast, err := spiker.ParseAst("a = [1];\nb = a[5];")
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+	data, _ := spiker.MarshalAst(ast)
+	decoded, err := spiker.UnmarshalAst(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAst() error = %v", err)
+	}
+
+	_, err = spiker.Evaluator(decoded)
+	e, ok := err.(*spiker.RuntimeError)
+	if !ok || e.Line != 2 || e.Column != 5 || e.Offset != 13 {
+		t.Errorf("Evaluator() error = %#v", err)
+	}
+}
+
+func TestUnmarshalAst_Error(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{`[]`, "unmarshal ast: json: cannot unmarshal array into Go value of type spiker.jsonProgram"},
+		{`{"version":2,"nodes":[]}`, "unmarshal ast: unsupported version 2"},
+		{`{"version":1,"nodes":[{"type":"Foo"}]}`, `unmarshal ast: unknown node type "Foo"`},
+		{`{"version":1,"nodes":[{"type":"String","value":1}]}`, "unmarshal ast: value of String node must be string"},
+		{`{"version":1,"nodes":[{"type":"BinaryOp","op":"+","left":{"type":"Number","value":1}}]}`, "unmarshal ast: missing right of BinaryOp node"},
+		{`{"version":1,"nodes":[{"type":"UnaryOp","right":{"type":"Number","value":1}}]}`, "unmarshal ast: missing op of UnaryOp node"},
+		{`{"version":1,"nodes":[{"type":"AssignOp","op":"=","var":{"type":"String","value":"a"},"expr":{"type":"Number"}}]}`, "unmarshal ast: var of AssignOp node must be Variable, but got String"},
+		{`{"version":1,"nodes":[{"type":"If","expr":{"type":"Bool"},"elseIf":{"type":"Break"}}]}`, "unmarshal ast: elseIf of If node must be If, but got Break"},
+	}
+	for _, tt := range tests {
+		_, err := spiker.UnmarshalAst([]byte(tt.data))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("UnmarshalAst(%s) error = %v, want %s", tt.data, err, tt.err)
+		}
+	}
+
+	if _, err := spiker.MarshalAst([]spiker.AstNode{spiker.NodeBool{}}); err == nil || err.Error() != "marshal ast: unsupported node type spiker.NodeBool" {
+		t.Errorf("MarshalAst() error = %v", err)
+	}
+}
@@ -10,21 +10,17 @@ type NodeBinaryOp struct {
 
 // Format .
 func (bin NodeBinaryOp) Format() string {
-	f := " " + string(bin.Op) + " "
-	switch bin.Left.(type) {
-	case *NodeBinaryOp:
-		f = "(" + bin.Left.Format() + ")" + f
-	default:
-		f = bin.Left.Format() + f
-	}
-	switch bin.Right.(type) {
-	case *NodeBinaryOp:
-		f += "(" + bin.Right.Format() + ")"
-	default:
-		f += bin.Right.Format()
-	}
+	return defaultPrinter.expr(&bin, -1, 0)
+}
+
+// Pos .
+func (bin NodeBinaryOp) Pos() Position {
+	return startOf(bin.Left, bin.Ast.Pos())
+}
 
-	return f
+// End .
+func (bin NodeBinaryOp) End() Position {
+	return endOf(bin.Right, bin.Ast.End())
 }
 
 // NodeUnaryOp unary operator node
@@ -36,7 +32,12 @@ type NodeUnaryOp struct {
 
 // Format .
 func (un NodeUnaryOp) Format() string {
-	return string(un.Op) + un.Right.Format()
+	return defaultPrinter.expr(&un, -1, 0)
+}
+
+// End .
+func (un NodeUnaryOp) End() Position {
+	return endOf(un.Right, un.Ast.End())
 }
 
 // NodeAssignOp assignment operator node
@@ -49,7 +50,17 @@ type NodeAssignOp struct {
 
 // Format .
 func (as NodeAssignOp) Format() string {
-	return as.Var.Format() + " " + string(as.Op) + " " + as.Expr.Format()
+	return defaultPrinter.expr(&as, -1, 0)
+}
+
+// Pos .
+func (as NodeAssignOp) Pos() Position {
+	return startOf(as.Var, as.Ast.Pos())
+}
+
+// End .
+func (as NodeAssignOp) End() Position {
+	return endOf(as.Expr, as.Ast.End())
 }
 
 // NodeFuncCallOp function call node
@@ -61,25 +72,36 @@ type NodeFuncCallOp struct {
 
 // Format .
 func (fnc NodeFuncCallOp) Format() string {
-	ps := ""
-	for idx, as := range fnc.Params {
-		if idx > 0 {
-			ps += ", "
-		}
-		ps += as.Format()
-	}
+	return defaultPrinter.expr(&fnc, -1, 0)
+}
 
-	return fnc.Name.Format() + "(" + ps + ")"
+// Pos .
+func (fnc NodeFuncCallOp) Pos() Position {
+	return startOf(fnc.Name, fnc.Ast.Pos())
 }
 
 // NodeVarIndex return the value of the specified index(list, string)
 type NodeVarIndex struct {
 	Ast
-	Var   AstNode
-	Index AstNode
+	Var    AstNode
+	Index  AstNode
+	Member bool // accessed by dot, such as `order.items`, the index is a NodeString
 }
 
 // Format .
 func (vi NodeVarIndex) Format() string {
-	return vi.Var.Format() + "[" + vi.Index.Format() + "]"
+	return defaultPrinter.expr(&vi, -1, 0)
+}
+
+// Pos .
+func (vi NodeVarIndex) Pos() Position {
+	return startOf(vi.Var, vi.Ast.Pos())
+}
+
+// End .
+func (vi NodeVarIndex) End() Position {
+	if vi.Member {
+		return endOf(vi.Index, vi.Ast.End())
+	}
+	return vi.Ast.End()
 }
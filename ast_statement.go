@@ -1,7 +1,5 @@
 package spiker
 
-import "strings"
-
 // NodeIf if statement node
 type NodeIf struct {
 	Ast
@@ -13,27 +11,15 @@ type NodeIf struct {
 
 // Format .
 func (ifs NodeIf) Format() string {
-	str := ""
-
-	if ifs.Expr != nil {
-		str += "if (" + ifs.Expr.Format() + ") {\n"
-		str += formatBody(ifs.Body)
-		str += "}"
-	}
+	return defaultPrinter.expr(&ifs, -1, 0)
+}
 
+// End .
+func (ifs NodeIf) End() Position {
 	if ifs.ElseIf != nil {
-		str += " else " + ifs.ElseIf.Format()
+		return endOf(ifs.ElseIf, ifs.Ast.End())
 	}
-
-	if ifs.Else != nil {
-		str += " else {\n"
-		for _, node := range ifs.Else {
-			str += indentStep + node.Format() + ";\n"
-		}
-		str += "}"
-	}
-
-	return str
+	return ifs.Ast.End()
 }
 
 // NodeWhile while statement node
@@ -45,11 +31,7 @@ type NodeWhile struct {
 
 // Format .
 func (nws NodeWhile) Format() string {
-	str := "while (" + nws.Expr.Format() + ") {\n"
-	str += formatBody(nws.Body)
-	str += "}"
-
-	return str
+	return defaultPrinter.expr(&nws, -1, 0)
 }
 
 // NodeContinue continue node
@@ -80,51 +62,13 @@ type NodeReturn struct {
 
 // Format .
 func (nr NodeReturn) Format() string {
-	var str = SymbolReturn.String()
-
-	if len(nr.Tuples) > 0 {
-		var ts []string
-
-		for _, v := range nr.Tuples {
-			ts = append(ts, v.Format())
-		}
-
-		if len(ts) > 1 {
-			str += " (" + strings.Join(ts, ", ")
-		} else if len(ts) == 1 {
-			str += " " + ts[0]
-		}
-	}
-
-	return str
+	return defaultPrinter.expr(&nr, -1, 0)
 }
 
-// format body statements for IF/FUNC/WHILE
-func formatBody(bs []AstNode) string {
-	var str string
-	for _, node := range bs {
-		str += indentStep
-		switch node.(type) {
-		case NodeIf, NodeFuncDef, NodeWhile, *NodeIf, *NodeFuncDef, *NodeWhile:
-			split := strings.Split(node.Format(), "\n")
-			cnt := len(split)
-			for idx, s := range split {
-				if idx > 0 {
-					str += indentStep
-				}
-				if len(s) > 0 {
-					str += s
-				}
-				if idx+1 < cnt {
-					str += "\n"
-				}
-			}
-		default:
-			str += node.Format()
-			str += ";"
-		}
-		str += "\n"
+// End .
+func (nr NodeReturn) End() Position {
+	if nr.Ast.end != nil {
+		return nr.Ast.End()
 	}
-
-	return str
+	return endOfList(nr.Tuples, nr.Ast.End())
 }
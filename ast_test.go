@@ -0,0 +1,160 @@
+package spiker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+// return the source text of every node in ast
+func nodeSpans(t *testing.T, code string, ast []spiker.AstNode) []string {
+	var spans []string
+	for _, node := range ast {
+		spiker.Inspect(node, func(n spiker.AstNode) bool {
+			if n == nil {
+				return false
+			}
+			pos, end := n.Pos(), n.End()
+			if !pos.IsValid() || !end.IsValid() || pos.Offset > end.Offset {
+				t.Errorf("%s has invalid span %v-%v", nodeName(n), pos, end)
+				return false
+			}
+			spans = append(spans, nodeName(n)+" "+pos.String()+" "+code[pos.Offset:end.Offset])
+			return true
+		})
+	}
+	return spans
+}
+
+func TestAstNode_Position(t *testing.T) {
+	tests := []struct {
+		code  string
+		spans []string
+	}{
+		{
+			`a += -b * (c + 1);`,
+			[]string{
+				"AssignOp 1:1 a += -b * (c + 1)",
+				"Variable 1:1 a",
+				"BinaryOp 1:6 -b * (c + 1)",
+				"UnaryOp 1:6 -b",
+				"Variable 1:7 b",
+				"BinaryOp 1:12 c + 1",
+				"Variable 1:12 c",
+				"Number 1:16 1",
+			},
+		},
+		{
+			`x = [1, "k": 2]; y = x["k"] + len( x ) + x.k;`,
+			[]string{
+				"AssignOp 1:1 x = [1, \"k\": 2]",
+				"Variable 1:1 x",
+				"Map 1:5 [1, \"k\": 2]",
+				"Number 1:6 ",
+				"Number 1:6 1",
+				"String 1:9 \"k\"",
+				"Number 1:14 2",
+				"AssignOp 1:18 y = x[\"k\"] + len( x ) + x.k",
+				"Variable 1:18 y",
+				"BinaryOp 1:22 x[\"k\"] + len( x ) + x.k",
+				"BinaryOp 1:22 x[\"k\"] + len( x )",
+				"VarIndex 1:22 x[\"k\"]",
+				"Variable 1:22 x",
+				"String 1:24 \"k\"",
+				"FuncCallOp 1:31 len( x )",
+				"Variable 1:31 len",
+				"Variable 1:36 x",
+				"VarIndex 1:42 x.k",
+				"Variable 1:42 x",
+				"String 1:44 k",
+			},
+		},
+		{
+			"s = \"中文\";\nif (s) {\n  t = [];\n} else if (!s) {\n  break;\n} else {\n  continue;\n}",
+			[]string{
+				"AssignOp 1:1 s = \"中文\"",
+				"Variable 1:1 s",
+				"String 1:5 \"中文\"",
+				"If 2:1 if (s) {\n  t = [];\n} else if (!s) {\n  break;\n} else {\n  continue;\n}",
+				"Variable 2:5 s",
+				"AssignOp 3:3 t = []",
+				"Variable 3:3 t",
+				"List 3:7 []",
+				"If 4:8 if (!s) {\n  break;\n} else {\n  continue;\n}",
+				"UnaryOp 4:12 !s",
+				"Variable 4:13 s",
+				"Break 5:3 break",
+				"Continue 7:3 continue",
+			},
+		},
+		{
+			"f = (a, b) -> {\n  while (a < b) { a += 1; }\n  return (a, b);\n};\ng = x -> x * 2;",
+			[]string{
+				"FuncDef 1:1 f = (a, b) -> {\n  while (a < b) { a += 1; }\n  return (a, b);\n}",
+				"Variable 1:1 f",
+				"Param 1:6 a",
+				"Variable 1:6 a",
+				"Param 1:9 b",
+				"Variable 1:9 b",
+				"While 2:3 while (a < b) { a += 1; }",
+				"BinaryOp 2:10 a < b",
+				"Variable 2:10 a",
+				"Variable 2:14 b",
+				"AssignOp 2:19 a += 1",
+				"Variable 2:19 a",
+				"Number 2:24 1",
+				"Return 3:3 return (a, b)",
+				"Variable 3:11 a",
+				"Variable 3:14 b",
+				"FuncDef 5:1 g = x -> x * 2",
+				"Variable 5:1 g",
+				"Param 5:5 x",
+				"Variable 5:5 x",
+				"BinaryOp 5:10 x * 2",
+				"Variable 5:10 x",
+				"Number 5:14 2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			ast, err := spiker.ParseAst(tt.code)
+			if err != nil {
+				t.Fatalf("ParseAst() error = %v", err)
+			}
+			if got := nodeSpans(t, tt.code, ast); !reflect.DeepEqual(got, tt.spans) {
+				t.Errorf("spans = %q\nwant %q", got, tt.spans)
+			}
+
+			// the spans are kept by JSON
+			data, err := spiker.MarshalAst(ast)
+			if err != nil {
+				t.Fatalf("MarshalAst() error = %v", err)
+			}
+			decoded, err := spiker.UnmarshalAst(data)
+			if err != nil {
+				t.Fatalf("UnmarshalAst() error = %v", err)
+			}
+			if got := nodeSpans(t, tt.code, decoded); !reflect.DeepEqual(got, tt.spans) {
+				t.Errorf("decoded spans = %q\nwant %q", got, tt.spans)
+			}
+		})
+	}
+}
+
+func TestAstNode_PositionOptimized(t *testing.T) {
+	code := `a = 1 + 2 * 3;`
+	ast, err := spiker.ParseAst(code)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	// the folded literal covers the original expression
+	got := nodeSpans(t, code, spiker.Optimize(ast))
+	want := []string{"AssignOp 1:1 a = 1 + 2 * 3", "Variable 1:1 a", "Number 1:5 1 + 2 * 3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %q\nwant %q", got, want)
+	}
+}
@@ -66,16 +66,7 @@ type NodeList struct {
 
 // Format .
 func (arr NodeList) Format() string {
-	f := "["
-	for idx, as := range arr.List {
-		if idx > 0 {
-			f += ", "
-		}
-		f += as.Format()
-	}
-	f += "]"
-
-	return f
+	return defaultPrinter.expr(&arr, -1, 0)
 }
 
 // NodeMap map node
@@ -86,22 +77,45 @@ type NodeMap struct {
 
 // Format .
 func (nm NodeMap) Format() string {
-	sortedKeys := make([]string, 0)
-	sortMap := make(map[string]AstNode)
-	for kn, kv := range nm.Map {
-		sortedKeys = append(sortedKeys, kn.Format())
-		sortMap[kn.Format()] = kv
-	}
-	sort.Strings(sortedKeys)
+	return defaultPrinter.expr(&nm, -1, 0)
+}
 
-	f := "["
-	for idx, key := range sortedKeys {
-		if idx > 0 {
-			f += ", "
+// the key and value of NodeMap
+type mapEntry struct {
+	key, value AstNode
+}
+
+// return the entries of map in the order of source, the entries without
+// position are sorted by key at the end
+func sortedEntries(m map[AstNode]AstNode) []mapEntry {
+	type sortable struct {
+		mapEntry
+		offset int
+		known  bool // the position is known
+	}
+	list := make([]sortable, 0, len(m))
+	for k, v := range m {
+		e := sortable{mapEntry: mapEntry{key: k, value: v}}
+		if k != nil && k.Raw() != nil {
+			e.offset, e.known = k.Raw().offset, true
+		} else if v != nil && v.Raw() != nil {
+			e.offset, e.known = v.Raw().offset, true
 		}
-		f += key + ": " + sortMap[key].Format()
+		list = append(list, e)
 	}
-	f += "]"
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].known != list[j].known {
+			return list[i].known
+		}
+		if list[i].offset != list[j].offset {
+			return list[i].offset < list[j].offset
+		}
+		return list[i].key != nil && (list[j].key == nil || list[i].key.Format() < list[j].key.Format())
+	})
 
-	return f
+	entries := make([]mapEntry, len(list))
+	for i, e := range list {
+		entries[i] = e.mapEntry
+	}
+	return entries
 }
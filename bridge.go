@@ -0,0 +1,632 @@
+package spiker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	funcDefType = reflect.TypeOf(&NodeFuncDef{})
+)
+
+// ToValue convert the Go value to the value of script, the VariableScope.Set
+// and builtin function results are converted by it:
+//
+// - all integer kinds are converted to int, or float64 if it overflows
+// - all float kinds are converted to float64
+// - string and bool kinds are converted to string and bool
+// - slice and array are converted to ValueList, except []byte is string
+// - map is converted to ValueMap, the keys are converted to string
+// - struct is converted to ValueMap of its exported fields, the key is the
+// `spiker:"name"` tag or the field name, `spiker:"-"` skips the field,
+// the fields of embedded struct are promoted
+// - time.Time is converted to string in RFC3339 format
+// - pointer and interface are converted to the value they point to
+// - nil pointer, nil map and nil slice are converted to nil
+//
+// The value refers to itself by pointer, map or slice returns ErrCyclicValue,
+// the chan, func, complex and unsafe.Pointer values return an error of unsupported type
+func ToValue(v interface{}) (interface{}, error) {
+	// the values of script are not converted
+	switch val := v.(type) {
+	case []interface{}:
+		if isListValue(val, 0) {
+			return ValueList(val), nil
+		}
+	case map[string]interface{}:
+		if isMapValue(val, 0) {
+			return ValueMap(val), nil
+		}
+	default:
+		if isValue(v, 0) {
+			return v, nil
+		}
+	}
+
+	c := valueConverter{visiting: make(map[visitKey]bool)}
+	return c.convert(reflect.ValueOf(v))
+}
+
+// ErrCyclicValue the Go value refers to itself, can't be converted to the value of script
+var ErrCyclicValue = errors.New("cyclic value")
+
+// the max depth of the nested lists and maps checked without reflection
+const maxValueDepth = 32
+
+// whether v is the value of script, the deep nested lists and maps are not checked
+func isValue(v interface{}, depth int) bool {
+	switch val := v.(type) {
+	case nil, int, float64, string, bool, *NodeFuncDef:
+		return true
+	case ValueList:
+		return isListValue(val, depth)
+	case ValueMap:
+		return isMapValue(val, depth)
+	}
+	return false
+}
+
+func isListValue(list []interface{}, depth int) bool {
+	if depth >= maxValueDepth {
+		return false
+	}
+	for _, v := range list {
+		if !isValue(v, depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+func isMapValue(dict map[string]interface{}, depth int) bool {
+	if depth >= maxValueDepth {
+		return false
+	}
+	for _, v := range dict {
+		if !isValue(v, depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// convert the Go value by reflection
+type valueConverter struct {
+	visiting map[visitKey]bool // the pointers, maps and slices being converted, for the cycle
+}
+
+// the slices share the same array are different if their lengths or types are different
+type visitKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// mark the reference being converted, return false if it's converting, it's a cycle
+func (c *valueConverter) visit(rv reflect.Value) (visitKey, bool) {
+	key := visitKey{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		key.len = rv.Len()
+	}
+	if c.visiting[key] {
+		return key, false
+	}
+	c.visiting[key] = true
+	return key, true
+}
+
+func (c *valueConverter) convert(rv reflect.Value) (interface{}, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	// the unexported values can't be interfaced, such as the fields promoted from unexported struct
+	switch rv.Type() {
+	case timeType:
+		if rv.CanInterface() {
+			return rv.Interface().(time.Time).Format(time.RFC3339), nil
+		}
+		return nil, nil
+	case funcDefType:
+		if rv.CanInterface() {
+			return rv.Interface(), nil
+		}
+		return nil, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rv.Int()
+		if int64(int(n)) == n {
+			return int(n), nil
+		}
+		return float64(n), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := rv.Uint()
+		if n <= math.MaxInt64 && uint64(int(n)) == n {
+			return int(n), nil
+		}
+		return float64(n), nil
+
+	case reflect.Float32:
+		// keep the shortest decimal representation, 0.1 instead of 0.10000000149011612
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+		return f, nil
+
+	case reflect.Float64:
+		return rv.Float(), nil
+
+	case reflect.String:
+		return rv.String(), nil
+
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		key, ok := c.visit(rv)
+		if !ok {
+			return nil, ErrCyclicValue
+		}
+		defer delete(c.visiting, key)
+		return c.convert(rv.Elem())
+
+	case reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return c.convert(rv.Elem())
+
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+		if rv.Len() == 0 {
+			return ValueList{}, nil
+		}
+		key, ok := c.visit(rv)
+		if !ok {
+			return nil, ErrCyclicValue
+		}
+		defer delete(c.visiting, key)
+		return c.convertList(rv)
+
+	case reflect.Array:
+		return c.convertList(rv)
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		key, ok := c.visit(rv)
+		if !ok {
+			return nil, ErrCyclicValue
+		}
+		defer delete(c.visiting, key)
+
+		dict := make(ValueMap, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k, err := c.convert(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			v, err := c.convert(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			dict[Interface2String(k)] = v
+		}
+		return dict, nil
+
+	case reflect.Struct:
+		dict := make(ValueMap)
+		if err := c.convertStruct(rv, dict); err != nil {
+			return nil, err
+		}
+		return dict, nil
+	}
+
+	// chan, func, complex and unsafe.Pointer
+	return nil, fmt.Errorf("unsupported type %s", rv.Type())
+}
+
+func (c *valueConverter) convertList(rv reflect.Value) (interface{}, error) {
+	list := make(ValueList, rv.Len())
+	for i := range list {
+		v, err := c.convert(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+// store the exported fields of struct to the map
+func (c *valueConverter) convertStruct(rv reflect.Value, dict ValueMap) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("spiker")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		// promote the fields of embedded struct, the outer fields win
+		if f.Anonymous && name == "" {
+			fv := rv.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				embedded := make(ValueMap)
+				if err := c.convertStruct(fv, embedded); err != nil {
+					return err
+				}
+				for k, v := range embedded {
+					if _, ok := dict[k]; !ok {
+						dict[k] = v
+					}
+				}
+				continue
+			}
+		}
+
+		// unexported field
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		v, err := c.convert(rv.Field(i))
+		if err != nil {
+			return err
+		}
+		dict[name] = v
+	}
+	return nil
+}
+
+// return the type name of the script value
+func valueTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case int, float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case ValueList:
+		return "list"
+	case ValueMap:
+		return "map"
+	case *NodeFuncDef:
+		return "func"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// return the type name of the Go type in script
+func goTypeName(t reflect.Type) string {
+	if t == timeType {
+		return "time"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "list"
+	case reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "map"
+	case reflect.Ptr:
+		return goTypeName(t.Elem())
+	case reflect.Interface:
+		return "any"
+	}
+	return t.String()
+}
+
+// convert the value of script to the Go value by reflection,
+// the reverse of valueConverter
+type valueDecoder struct {
+	path []string // the path of the value being decoded, for the error
+}
+
+// decode the value into the Go value of type t
+func (d *valueDecoder) decode(v interface{}, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.New(t).Elem()
+	if err := d.decodeInto(v, rv); err != nil {
+		return rv, err
+	}
+	return rv, nil
+}
+
+func (d *valueDecoder) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if len(d.path) > 0 {
+		msg += " at " + strings.TrimPrefix(strings.Join(d.path, ""), ".")
+	}
+	return errors.New(msg)
+}
+
+func (d *valueDecoder) mismatch(v interface{}, t reflect.Type) error {
+	return d.errorf("cannot use %s as %s", valueTypeName(v), goTypeName(t))
+}
+
+func (d *valueDecoder) enter(elem string) {
+	d.path = append(d.path, elem)
+}
+
+func (d *valueDecoder) leave() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// decode the value into the settable Go value
+func (d *valueDecoder) decodeInto(v interface{}, rv reflect.Value) error {
+	t := rv.Type()
+
+	// the script value is kept as it is
+	if t.Kind() == reflect.Interface {
+		if v == nil {
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		if !reflect.TypeOf(v).Implements(t) {
+			return d.mismatch(v, t)
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		return d.mismatch(v, t)
+	}
+
+	if t == timeType {
+		s, ok := v.(string)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return d.errorf("cannot parse %q as time", s)
+		}
+		rv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		rv.SetBool(b)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := d.number(v)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		n := int64(f)
+		if float64(n) != f || rv.OverflowInt(n) {
+			return d.errorf("cannot use %s as %s", Interface2String(v), t)
+		}
+		rv.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := d.number(v)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		n := uint64(f)
+		if f < 0 || float64(n) != f || rv.OverflowUint(n) {
+			return d.errorf("cannot use %s as %s", Interface2String(v), t)
+		}
+		rv.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := d.number(v)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		rv.SetFloat(f)
+		return nil
+
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		rv.SetString(s)
+		return nil
+
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := d.decodeInto(v, elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		if s, ok := v.(string); ok && t.Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes([]byte(s))
+			return nil
+		}
+		list, ok := v.(ValueList)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		rv.Set(reflect.MakeSlice(t, len(list), len(list)))
+		return d.decodeList(list, rv)
+
+	case reflect.Array:
+		list, ok := v.(ValueList)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		if len(list) != rv.Len() {
+			return d.errorf("cannot use list of length %d as %s", len(list), t)
+		}
+		return d.decodeList(list, rv)
+
+	case reflect.Map:
+		dict, ok := v.(ValueMap)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(dict))
+		for k, val := range dict {
+			d.enter("." + k)
+			// the keys of map are always string in script
+			var key interface{} = k
+			if goTypeName(t.Key()) == "number" {
+				if n, err := ParseNumber(k); err == nil {
+					key = n
+				}
+			}
+			kv, err := d.decode(key, t.Key())
+			if err == nil {
+				var elem reflect.Value
+				elem, err = d.decode(val, t.Elem())
+				m.SetMapIndex(kv, elem)
+			}
+			d.leave()
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(m)
+		return nil
+
+	case reflect.Struct:
+		dict, ok := v.(ValueMap)
+		if !ok {
+			return d.mismatch(v, t)
+		}
+		return d.decodeStruct(dict, rv)
+	}
+
+	return d.errorf("unsupported type %s", t)
+}
+
+// return the number of script value
+func (d *valueDecoder) number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (d *valueDecoder) decodeList(list ValueList, rv reflect.Value) error {
+	for i, val := range list {
+		d.enter("[" + strconv.Itoa(i) + "]")
+		err := d.decodeInto(val, rv.Index(i))
+		d.leave()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode the map into the exported fields of struct, matched the same as valueConverter
+func (d *valueDecoder) decodeStruct(dict ValueMap, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("spiker")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		// the fields of embedded struct are promoted
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				if f.Type.Kind() == reflect.Ptr {
+					// unexported embedded pointer can't be allocated
+					if f.PkgPath != "" {
+						continue
+					}
+					if rv.Field(i).IsNil() {
+						rv.Field(i).Set(reflect.New(ft))
+					}
+					if err := d.decodeStruct(dict, rv.Field(i).Elem()); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := d.decodeStruct(dict, rv.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		// unexported field
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		val, ok := dict[name]
+		if !ok {
+			continue
+		}
+		d.enter("." + name)
+		err := d.decodeInto(val, rv.Field(i))
+		d.leave()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package spiker_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/shockerli/spiker"
+)
+
+type bridgeBase struct {
+	ID      int64  `spiker:"id"`
+	Comment string `spiker:"comment"`
+}
+
+type bridgeItem struct {
+	Name  string  `spiker:"name"`
+	Price float32 `spiker:"price"`
+	Qty   uint8   `spiker:"qty"`
+}
+
+type bridgeOrder struct {
+	bridgeBase
+	Comment  string          `spiker:"comment"`
+	Amount   float64         `spiker:"amount"`
+	Items    []bridgeItem    `spiker:"items"`
+	Tags     []string        `spiker:"tags"`
+	Counts   map[string]int  `spiker:"counts"`
+	Flags    map[int]bool    `spiker:"flags"`
+	Created  time.Time       `spiker:"created"`
+	Customer *bridgeCustomer `spiker:"customer"`
+	Extra    interface{}     `spiker:"extra"`
+	Raw      []byte          `spiker:"raw"`
+	Secret   string          `spiker:"-"`
+	Untagged int16
+	hidden   string
+	Nil      map[string]string `spiker:"nil"`
+}
+
+type bridgeCustomer struct {
+	Name  string          `spiker:"name"`
+	VIP   bool            `spiker:"vip"`
+	Order *bridgeOrder    `spiker:"order"`
+	Level *int            `spiker:"level"`
+	Score [2]uint64       `spiker:"score"`
+	Dur   time.Duration   `spiker:"dur"`
+	Attrs map[string]bool `spiker:"attrs"`
+}
+
+func TestToValue(t *testing.T) {
+	level := 3
+	order := &bridgeOrder{
+		bridgeBase: bridgeBase{ID: 42, Comment: "base"},
+		Comment:    "outer",
+		Amount:     99.5,
+		Items:      []bridgeItem{{"apple", 0.1, 3}, {"pear", 2.5, 1}},
+		Tags:       []string{"a", "b"},
+		Counts:     map[string]int{"x": 1},
+		Flags:      map[int]bool{7: true},
+		Created:    time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Customer:   &bridgeCustomer{Name: "bob", VIP: true, Level: &level, Score: [2]uint64{1, math.MaxUint64}, Dur: time.Second},
+		Extra:      int32(5),
+		Raw:        []byte("raw"),
+		Secret:     "secret",
+		Untagged:   -1,
+		hidden:     "hidden",
+	}
+	want := spiker.ValueMap{
+		"id":      42,
+		"comment": "outer",
+		"amount":  99.5,
+		"items": spiker.ValueList{
+			spiker.ValueMap{"name": "apple", "price": 0.1, "qty": 3},
+			spiker.ValueMap{"name": "pear", "price": 2.5, "qty": 1},
+		},
+		"tags":    spiker.ValueList{"a", "b"},
+		"counts":  spiker.ValueMap{"x": 1},
+		"flags":   spiker.ValueMap{"7": true},
+		"created": "2021-03-04T05:06:07Z",
+		"customer": spiker.ValueMap{
+			"name":  "bob",
+			"vip":   true,
+			"order": nil,
+			"level": 3,
+			"score": spiker.ValueList{1, float64(math.MaxUint64)},
+			"dur":   int(time.Second),
+			"attrs": nil,
+		},
+		"extra":    5,
+		"raw":      "raw",
+		"Untagged": -1,
+		"nil":      nil,
+	}
+
+	if got, err := spiker.ToValue(order); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ToValue() = %#v, %v, want %#v", got, err, want)
+	}
+
+	// the values of script are not changed
+	for _, v := range []interface{}{nil, 1, 1.5, "s", true} {
+		if got, err := spiker.ToValue(v); err != nil || got != v {
+			t.Errorf("ToValue(%#v) = %#v, %v", v, got, err)
+		}
+	}
+}
+
+func TestToValue_ScriptValue(t *testing.T) {
+	list := spiker.ValueList{1, "a", spiker.ValueMap{"b": true}}
+	dict := spiker.ValueMap{"list": list}
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{list, list},
+		{dict, dict},
+		{[]interface{}{1, "a", list}, spiker.ValueList{1, "a", list}},
+		{map[string]interface{}{"a": dict}, spiker.ValueMap{"a": dict}},
+		{spiker.ValueList{int8(1), []interface{}{uint(2)}}, spiker.ValueList{1, spiker.ValueList{2}}},
+		{spiker.ValueMap{"a": []string{"b"}}, spiker.ValueMap{"a": spiker.ValueList{"b"}}},
+		{[]interface{}{int64(1), map[string]interface{}{"a": 2}}, spiker.ValueList{1, spiker.ValueMap{"a": 2}}},
+	}
+	for _, tt := range tests {
+		got, err := spiker.ToValue(tt.value)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ToValue(%#v) = %#v, %v, want %#v", tt.value, got, err, tt.want)
+		}
+	}
+
+	// the list of script is kept without copy
+	got, _ := spiker.ToValue([]interface{}{1, 2})
+	got.(spiker.ValueList)[0] = 3
+	if got.(spiker.ValueList)[1] != 2 {
+		t.Errorf("ToValue() = %#v", got)
+	}
+}
+
+func TestToValue_Unsupported(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		err   string
+	}{
+		{make(chan int), "unsupported type chan int"},
+		{func() {}, "unsupported type func()"},
+		{complex(1, 2), "unsupported type complex128"},
+		{unsafe.Pointer(nil), "unsupported type unsafe.Pointer"},
+		{[]interface{}{1, make(chan int)}, "unsupported type chan int"},
+		{struct{ F func() }{}, "unsupported type func()"},
+	}
+	for _, tt := range tests {
+		got, err := spiker.ToValue(tt.value)
+		if err == nil || err.Error() != tt.err || got != nil {
+			t.Errorf("ToValue(%T) = %#v, %v, want error %s", tt.value, got, err, tt.err)
+		}
+	}
+
+	scope := spiker.NewScopeTable("unsupported", 1, nil)
+	if err := scope.SetValue("ch", make(chan int)); err == nil {
+		t.Error("SetValue() should report the unsupported type")
+	}
+	if _, ok := scope.Get("ch"); ok {
+		t.Error("SetValue() should not store the unsupported value")
+	}
+}
+
+func TestToValue_Cycle(t *testing.T) {
+	order := &bridgeOrder{Customer: &bridgeCustomer{}}
+	order.Customer.Order = order
+
+	list := []interface{}{1, nil}
+	list[1] = list
+
+	dict := map[string]interface{}{"a": 1}
+	dict["self"] = dict
+
+	nested := spiker.ValueList{1, nil}
+	nested[1] = spiker.ValueMap{"list": nested}
+
+	for _, v := range []interface{}{order, list, dict, nested} {
+		if got, err := spiker.ToValue(v); err != spiker.ErrCyclicValue {
+			t.Errorf("ToValue(%T) = %#v, %v, want ErrCyclicValue", v, got, err)
+		}
+	}
+
+	// the shared value is not a cycle
+	shared := []int{1}
+	if got, err := spiker.ToValue([][]int{shared, shared}); err != nil || len(got.(spiker.ValueList)) != 2 {
+		t.Errorf("ToValue() = %#v, %v", got, err)
+	}
+
+	scope := spiker.NewScopeTable("cycle", 1, nil)
+	if err := scope.SetValue("dict", dict); err != spiker.ErrCyclicValue {
+		t.Errorf("SetValue() error = %v", err)
+	}
+	scope.Set("dict", dict)
+	if _, ok := scope.Get("dict"); ok {
+		t.Error("Set() should not store the cyclic value")
+	}
+
+	e := spiker.New(spiker.WithFunc("cycle", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		return dict
+	}))
+	if _, err := e.Execute(`a = cycle();`); !errors.Is(err, spiker.ErrCyclicValue) {
+		t.Errorf("Execute() error = %v", err)
+	}
+}
+
+func TestToValue_Script(t *testing.T) {
+	order := bridgeOrder{
+		Amount: 10,
+		Items:  []bridgeItem{{"apple", 0.1, 3}, {"pear", 2.5, 2}},
+		Counts: map[string]int{"apple": 3},
+		Customer: &bridgeCustomer{
+			Name: "bob",
+			VIP:  true,
+		},
+		Created: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+	}
+
+	tests := []struct {
+		code string
+		want interface{}
+	}{
+		{`order.items[0].price * order.items[0].qty;`, 0.3},
+		{`order["items"][1]["name"];`, "pear"},
+		{`order.amount + order.counts.apple;`, float64(13)},
+		{`order.customer.vip && order.customer.name == "bob";`, true},
+		{`len(order.items);`, 2},
+		{`order.created >= "2021-01-01";`, true},
+		{`"pear" in order.counts;`, false},
+		{`exist(order.customer.level) && exist(order.customer.missing) == false;`, true},
+		{`order.customer.level;`, nil},
+		{`total = 0; i = 0; while (i < len(order.items)) { total += order.items[i].price * order.items[i].qty; i += 1; } total;`, 5.3},
+	}
+	for _, tt := range tests {
+		for _, bytecode := range []bool{false, true} {
+			scope := spiker.NewScopeTable("order", 1, nil)
+			scope.Set("order", &order)
+
+			p, err := spiker.New(spiker.WithBytecode(bytecode)).Compile(tt.code)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.code, err)
+			}
+			got, err := p.Run(scope)
+			if err != nil {
+				t.Errorf("Run(%q, bytecode=%v) error = %v", tt.code, bytecode, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run(%q, bytecode=%v) = %#v, want %#v", tt.code, bytecode, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestToValue_BuiltinResult(t *testing.T) {
+	e := spiker.New(spiker.WithFunc("customer", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		return bridgeCustomer{Name: "bob", Score: [2]uint64{7, 8}}
+	}))
+
+	got, err := e.Execute(`c = customer(); c.name + c.score[1];`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got != "bob8" {
+		t.Errorf("Execute() = %#v", got)
+	}
+
+	// the member of call result
+	got, err = e.Execute(`customer().name + customer().score[0];`)
+	if err != nil || got != "bob7" {
+		t.Errorf("Execute() = %#v, %v", got, err)
+	}
+}
+
+func TestParser_Member(t *testing.T) {
+	tests := []struct {
+		code   string
+		format string
+		err    string
+	}{
+		{`a.b;`, `a.b;`, ""},
+		{`a.b[0].c;`, `a.b[0].c;`, ""},
+		{`a["b"].c;`, `a["b"].c;`, ""},
+		{`f = x -> x.y;`, `f = x -> x.y;`, ""},
+		{`f().a;`, `f().a;`, ""},
+		{`f()[0].a.b;`, `f()[0].a.b;`, ""},
+		{`a.5;`, "", `syntax error: expected member name, but got "5" on line 1:3`},
+		{`1.b;`, "", `syntax error: expected ";", but got "b" on line 1:3`},
+	}
+	for _, tt := range tests {
+		got, err := spiker.Format(tt.code)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Format(%q) error = %v, want %s", tt.code, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.format {
+			t.Errorf("Format(%q) = %q, %v, want %q", tt.code, got, err, tt.format)
+		}
+	}
+}
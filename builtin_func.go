@@ -8,41 +8,41 @@ import (
 // Func builtin function type
 type Func func(fnc *NodeFuncCallOp, scope *VariableScope) interface{}
 
-// builtin function pool
-var builtinMap = make(map[string]Func)
-
 func init() {
-	// init builtin function
-	registerExport()
-	registerLen()
-	registerExist()
-	registerDel()
-	registerPrint()
+	defaultEngine = New()
 }
 
-// RegisterFunc register builtin function
+// RegisterFunc register builtin function to the default engine
 func RegisterFunc(name string, fn Func) {
-	if name != "" && fn != nil {
-		builtinMap[name] = fn
-	}
+	defaultEngine.RegisterFunc(name, fn)
+}
+
+// register the standard builtin functions
+func registerBuiltins(e *Engine) {
+	registerExport(e)
+	registerLen(e)
+	registerExist(e)
+	registerDel(e)
+	registerPrint(e)
 }
 
 // return the expression value, and interrupt script
 // Example: export(123)
-func registerExport() {
-	RegisterFunc("export", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+func registerExport(e *Engine) {
+	e.RegisterFunc("export", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
 		if len(fnc.Params) != 1 {
 			panic(fmt.Sprintf("export() expects 1 parameters, %d given", len(fnc.Params)))
 		}
 
-		panic(directiveExport{val: EvalExpr(fnc.Params[0], scope)})
+		// interrupt the script, recovered by the function call
+		panic(completion{typ: completionExport, val: EvalExpr(fnc.Params[0], scope)})
 	})
 }
 
 // return the length of expression
 // Example: len("123")
-func registerLen() {
-	RegisterFunc("len", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+func registerLen(e *Engine) {
+	e.RegisterFunc("len", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
 		if len(fnc.Params) != 1 {
 			panic(fmt.Sprintf("len() expects 1 parameters, %d given", len(fnc.Params)))
 		}
@@ -65,8 +65,8 @@ func registerLen() {
 
 // whether a variable or index is existed
 // Example: exist(var), exist(var[9]), exist(var[name])
-func registerExist() {
-	RegisterFunc("exist", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+func registerExist(e *Engine) {
+	e.RegisterFunc("exist", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
 		if len(fnc.Params) != 1 {
 			panic(fmt.Sprintf("exist() expects 1 parameters, %d given", len(fnc.Params)))
 		}
@@ -115,8 +115,8 @@ func registerExist() {
 
 // delete one or more variable or index
 // Example: del(var), del(var["name"]), del(var[9])
-func registerDel() {
-	RegisterFunc("del", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+func registerDel(e *Engine) {
+	e.RegisterFunc("del", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
 		if len(fnc.Params) < 1 {
 			panic(fmt.Sprintf("del() expects least 1 parameters, %d given", len(fnc.Params)))
 		}
@@ -144,7 +144,7 @@ func registerDel() {
 					case *NodeVariable:
 						// self scope no value
 						if _, ok := scope.enclosingScope.Get(vr.Value); ok {
-							scope.enclosingScope.Set(vr.Value, varVal)
+							scope.enclosingScope.set(vr.Value, varVal)
 						}
 					}
 
@@ -162,7 +162,7 @@ func registerDel() {
 					case *NodeVariable:
 						// self scope no value
 						if _, ok := scope.enclosingScope.Get(vr.Value); ok {
-							scope.enclosingScope.Set(vr.Value, varVal)
+							scope.enclosingScope.set(vr.Value, varVal)
 						}
 					}
 				}
@@ -175,8 +175,8 @@ func registerDel() {
 
 // print one or more expression value to the terminal
 // Example: print(123)
-func registerPrint() {
-	RegisterFunc("print", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+func registerPrint(e *Engine) {
+	e.RegisterFunc("print", func(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
 		for _, v := range fnc.Params {
 			fmt.Print(EvalExpr(v, scope))
 		}
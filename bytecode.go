@@ -0,0 +1,405 @@
+package spiker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WithBytecode compile programs to bytecode and run them on the virtual machine,
+// the program falls back to the tree-walking evaluator if it can't be compiled
+func WithBytecode(enable bool) Option {
+	return func(e *Engine) {
+		e.bytecode = enable
+	}
+}
+
+// returned when the ast nodes can't be compiled to bytecode
+var errBytecodeUnsupported = errors.New("bytecode unsupported")
+
+// opcode virtual machine instruction
+type opcode uint8
+
+const (
+	opNil          opcode = iota // push nil
+	opConst                      // push constant `a`
+	opPop                        // pop the top value
+	opLoad                       // push the value of slot `a`
+	opStore                      // pop the top value into slot `a`
+	opAssign                     // assign the top value to slot `a` with operator `sym`
+	opUnary                      // unary operator `sym`
+	opBinary                     // binary operator `sym`
+	opList                       // build a list of `a` values
+	opMap                        // build a map of `a` key-value pairs
+	opIndexable                  // replace the top value with nil and jump to `a` if it doesn't support index
+	opIndex                      // index the value
+	opDefFunc                    // store the function define `b` into slot `a`
+	opCall                       // call site `a`, builtin function call jumps to `b`
+	opCallCustom                 // execute the custom function of call site `a`
+	opJump                       // jump to `a`
+	opJumpIfFalse                // pop the top value, jump to `a` if it's false
+	opLoop                       // check the context in loop
+	opCheckContext               // check the context before a statement
+	opResult                     // pop the top value as the result of program if it's not nil
+	opReturn                     // return the top value from the function
+	opReturnTuple                // return `a` values from the function
+	opExit                       // end the program with `a` return values
+	opStep                       // count the evaluated node for the step limit
+)
+
+// instruction of virtual machine
+type instr struct {
+	op  opcode
+	a   int
+	b   int
+	sym Symbol
+}
+
+// compiled function
+type proto struct {
+	name  string
+	code  []instr
+	nodes []AstNode // node of each instruction, for errors
+	names []string  // slot names, empty name is a hidden slot
+	index map[string]int
+	def   *NodeFuncDef
+}
+
+// the call site of function
+type callSite struct {
+	node   *NodeFuncCallOp
+	name   string
+	local  int // slot of custom function in the current frame, -1 means none
+	global int // slot of custom function in the main frame, -1 means none
+}
+
+// compiled program
+type bytecode struct {
+	main   *proto
+	consts []interface{}
+	defs   []*NodeFuncDef
+	funcs  map[*NodeFuncDef]*proto
+	calls  []callSite
+}
+
+// compileBytecode compile the ast nodes to bytecode
+func compileBytecode(nodeList []AstNode) (bc *bytecode, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e, ok := e.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+
+	bc = &bytecode{funcs: make(map[*NodeFuncDef]*proto)}
+	c := &compiler{bc: bc, proto: newProto("main", nil)}
+	bc.main = c.proto
+
+	for _, node := range nodeList {
+		c.emit(opCheckContext, 0, 0, "", node)
+		switch node := node.(type) {
+		case *NodeReturn, *NodeBreak, *NodeContinue:
+			// no effect in the top level
+			c.emit(opStep, 0, 0, "", node)
+		case *NodeFuncDef:
+			c.emit(opStep, 0, 0, "", node)
+			c.funcDef(node)
+		default:
+			c.expr(node)
+			c.emit(opResult, 0, 0, "", node)
+		}
+	}
+
+	return
+}
+
+func newProto(name string, def *NodeFuncDef) *proto {
+	return &proto{name: name, def: def, index: make(map[string]int)}
+}
+
+// compiler state of a function
+type compiler struct {
+	bc     *bytecode
+	proto  *proto
+	global *compiler // compiler of the main program, nil if it's the main program
+	loops  []*loop
+}
+
+// jump targets of the loop
+type loop struct {
+	start  int
+	result int   // hidden slot of loop value
+	breaks []int // instructions jump to the end
+}
+
+func (c *compiler) emit(op opcode, a int, b int, sym Symbol, node AstNode) int {
+	c.proto.code = append(c.proto.code, instr{op: op, a: a, b: b, sym: sym})
+	c.proto.nodes = append(c.proto.nodes, node)
+	return len(c.proto.code) - 1
+}
+
+// set the jump target of instruction to the next instruction
+func (c *compiler) patch(pos int) {
+	c.proto.code[pos].a = len(c.proto.code)
+}
+
+// return the slot of variable, allocate a new one if not exists
+func (c *compiler) slot(name string) int {
+	if idx, ok := c.proto.index[name]; ok {
+		return idx
+	}
+	c.proto.names = append(c.proto.names, name)
+	c.proto.index[name] = len(c.proto.names) - 1
+	return len(c.proto.names) - 1
+}
+
+// allocate a hidden slot
+func (c *compiler) hidden() int {
+	c.proto.names = append(c.proto.names, "")
+	return len(c.proto.names) - 1
+}
+
+func (c *compiler) constant(val interface{}) int {
+	c.bc.consts = append(c.bc.consts, val)
+	return len(c.bc.consts) - 1
+}
+
+// compile expression, push its value
+// the step is counted per node as the tree-walking evaluator
+func (c *compiler) expr(node AstNode) {
+	c.emit(opStep, 0, 0, "", node)
+
+	switch node := node.(type) {
+	case *NodeNumber:
+		c.emit(opConst, c.constant(node.Value), 0, "", node)
+
+	case *NodeString:
+		c.emit(opConst, c.constant(node.Value), 0, "", node)
+
+	case *NodeBool:
+		c.emit(opConst, c.constant(node.Value), 0, "", node)
+
+	case *NodeVariable:
+		c.emit(opLoad, c.slot(node.Value), 0, "", node)
+
+	case *NodeAssignOp:
+		c.expr(node.Expr)
+		c.emit(opAssign, c.slot(node.Var.Value), 0, node.Op, node)
+
+	case *NodeUnaryOp:
+		c.expr(node.Right)
+		c.emit(opUnary, 0, 0, node.Op, node)
+
+	case *NodeBinaryOp:
+		c.expr(node.Left)
+		c.expr(node.Right)
+		c.emit(opBinary, 0, 0, node.Op, node)
+
+	case *NodeList:
+		for _, v := range node.List {
+			c.expr(v)
+		}
+		c.emit(opList, len(node.List), 0, "", node)
+
+	case *NodeMap:
+		for k, v := range node.Map {
+			c.expr(k)
+			c.expr(v)
+		}
+		c.emit(opMap, len(node.Map), 0, "", node)
+
+	case *NodeVarIndex:
+		c.expr(node.Var)
+		jmp := c.emit(opIndexable, 0, 0, "", node)
+		c.expr(node.Index)
+		c.emit(opIndex, 0, 0, "", node)
+		c.patch(jmp)
+
+	case *NodeFuncCallOp:
+		c.call(node)
+
+	case *NodeFuncDef:
+		c.funcDef(node)
+		c.emit(opNil, 0, 0, "", node)
+
+	case *NodeIf:
+		c.ifStmt(node)
+
+	case *NodeWhile:
+		c.whileStmt(node)
+
+	case *NodeReturn, *NodeBreak, *NodeContinue:
+		// evaluated as nil out of the statements
+		c.emit(opNil, 0, 0, "", node)
+
+	default:
+		panic(errBytecodeUnsupported)
+	}
+}
+
+// compile function call
+func (c *compiler) call(node *NodeFuncCallOp) {
+	name := "_custom_func_" + node.Name.Value
+	site := callSite{node: node, name: node.Name.Value, local: -1, global: -1}
+	if c.global == nil {
+		site.global = c.slot(name)
+	} else {
+		site.local = c.slot(name)
+		site.global = c.global.slot(name)
+	}
+	c.bc.calls = append(c.bc.calls, site)
+	idx := len(c.bc.calls) - 1
+
+	// the builtin function evaluates the params by itself
+	pos := c.emit(opCall, idx, 0, "", node)
+	for _, p := range node.Params {
+		c.expr(p)
+	}
+	c.emit(opCallCustom, idx, 0, "", node)
+	c.proto.code[pos].b = len(c.proto.code)
+}
+
+// compile function define
+func (c *compiler) funcDef(node *NodeFuncDef) {
+	c.bc.defs = append(c.bc.defs, node)
+	c.emit(opDefFunc, c.slot("_custom_func_"+node.Name.Value), len(c.bc.defs)-1, "", node)
+
+	if _, ok := c.bc.funcs[node]; ok {
+		return
+	}
+
+	global := c.global
+	if global == nil {
+		global = c
+	}
+	fc := &compiler{bc: c.bc, proto: newProto(node.Name.Value, node), global: global}
+	c.bc.funcs[node] = fc.proto
+
+	// params are the first slots
+	for _, p := range node.Params {
+		fc.slot(p.Name.Value)
+	}
+
+	fc.stmts(node.Body, true)
+	fc.emit(opReturn, 0, 0, "", node)
+}
+
+// compile statements, push the value of the last statement
+// `isf` means the function body, break/continue have no effect
+func (c *compiler) stmts(nodes []AstNode, isf bool) {
+	if len(nodes) == 0 {
+		c.emit(opNil, 0, 0, "", nil)
+		return
+	}
+
+	for idx, node := range nodes {
+		if idx > 0 {
+			c.emit(opPop, 0, 0, "", node)
+		}
+
+		switch node := node.(type) {
+		case *NodeReturn:
+			c.emit(opStep, 0, 0, "", node)
+			for _, v := range node.Tuples {
+				c.expr(v)
+			}
+			if c.global == nil {
+				c.emit(opExit, len(node.Tuples), 0, "", node)
+			} else {
+				c.emit(opReturnTuple, len(node.Tuples), 0, "", node)
+			}
+
+		case *NodeBreak, *NodeContinue:
+			c.emit(opStep, 0, 0, "", node)
+			c.jump(node, isf)
+
+		default:
+			c.expr(node)
+		}
+	}
+}
+
+// compile break/continue
+func (c *compiler) jump(node AstNode, isf bool) {
+	_, isBreak := node.(*NodeBreak)
+
+	switch {
+	case isf:
+		c.emit(opNil, 0, 0, "", node)
+		return
+
+	case len(c.loops) > 0:
+		lp := c.loops[len(c.loops)-1]
+		c.emit(opNil, 0, 0, "", node)
+		c.emit(opStore, lp.result, 0, "", node)
+		if isBreak {
+			lp.breaks = append(lp.breaks, c.emit(opJump, 0, 0, "", node))
+		} else {
+			c.emit(opJump, lp.start, 0, "", node)
+		}
+
+	case c.global == nil:
+		// out of loop, it ends the program
+		c.emit(opExit, 0, 0, "", node)
+
+	default:
+		// out of loop, it ends the function
+		c.emit(opNil, 0, 0, "", node)
+		c.emit(opReturn, 0, 0, "", node)
+	}
+
+	// unreachable, keep the stack balanced
+	c.emit(opNil, 0, 0, "", node)
+}
+
+// compile if statement, push the value of executed branch
+func (c *compiler) ifStmt(node *NodeIf) {
+	if node.Expr == nil {
+		c.emit(opNil, 0, 0, "", node)
+		return
+	}
+
+	c.expr(node.Expr)
+	jmpElse := c.emit(opJumpIfFalse, 0, 0, "", node)
+	c.stmts(node.Body, false)
+	jmpEnd := c.emit(opJump, 0, 0, "", node)
+	c.patch(jmpElse)
+	if node.ElseIf != nil {
+		c.ifStmt(node.ElseIf)
+	} else {
+		c.stmts(node.Else, false)
+	}
+	c.patch(jmpEnd)
+}
+
+// compile while statement, push the value of the last iteration
+func (c *compiler) whileStmt(node *NodeWhile) {
+	if node.Expr == nil {
+		c.emit(opNil, 0, 0, "", node)
+		return
+	}
+
+	lp := &loop{result: c.hidden()}
+	c.emit(opNil, 0, 0, "", node)
+	c.emit(opStore, lp.result, 0, "", node)
+
+	lp.start = len(c.proto.code)
+	c.expr(node.Expr)
+	jmpEnd := c.emit(opJumpIfFalse, 0, 0, "", node)
+	c.emit(opLoop, 0, 0, "", node)
+
+	c.loops = append(c.loops, lp)
+	c.stmts(node.Body, false)
+	c.loops = c.loops[:len(c.loops)-1]
+
+	c.emit(opStore, lp.result, 0, "", node)
+	c.emit(opJump, lp.start, 0, "", node)
+
+	c.patch(jmpEnd)
+	for _, pos := range lp.breaks {
+		c.patch(pos)
+	}
+	c.emit(opLoad, lp.result, 0, "", node)
+}
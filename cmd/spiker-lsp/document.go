@@ -0,0 +1,223 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shockerli/spiker"
+)
+
+// document the opened text document, and its parsed result
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []int // the offsets of line starts
+
+	ast    []spiker.AstNode    // the statements which can be parsed
+	errs   spiker.SyntaxErrors // the syntax errors
+	tokens []spiker.TokenInfo  // the tokens, include the invalid tokens
+	global *scope              // the global scope of script
+	scopes map[spiker.AstNode]*scope
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version}
+	d.setText(text)
+	return d
+}
+
+// update the text and parse it again
+func (d *document) setText(text string) {
+	d.text = text
+	d.lines = []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	ast, err := spiker.ParseAstRecover(text)
+	d.ast, d.errs = ast, nil
+	if errs, ok := err.(spiker.SyntaxErrors); ok {
+		d.errs = errs
+	}
+	d.tokens, _ = spiker.TokenizeRecover(text)
+
+	d.scopes = make(map[spiker.AstNode]*scope)
+	d.global = d.newScope(nil, d.ast)
+}
+
+// apply the change of text, the whole text is replaced if the range is nil
+func (d *document) apply(change textDocumentContentChangeEvent) {
+	if change.Range == nil {
+		d.setText(change.Text)
+		return
+	}
+	start, end := d.offset(change.Range.Start), d.offset(change.Range.End)
+	if end < start {
+		start, end = end, start
+	}
+	d.setText(d.text[:start] + change.Text + d.text[end:])
+}
+
+// return the LSP position of byte offset
+func (d *document) position(offset int) position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := sort.SearchInts(d.lines, offset+1) - 1
+	return position{Line: line, Character: utf16Len(d.text[d.lines[line]:offset])}
+}
+
+// return the byte offset of LSP position, clamped to the line
+func (d *document) offset(pos position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+
+	start, end := d.lines[pos.Line], len(d.text)
+	if pos.Line+1 < len(d.lines) {
+		end = d.lines[pos.Line+1] - 1
+	}
+	offset, n := start, 0
+	for offset < end && n < pos.Character {
+		r, size := utf8.DecodeRuneInString(d.text[offset:end])
+		offset += size
+		n += utf16RuneLen(r)
+	}
+	return offset
+}
+
+// return the LSP range of node
+func (d *document) nodeRange(node spiker.AstNode) lspRange {
+	return lspRange{Start: d.position(node.Pos().Offset), End: d.position(node.End().Offset)}
+}
+
+// return the LSP range of the whole text
+func (d *document) fullRange() lspRange {
+	return lspRange{End: d.position(len(d.text))}
+}
+
+// return the range of syntax error, which is the token at the position
+func (d *document) errorRange(se *spiker.SyntaxError) lspRange {
+	start := se.Offset
+	if start > len(d.text) {
+		start = len(d.text)
+	}
+	end := start
+	for _, t := range d.tokens {
+		if t.Pos.Offset == start {
+			end = t.End.Offset
+			break
+		}
+	}
+	// one character at least, if not at the end of line
+	if end == start && end < len(d.text) && d.text[end] != '\n' {
+		_, size := utf8.DecodeRuneInString(d.text[end:])
+		end += size
+	}
+	return lspRange{Start: d.position(start), End: d.position(end)}
+}
+
+// return the identifier at the byte offset, the end of identifier is included
+func (d *document) identAt(offset int) (spiker.TokenInfo, bool) {
+	for _, t := range d.tokens {
+		if t.Kind == spiker.TokenIdent && t.Pos.Offset <= offset && offset <= t.End.Offset {
+			return t, true
+		}
+	}
+	return spiker.TokenInfo{}, false
+}
+
+// scope the global scope or the body of function
+type scope struct {
+	fnd   *spiker.NodeFuncDef    // nil for global scope
+	vars  []*spiker.NodeAssignOp // the assignments, in source order
+	funcs []*spiker.NodeFuncDef  // the functions defined in body, in source order
+}
+
+// collect the assignments and functions of body, not include the nested functions
+func (d *document) newScope(fnd *spiker.NodeFuncDef, body []spiker.AstNode) *scope {
+	s := &scope{fnd: fnd}
+	if fnd != nil {
+		d.scopes[fnd] = s
+	}
+
+	for _, stmt := range body {
+		spiker.Inspect(stmt, func(node spiker.AstNode) bool {
+			switch n := node.(type) {
+			case *spiker.NodeAssignOp:
+				s.vars = append(s.vars, n)
+			case *spiker.NodeFuncDef:
+				s.funcs = append(s.funcs, n)
+				d.newScope(n, n.Body)
+				return false
+			}
+			return true
+		})
+	}
+
+	return s
+}
+
+// return the innermost scope contains the byte offset
+func (d *document) scopeAt(offset int) *scope {
+	s := d.global
+	for {
+		var inner *scope
+		for _, fnd := range s.funcs {
+			if fnd.Pos().Offset <= offset && offset <= fnd.End().Offset {
+				inner = d.scopes[fnd]
+			}
+		}
+		if inner == nil {
+			return s
+		}
+		s = inner
+	}
+}
+
+// return the functions named in scope, fallback to the global scope like the evaluator
+func (d *document) lookupFunc(s *scope, name string) (defs []*spiker.NodeFuncDef) {
+	for _, fnd := range s.funcs {
+		if fnd.Name.Value == name {
+			defs = append(defs, fnd)
+		}
+	}
+	if len(defs) == 0 && s != d.global {
+		return d.lookupFunc(d.global, name)
+	}
+	return
+}
+
+// return the signature of function, such as "sum = (a, b) ->"
+func signature(fnd *spiker.NodeFuncDef) string {
+	var ps []string
+	for _, p := range fnd.Params {
+		ps = append(ps, p.Format())
+	}
+	return fnd.Name.Value + " = (" + strings.Join(ps, ", ") + ") ->"
+}
+
+// return the length of string in UTF-16 code units
+func utf16Len(s string) (n int) {
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
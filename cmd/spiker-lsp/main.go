@@ -0,0 +1,22 @@
+// Command spiker-lsp is the language server of spiker scripts, speaks LSP over stdio.
+//
+// It provides the diagnostics, formatting, hover on builtin functions, go to definition
+// of script functions, document symbols and completion.
+// The variables and functions provided by the host can be set by the initialization options:
+//
+//	{"variables": ["price", "count"], "functions": ["round"]}
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shockerli/spiker"
+)
+
+func main() {
+	if err := newServer(spiker.Default(), os.Stdin, os.Stdout).run(); err != nil {
+		fmt.Fprintln(os.Stderr, "spiker-lsp:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/shockerli/spiker"
+)
+
+// the documents of standard builtin functions
+var builtinDocs = map[string]string{
+	"export": "export(v)\n\nreturn the expression value and interrupt script",
+	"exist":  "exist(v)\n\ndetermines whether a variable or index exists",
+	"len":    "len(v)\n\nreturn the length of a value",
+	"del":    "del(a, b[i], ...)\n\ndelete one or more variable or index",
+	"print":  "print(v, ...)\n\nprint one or more expression value to the terminal",
+}
+
+// server the language server, serves one client
+type server struct {
+	engine *spiker.Engine
+	in     *bufio.Reader
+	out    io.Writer
+
+	opts        spiker.AnalyzeOptions
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+func newServer(engine *spiker.Engine, in io.Reader, out io.Writer) *server {
+	return &server{
+		engine: engine,
+		in:     bufio.NewReader(in),
+		out:    out,
+		docs:   make(map[string]*document),
+	}
+}
+
+// run serve the messages until the exit notification or the end of input,
+// return nil if exit after the shutdown request
+func (s *server) run() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err != nil {
+			if isEOF(err) {
+				return io.ErrUnexpectedEOF
+			}
+			if re, ok := err.(*responseError); ok {
+				if err = s.reply(nil, nil, re); err == nil {
+					continue
+				}
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.dispatch(msg)
+		if msg.ID == nil {
+			// notification has no response
+			continue
+		}
+		if err = s.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+// handle the request or notification
+func (s *server) dispatch(msg *message) (result interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = &responseError{Code: codeInternalError, Message: fmt.Sprint(e)}
+		}
+	}()
+
+	switch {
+	case msg.Method == "initialize":
+		return s.initialize(msg.Params)
+	case !s.initialized:
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	case s.shutdown:
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err = unmarshalParams(msg.Params, &params); err == nil {
+			item := params.TextDocument
+			s.docs[item.URI] = newDocument(item.URI, item.Version, item.Text)
+			err = s.publishDiagnostics(s.docs[item.URI])
+		}
+		return
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err = unmarshalParams(msg.Params, &params); err == nil {
+			doc, ok := s.docs[params.TextDocument.URI]
+			if !ok {
+				return
+			}
+			for _, change := range params.ContentChanges {
+				doc.apply(change)
+			}
+			doc.version = params.TextDocument.Version
+			err = s.publishDiagnostics(doc)
+		}
+		return
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err = unmarshalParams(msg.Params, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			// clear the diagnostics of closed document
+			err = s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []diagnostic{},
+			})
+		}
+		return
+	case "textDocument/formatting":
+		return s.formatting(msg.Params)
+	case "textDocument/hover":
+		return s.hover(msg.Params)
+	case "textDocument/definition":
+		return s.definition(msg.Params)
+	case "textDocument/documentSymbol":
+		return s.documentSymbol(msg.Params)
+	case "textDocument/completion":
+		return s.completion(msg.Params)
+	}
+
+	if strings.HasPrefix(msg.Method, "$/") || msg.ID == nil {
+		// the optional notification can be ignored
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func (s *server) initialize(raw json.RawMessage) (interface{}, error) {
+	var params initializeParams
+	if err := unmarshalParams(raw, &params); err != nil {
+		return nil, err
+	}
+	if opts := params.InitializationOptions; opts != nil {
+		s.opts = spiker.AnalyzeOptions{Variables: opts.Variables, Functions: opts.Functions}
+	}
+	s.initialized = true
+
+	return initializeResult{
+		Capabilities: serverCapabilities{
+			TextDocumentSync:           syncIncremental,
+			DocumentFormattingProvider: true,
+			HoverProvider:              true,
+			DefinitionProvider:         true,
+			DocumentSymbolProvider:     true,
+			CompletionProvider:         &completionOptions{},
+		},
+		ServerInfo: serverInfo{Name: "spiker-lsp"},
+	}, nil
+}
+
+// publish the syntax errors, and the problems of static analysis if no syntax error
+func (s *server) publishDiagnostics(doc *document) error {
+	diags := []diagnostic{}
+	for _, se := range doc.errs {
+		diags = append(diags, diagnostic{
+			Range:    doc.errorRange(se),
+			Severity: severityError,
+			Code:     "syntax-error",
+			Source:   "spiker",
+			Message:  se.Message,
+		})
+	}
+
+	// the broken statements are dropped, avoid the false positive of analysis
+	if len(doc.errs) == 0 {
+		for _, d := range s.engine.Analyze(doc.ast, s.opts) {
+			diag := diagnostic{
+				Range:    lspRange{Start: doc.position(d.Offset), End: doc.position(d.Offset)},
+				Severity: severityError,
+				Code:     string(d.Kind),
+				Source:   "spiker",
+				Message:  d.Message,
+			}
+			if d.Node != nil && d.Node.Pos().IsValid() && d.Node.End().IsValid() {
+				diag.Range = doc.nodeRange(d.Node)
+			}
+			switch d.Kind {
+			case spiker.DiagnosticUndefinedVariable:
+				// may be provided by the host
+				diag.Severity = severityWarning
+			case spiker.DiagnosticUnreachable, spiker.DiagnosticUnusedAssignment:
+				diag.Severity = severityHint
+				diag.Tags = []int{tagUnnecessary}
+			}
+			diags = append(diags, diag)
+		}
+	}
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: diags,
+	})
+}
+
+// format the whole document, no edit if it has syntax errors
+func (s *server) formatting(raw json.RawMessage) (interface{}, error) {
+	var params documentFormattingParams
+	if err := unmarshalParams(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []textEdit{}
+	// the code without statement is kept as it is
+	if len(doc.errs) > 0 || len(doc.ast) == 0 {
+		return edits, nil
+	}
+
+	opts := spiker.FormatOptions{}
+	if params.Options.TabSize > 0 {
+		opts.Indent = strings.Repeat(" ", params.Options.TabSize)
+		if !params.Options.InsertSpaces {
+			opts.Indent = "\t"
+		}
+	}
+	f, err := spiker.FormatAstWithOptions(doc.ast, opts)
+	if err != nil {
+		return nil, &responseError{Code: codeInternalError, Message: err.Error()}
+	}
+
+	if f += "\n"; f != doc.text {
+		edits = append(edits, textEdit{Range: doc.fullRange(), NewText: f})
+	}
+	return edits, nil
+}
+
+// show the document of builtin function, or the signature of script function
+func (s *server) hover(raw json.RawMessage) (interface{}, error) {
+	doc, offset, err := s.position(raw)
+	if err != nil {
+		return nil, err
+	}
+	ident, ok := doc.identAt(offset)
+	if !ok {
+		return nil, nil
+	}
+
+	var text string
+	if defs := doc.lookupFunc(doc.scopeAt(offset), ident.Text); len(defs) > 0 {
+		text = "```spiker\n" + signature(defs[0]) + "\n```"
+	} else if s.isBuiltin(ident.Text) {
+		text = "builtin function `" + ident.Text + "`"
+		if d, ok := builtinDocs[ident.Text]; ok {
+			lines := strings.SplitN(d, "\n", 2)
+			text = "```spiker\n" + lines[0] + "\n```\n" + lines[1]
+		}
+	} else {
+		return nil, nil
+	}
+
+	r := lspRange{Start: doc.position(ident.Pos.Offset), End: doc.position(ident.End.Offset)}
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: &r}, nil
+}
+
+// return the definitions of script function
+func (s *server) definition(raw json.RawMessage) (interface{}, error) {
+	doc, offset, err := s.position(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	locs := []location{}
+	if ident, ok := doc.identAt(offset); ok {
+		for _, fnd := range doc.lookupFunc(doc.scopeAt(offset), ident.Text) {
+			locs = append(locs, location{URI: doc.uri, Range: doc.nodeRange(&fnd.Name)})
+		}
+	}
+	return locs, nil
+}
+
+// return the functions and variables, the local ones are the children of function
+func (s *server) documentSymbol(raw json.RawMessage) (interface{}, error) {
+	var params documentSymbolParams
+	if err := unmarshalParams(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.symbols(doc, doc.global), nil
+}
+
+func (s *server) symbols(doc *document, sc *scope) []documentSymbol {
+	syms := []documentSymbol{}
+	seen := map[string]bool{}
+	for _, as := range sc.vars {
+		// the first assignment is the declaration
+		if seen[as.Var.Value] {
+			continue
+		}
+		seen[as.Var.Value] = true
+		syms = append(syms, documentSymbol{
+			Name:           as.Var.Value,
+			Kind:           symbolVariable,
+			Range:          doc.nodeRange(as),
+			SelectionRange: doc.nodeRange(&as.Var),
+		})
+	}
+	for _, fnd := range sc.funcs {
+		syms = append(syms, documentSymbol{
+			Name:           fnd.Name.Value,
+			Detail:         signature(fnd),
+			Kind:           symbolFunction,
+			Range:          doc.nodeRange(fnd),
+			SelectionRange: doc.nodeRange(&fnd.Name),
+			Children:       s.symbols(doc, doc.scopes[fnd]),
+		})
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		a, b := syms[i].Range.Start, syms[j].Range.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+	return syms
+}
+
+// return the variables and functions visible at the position, and the builtin functions
+func (s *server) completion(raw json.RawMessage) (interface{}, error) {
+	doc, offset, err := s.position(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []completionItem{}
+	seen := map[string]bool{}
+	add := func(name string, kind int, detail string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		items = append(items, completionItem{Label: name, Kind: kind, Detail: detail})
+	}
+
+	// the function body can't see the variables of global scope
+	sc := doc.scopeAt(offset)
+	if sc.fnd != nil {
+		for _, p := range sc.fnd.Params {
+			add(p.Name.Value, completionVariable, "parameter")
+		}
+	}
+	for _, as := range sc.vars {
+		add(as.Var.Value, completionVariable, "variable")
+	}
+	if sc == doc.global {
+		for _, name := range s.opts.Variables {
+			add(name, completionVariable, "variable")
+		}
+	}
+
+	for _, fnd := range sc.funcs {
+		add(fnd.Name.Value, completionFunction, signature(fnd))
+	}
+	for _, fnd := range doc.global.funcs {
+		add(fnd.Name.Value, completionFunction, signature(fnd))
+	}
+	for _, name := range s.opts.Functions {
+		add(name, completionFunction, "function")
+	}
+	for _, name := range s.engine.Funcs() {
+		add(name, completionFunction, "builtin function")
+	}
+
+	return items, nil
+}
+
+// whether the function is provided by the engine or host
+func (s *server) isBuiltin(name string) bool {
+	for _, fn := range s.engine.Funcs() {
+		if fn == name {
+			return true
+		}
+	}
+	for _, fn := range s.opts.Functions {
+		if fn == name {
+			return true
+		}
+	}
+	return false
+}
+
+// return the opened document
+func (s *server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document not opened: " + uri}
+	}
+	return doc, nil
+}
+
+// return the document and byte offset of the text document position params
+func (s *server) position(raw json.RawMessage) (doc *document, offset int, err error) {
+	var params textDocumentPositionParams
+	if err = unmarshalParams(raw, &params); err != nil {
+		return
+	}
+	if doc, err = s.document(params.TextDocument.URI); err != nil {
+		return
+	}
+	return doc, doc.offset(params.Position), nil
+}
+
+// send the response of request
+func (s *server) reply(id *json.RawMessage, result interface{}, err error) error {
+	msg := &message{ID: id}
+	if id == nil {
+		// the id of request can't be read
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+
+	if err != nil {
+		re, ok := err.(*responseError)
+		if !ok {
+			re = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+		msg.Error = re
+		return writeMessage(s.out, msg)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	msg.Result = data
+	return writeMessage(s.out, msg)
+}
+
+// send the notification to client
+func (s *server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.out, &message{Method: method, Params: data})
+}
+
+func unmarshalParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shockerli/spiker"
+)
+
+const testURI = "file:///test.spk"
+
+// client the scripted JSON-RPC client of server
+type client struct {
+	t     *testing.T
+	w     *io.PipeWriter
+	msgs  chan *message
+	done  chan error
+	id    int
+	notes []*message // the received notifications
+}
+
+// start the server, and initialize it with options
+func newClient(t *testing.T, opts *initializationOptions) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, msgs: make(chan *message, 100), done: make(chan error, 1)}
+
+	go func() {
+		err := newServer(spiker.New(), inR, outW).run()
+		_ = outW.Close()
+		c.done <- err
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			msg, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+
+	c.call("initialize", initializeParams{InitializationOptions: opts}, nil)
+	c.notify("initialized", struct{}{})
+	return c
+}
+
+// send the request and wait for the response, return the error of response
+func (c *client) call(method string, params, result interface{}) *responseError {
+	c.t.Helper()
+	c.id++
+	id := mustMarshal(c.t, c.id)
+	c.write(&message{ID: &id, Method: method, Params: mustMarshal(c.t, params)})
+
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notes = append(c.notes, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("%s: unexpected response id %s", method, *msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("%s: invalid result %s: %v", method, msg.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+// send the notification
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.write(&message{Method: method, Params: mustMarshal(c.t, params)})
+}
+
+// wait for the next diagnostics
+func (c *client) diagnostics() publishDiagnosticsParams {
+	c.t.Helper()
+	for {
+		var msg *message
+		if len(c.notes) > 0 {
+			msg, c.notes = c.notes[0], c.notes[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			c.t.Fatalf("invalid diagnostics %s: %v", msg.Params, err)
+		}
+		return params
+	}
+}
+
+// open the document, and return its diagnostics
+func (c *client) open(text string) publishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", didOpenTextDocumentParams{
+		TextDocument: textDocumentItem{URI: testURI, LanguageID: "spiker", Version: 1, Text: text},
+	})
+	return c.diagnostics()
+}
+
+// shutdown and exit the server, return the error of server
+func (c *client) exit() error {
+	c.t.Helper()
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown error = %v", err)
+	}
+	c.notify("exit", nil)
+	return c.wait()
+}
+
+func (c *client) wait() error {
+	c.t.Helper()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("server is not stopped")
+	}
+	return nil
+}
+
+func (c *client) write(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.w, msg); err != nil {
+		c.t.Fatalf("write message error = %v", err)
+	}
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("server is closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no message from server")
+	}
+	return nil
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// return the position of the line and character
+func pos(line, char int) position {
+	return position{Line: line, Character: char}
+}
+
+func rng(line1, char1, line2, char2 int) lspRange {
+	return lspRange{Start: pos(line1, char1), End: pos(line2, char2)}
+}
+
+func at(p position) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: testURI}, Position: p}
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- newServer(spiker.New(), inR, outW).run()
+	}()
+	r := bufio.NewReader(outR)
+
+	// the request before initialize
+	id := json.RawMessage("1")
+	_ = writeMessage(inW, &message{ID: &id, Method: "textDocument/hover", Params: json.RawMessage("{}")})
+	msg, err := readMessage(r)
+	if err != nil || msg.Error == nil || msg.Error.Code != codeServerNotInitialized {
+		t.Errorf("request before initialize = %+v, %v", msg, err)
+	}
+
+	// exit without shutdown
+	_ = writeMessage(inW, &message{Method: "exit"})
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("exit without shutdown should return error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server is not stopped")
+	}
+
+	c := newClient(t, nil)
+	if err := c.call("workspace/symbol", struct{}{}, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("unknown method error = %v", err)
+	}
+	c.notify("$/cancelRequest", map[string]int{"id": 1})
+	if err := c.exit(); err != nil {
+		t.Errorf("exit error = %v", err)
+	}
+}
+
+func TestServer_Initialize(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		_ = newServer(spiker.New(), inR, outW).run()
+	}()
+
+	id := json.RawMessage("1")
+	_ = writeMessage(inW, &message{ID: &id, Method: "initialize", Params: json.RawMessage("{}")})
+	msg, err := readMessage(bufio.NewReader(outR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res initializeResult
+	if err := json.Unmarshal(msg.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	want := serverCapabilities{
+		TextDocumentSync:           syncIncremental,
+		DocumentFormattingProvider: true,
+		HoverProvider:              true,
+		DefinitionProvider:         true,
+		DocumentSymbolProvider:     true,
+		CompletionProvider:         &completionOptions{},
+	}
+	if !reflect.DeepEqual(res.Capabilities, want) || res.ServerInfo.Name != "spiker-lsp" {
+		t.Errorf("initialize() = %+v", res)
+	}
+	_ = inW.Close()
+}
+
+func TestServer_Diagnostics(t *testing.T) {
+	tests := []struct {
+		code string
+		want []diagnostic
+	}{
+		{
+			code: "a = 1;\nb = a + 2;\n",
+			want: []diagnostic{},
+		},
+		{
+			code: "a = (1 + 2;\n",
+			want: []diagnostic{
+				{Range: rng(0, 10, 0, 11), Severity: severityError, Code: "syntax-error", Source: "spiker", Message: `expected ")", but got ";"`},
+			},
+		},
+		{
+			code: "total = price * cuont;\n",
+			want: []diagnostic{
+				{Range: rng(0, 16, 0, 21), Severity: severityWarning, Code: "undefined-variable", Source: "spiker", Message: "undefined variable cuont"},
+			},
+		},
+		{
+			code: "sum = (a, b) -> a + b;\nsum(1) + round(2);\n",
+			want: []diagnostic{
+				{Range: rng(1, 0, 1, 3), Severity: severityError, Code: "argument-count", Source: "spiker", Message: "sum() expects 2 parameters, 1 given"},
+				{Range: rng(1, 9, 1, 14), Severity: severityError, Code: "undefined-function", Source: "spiker", Message: "undefined function round()"},
+			},
+		},
+		{
+			code: "f = x -> {\n    return x;\n    x = 1;\n};\n",
+			want: []diagnostic{
+				{Range: rng(2, 4, 2, 9), Severity: severityHint, Code: "unreachable", Source: "spiker", Message: "unreachable code", Tags: []int{tagUnnecessary}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t, &initializationOptions{Variables: []string{"price"}})
+		got := c.open(tt.code)
+		if got.URI != testURI || got.Version != 1 || !reflect.DeepEqual(got.Diagnostics, tt.want) {
+			t.Errorf("diagnostics of %q = %+v, want %+v", tt.code, got.Diagnostics, tt.want)
+		}
+		_ = c.exit()
+	}
+}
+
+func TestServer_DidChange(t *testing.T) {
+	c := newClient(t, nil)
+	if got := c.open("a = 1;\nb = a;\n"); len(got.Diagnostics) != 0 {
+		t.Fatalf("diagnostics = %+v", got.Diagnostics)
+	}
+
+	// the incremental change
+	c.notify("textDocument/didChange", didChangeTextDocumentParams{
+		TextDocument: versionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []textDocumentContentChangeEvent{
+			{Range: &lspRange{Start: pos(1, 4), End: pos(1, 5)}, Text: "😀 + c"},
+		},
+	})
+	got := c.diagnostics()
+	if got.Version != 2 || len(got.Diagnostics) != 1 || got.Diagnostics[0].Range != rng(1, 4, 1, 6) {
+		t.Errorf("diagnostics after change = %+v", got)
+	}
+
+	// the whole text
+	c.notify("textDocument/didChange", didChangeTextDocumentParams{
+		TextDocument:   versionedTextDocumentIdentifier{URI: testURI, Version: 3},
+		ContentChanges: []textDocumentContentChangeEvent{{Text: "c = 1;"}},
+	})
+	if got := c.diagnostics(); got.Version != 3 || len(got.Diagnostics) != 0 {
+		t.Errorf("diagnostics after change = %+v", got)
+	}
+
+	c.notify("textDocument/didClose", didCloseTextDocumentParams{TextDocument: textDocumentIdentifier{URI: testURI}})
+	if got := c.diagnostics(); got.URI != testURI || len(got.Diagnostics) != 0 {
+		t.Errorf("diagnostics after close = %+v", got)
+	}
+	if err := c.call("textDocument/hover", at(pos(0, 0)), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("hover on closed document error = %v", err)
+	}
+	_ = c.exit()
+}
+
+func TestServer_Formatting(t *testing.T) {
+	tests := []struct {
+		code string
+		opts formattingOptions
+		want []textEdit
+	}{
+		{
+			code: "a=1;\nif(a>0){b=a;} # note\n",
+			want: []textEdit{{Range: rng(0, 0, 2, 0), NewText: "a = 1;\nif (a > 0) {\n    b = a;\n} # note\n"}},
+		},
+		{
+			code: "f=x->{return x;};",
+			opts: formattingOptions{TabSize: 2, InsertSpaces: true},
+			want: []textEdit{{Range: rng(0, 0, 0, 17), NewText: "f = x -> {\n  return x;\n};\n"}},
+		},
+		{
+			code: "f=x->{return x;};",
+			opts: formattingOptions{TabSize: 4},
+			want: []textEdit{{Range: rng(0, 0, 0, 17), NewText: "f = x -> {\n\treturn x;\n};\n"}},
+		},
+		{code: "a = 1;\n", want: []textEdit{}},    // formatted
+		{code: "a = (1;\n", want: []textEdit{}},   // syntax error
+		{code: "# comment\n", want: []textEdit{}}, // no statement
+	}
+
+	for _, tt := range tests {
+		c := newClient(t, nil)
+		c.open(tt.code)
+
+		var got []textEdit
+		params := documentFormattingParams{TextDocument: textDocumentIdentifier{URI: testURI}, Options: tt.opts}
+		if err := c.call("textDocument/formatting", params, &got); err != nil {
+			t.Fatalf("formatting error = %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("formatting %q = %+v, want %+v", tt.code, got, tt.want)
+		}
+		_ = c.exit()
+	}
+}
+
+const navigationCode = `rate = 0.5;
+sum = (a, b) -> a + b;
+total = (items) -> {
+    double = x -> x * 2;
+    n = len(items);
+    return double(sum(n, rate));
+};
+export(total([1, 2]));
+`
+
+func TestServer_Hover(t *testing.T) {
+	tests := []struct {
+		pos  position
+		want *hover
+	}{
+		{pos(4, 9), &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```spiker\nlen(v)\n```\n\nreturn the length of a value"},
+			Range:    &lspRange{Start: pos(4, 8), End: pos(4, 11)},
+		}},
+		{pos(7, 0), &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```spiker\nexport(v)\n```\n\nreturn the expression value and interrupt script"},
+			Range:    &lspRange{Start: pos(7, 0), End: pos(7, 6)},
+		}},
+		{pos(5, 21), &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```spiker\nsum = (a, b) ->\n```"},
+			Range:    &lspRange{Start: pos(5, 18), End: pos(5, 21)},
+		}},
+		{pos(7, 7), &hover{
+			Contents: markupContent{Kind: "markdown", Value: "```spiker\ntotal = (items) ->\n```"},
+			Range:    &lspRange{Start: pos(7, 7), End: pos(7, 12)},
+		}},
+		{pos(0, 2), nil},  // variable
+		{pos(0, 7), nil},  // number
+		{pos(9, 0), nil},  // out of text
+		{pos(1, 20), nil}, // parameter
+	}
+
+	c := newClient(t, nil)
+	c.open(navigationCode)
+	for _, tt := range tests {
+		var got *hover
+		if err := c.call("textDocument/hover", at(tt.pos), &got); err != nil {
+			t.Fatalf("hover error = %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hover at %v = %+v, want %+v", tt.pos, got, tt.want)
+		}
+	}
+	_ = c.exit()
+}
+
+func TestServer_HoverHostFunction(t *testing.T) {
+	c := newClient(t, &initializationOptions{Functions: []string{"round"}})
+	c.open("round(1.5);")
+
+	var got *hover
+	if err := c.call("textDocument/hover", at(pos(0, 2)), &got); err != nil {
+		t.Fatalf("hover error = %v", err)
+	}
+	if got == nil || got.Contents.Value != "builtin function `round`" {
+		t.Errorf("hover = %+v", got)
+	}
+	_ = c.exit()
+}
+
+func TestServer_Definition(t *testing.T) {
+	tests := []struct {
+		pos  position
+		want []location
+	}{
+		{pos(5, 12), []location{{URI: testURI, Range: rng(3, 4, 3, 10)}}}, // local function
+		{pos(5, 19), []location{{URI: testURI, Range: rng(1, 0, 1, 3)}}},  // global function in body
+		{pos(7, 9), []location{{URI: testURI, Range: rng(2, 0, 2, 5)}}},
+		{pos(1, 1), []location{{URI: testURI, Range: rng(1, 0, 1, 3)}}}, // itself
+		{pos(4, 9), []location{}}, // builtin function
+		{pos(7, 0), []location{}}, // builtin function
+		{pos(0, 0), []location{}}, // variable
+	}
+
+	c := newClient(t, nil)
+	c.open(navigationCode)
+	for _, tt := range tests {
+		var got []location
+		if err := c.call("textDocument/definition", at(tt.pos), &got); err != nil {
+			t.Fatalf("definition error = %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("definition at %v = %+v, want %+v", tt.pos, got, tt.want)
+		}
+	}
+
+	// the local function is invisible in global scope
+	c.notify("textDocument/didChange", didChangeTextDocumentParams{
+		TextDocument:   versionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []textDocumentContentChangeEvent{{Text: navigationCode + "double(1);\n"}},
+	})
+	var got []location
+	if err := c.call("textDocument/definition", at(pos(8, 1)), &got); err != nil || len(got) != 0 {
+		t.Errorf("definition = %+v, %v", got, err)
+	}
+	_ = c.exit()
+}
+
+func TestServer_DocumentSymbol(t *testing.T) {
+	want := []documentSymbol{
+		{Name: "rate", Kind: symbolVariable, Range: rng(0, 0, 0, 10), SelectionRange: rng(0, 0, 0, 4)},
+		{Name: "sum", Detail: "sum = (a, b) ->", Kind: symbolFunction, Range: rng(1, 0, 1, 21), SelectionRange: rng(1, 0, 1, 3)},
+		{Name: "total", Detail: "total = (items) ->", Kind: symbolFunction, Range: rng(2, 0, 6, 1), SelectionRange: rng(2, 0, 2, 5),
+			Children: []documentSymbol{
+				{Name: "double", Detail: "double = (x) ->", Kind: symbolFunction, Range: rng(3, 4, 3, 23), SelectionRange: rng(3, 4, 3, 10)},
+				{Name: "n", Kind: symbolVariable, Range: rng(4, 4, 4, 18), SelectionRange: rng(4, 4, 4, 5)},
+			},
+		},
+	}
+
+	c := newClient(t, nil)
+	c.open(navigationCode)
+	var got []documentSymbol
+	if err := c.call("textDocument/documentSymbol", documentSymbolParams{TextDocument: textDocumentIdentifier{URI: testURI}}, &got); err != nil {
+		t.Fatalf("documentSymbol error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("documentSymbol = %+v, want %+v", got, want)
+	}
+	_ = c.exit()
+}
+
+func TestServer_Completion(t *testing.T) {
+	builtins := []completionItem{
+		{Label: "del", Kind: completionFunction, Detail: "builtin function"},
+		{Label: "exist", Kind: completionFunction, Detail: "builtin function"},
+		{Label: "export", Kind: completionFunction, Detail: "builtin function"},
+		{Label: "len", Kind: completionFunction, Detail: "builtin function"},
+		{Label: "print", Kind: completionFunction, Detail: "builtin function"},
+	}
+	tests := []struct {
+		pos  position
+		want []completionItem
+	}{
+		// global scope
+		{pos(7, 0), append([]completionItem{
+			{Label: "rate", Kind: completionVariable, Detail: "variable"},
+			{Label: "price", Kind: completionVariable, Detail: "variable"},
+			{Label: "sum", Kind: completionFunction, Detail: "sum = (a, b) ->"},
+			{Label: "total", Kind: completionFunction, Detail: "total = (items) ->"},
+			{Label: "round", Kind: completionFunction, Detail: "function"},
+		}, builtins...)},
+		// function body
+		{pos(5, 11), append([]completionItem{
+			{Label: "items", Kind: completionVariable, Detail: "parameter"},
+			{Label: "n", Kind: completionVariable, Detail: "variable"},
+			{Label: "double", Kind: completionFunction, Detail: "double = (x) ->"},
+			{Label: "sum", Kind: completionFunction, Detail: "sum = (a, b) ->"},
+			{Label: "total", Kind: completionFunction, Detail: "total = (items) ->"},
+			{Label: "round", Kind: completionFunction, Detail: "function"},
+		}, builtins...)},
+	}
+
+	c := newClient(t, &initializationOptions{Variables: []string{"price"}, Functions: []string{"round"}})
+	c.open(navigationCode)
+	for _, tt := range tests {
+		var got []completionItem
+		if err := c.call("textDocument/completion", at(tt.pos), &got); err != nil {
+			t.Fatalf("completion error = %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("completion at %v = %+v, want %+v", tt.pos, got, tt.want)
+		}
+	}
+	_ = c.exit()
+}
+
+func TestServer_CompletionBroken(t *testing.T) {
+	c := newClient(t, nil)
+	c.open("amount = 1;\nb = am\nc = 2;")
+
+	var got []completionItem
+	if err := c.call("textDocument/completion", at(pos(1, 6)), &got); err != nil {
+		t.Fatalf("completion error = %v", err)
+	}
+	if len(got) == 0 || got[0].Label != "amount" {
+		t.Errorf("completion = %+v", got)
+	}
+	_ = c.exit()
+}
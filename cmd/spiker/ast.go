@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shockerli/spiker"
+)
+
+// print the syntax tree, one node per line with its source span
+func printAst(w io.Writer, nodes []spiker.AstNode) {
+	p := &astPrinter{w: w}
+	for _, node := range nodes {
+		spiker.Walk(node, p)
+	}
+}
+
+// astPrinter the visitor prints the node indented by depth
+type astPrinter struct {
+	w     io.Writer
+	depth int
+}
+
+func (p *astPrinter) Visit(node spiker.AstNode) spiker.Visitor {
+	if node == nil {
+		p.depth--
+		return nil
+	}
+
+	line := strings.Repeat("  ", p.depth) + strings.TrimPrefix(fmt.Sprintf("%T", node), "*spiker.Node")
+	if detail := nodeDetail(node); detail != "" {
+		line += " " + detail
+	}
+	fmt.Fprintf(p.w, "%s %s-%s\n", line, node.Pos(), node.End())
+
+	p.depth++
+	return p
+}
+
+// return the value or operator of node
+func nodeDetail(node spiker.AstNode) string {
+	switch n := node.(type) {
+	case *spiker.NodeVariable, *spiker.NodeNumber, *spiker.NodeString, *spiker.NodeBool:
+		return n.Format()
+	case *spiker.NodeBinaryOp:
+		return string(n.Op)
+	case *spiker.NodeUnaryOp:
+		return string(n.Op)
+	case *spiker.NodeAssignOp:
+		return string(n.Op)
+	case *spiker.NodeVarIndex:
+		if n.Member {
+			return "."
+		}
+	}
+	return ""
+}
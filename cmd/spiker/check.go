@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/shockerli/spiker"
+)
+
+// report the syntax errors of files, one error per line
+func cmdCheck(args []string, stderr io.Writer) int {
+	fs := newFlagSet("check", stderr)
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stderr, "usage: spiker check files...")
+		return 2
+	}
+
+	code := 0
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(stderr, "spiker:", err)
+			code = 1
+			continue
+		}
+
+		// report all errors, not only the first one of ParseAst
+		_, err = spiker.ParseAstRecover(string(src))
+		if errs, ok := err.(spiker.SyntaxErrors); ok {
+			for _, se := range errs {
+				fmt.Fprintf(stderr, "%s:%d:%d: %s\n", name, se.Line, se.Column, se.Message)
+			}
+			code = 1
+		}
+	}
+	return code
+}
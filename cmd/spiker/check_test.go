@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdCheck(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok.src":   "a = 1;\nf = x -> x * 2;\n",
+		"bad.src":  "a = ;",
+		"bad2.src": "b = (1;\nc = ];\nd = 1;\n",
+	})
+	defer os.RemoveAll(dir)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{file("ok.src")}, 0, ""},
+		{[]string{file("ok.src"), file("bad.src"), file("bad2.src")}, 1, file("bad.src") + ":1:5: unexpected \";\"\n" +
+			file("bad2.src") + ":1:7: expected \")\", but got \";\"\n" +
+			file("bad2.src") + ":2:5: unexpected \"]\"\n"},
+		{[]string{file("none.src")}, 1, "spiker: open " + file("none.src") + ": no such file or directory\n"},
+		{[]string{}, 2, "usage: spiker check files...\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"check"}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+		if code != tt.code || stdout.Len() != 0 || stderr.String() != tt.stderr {
+			t.Errorf("check %v = %d, %q\nwant %d, %q", tt.args, code, stderr.String(), tt.code, tt.stderr)
+		}
+	}
+}
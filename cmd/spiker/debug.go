@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shockerli/spiker"
+)
+
+const debugPrompt = "(debug) "
+
+const debugHelp = `The execution pauses before the first statement, and the statements on breakpoints.
+
+	step, s          step into the called function
+	next, n          step over the called function
+	out, o           step out of the current function
+	continue, c      run until the next breakpoint
+	quit, q          stop the execution
+	break [line]     set the breakpoint, or list the breakpoints
+	clear line       remove the breakpoint
+	print expr       evaluate the expression in the current scope
+	watch [expr]     add the watch expression, or list the watches
+	unwatch expr     remove the watch expression
+	vars             list the variables of the scope chain
+	stack            print the call stack
+	list             print the source around the current line
+	help             print this help
+`
+
+// execute the file with debugger, which is driven by the commands of stdin
+func cmdDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("debug", stderr)
+	varsFile := fs.String("vars", "", "the JSON `file` of object, whose fields are the variables of script")
+	breaks := fs.String("b", "", "the comma separated `lines` of breakpoints")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if len(files) != 1 || files[0] == "-" {
+		fmt.Fprintln(stderr, "usage: spiker debug [--vars vars.json] [-b lines] file")
+		return 2
+	}
+
+	var lines []int
+	for _, s := range strings.Split(*breaks, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		line, err := strconv.Atoi(s)
+		if err != nil || line < 1 {
+			fmt.Fprintf(stderr, "spiker: invalid breakpoint %q\n", s)
+			return 2
+		}
+		lines = append(lines, line)
+	}
+
+	scope := spiker.NewScopeTable("GLOBAL", 1, nil)
+	if *varsFile != "" {
+		vars, err := readVars(*varsFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "spiker: %s: %v\n", *varsFile, err)
+			return 2
+		}
+		for name, val := range vars {
+			scope.Set(name, val)
+		}
+	}
+
+	code, err := readFile(files[0], stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "spiker:", err)
+		return 1
+	}
+
+	d := &debugger{
+		in:     bufio.NewReader(stdin),
+		out:    stdout,
+		source: strings.Split(string(code), "\n"),
+	}
+	d.Debugger = spiker.NewDebugger(d.pause)
+	for _, line := range lines {
+		d.SetBreakpoint(line)
+	}
+	d.Pause()
+
+	val, err := d.Execute(string(code), scope)
+	if err == spiker.ErrDebugStopped {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "spiker: %s: %v\n", files[0], err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "finished:", spiker.FormatValue(val))
+	return 0
+}
+
+// debugger the terminal frontend of spiker.Debugger
+type debugger struct {
+	*spiker.Debugger
+	in     *bufio.Reader
+	out    io.Writer
+	source []string // the lines of source
+}
+
+// print the paused statement and watches, then run the commands until resumed.
+// The end of input stops the execution
+func (d *debugger) pause(state *spiker.DebugState) spiker.DebugAction {
+	where := ""
+	if f := state.Frames[0]; f.Func != "" {
+		where = " in " + f.Func + "()"
+	}
+	fmt.Fprintf(d.out, "line %d%s: %s\n", state.Pos.Line, where, strings.TrimSpace(d.line(state.Pos.Line)))
+	d.printWatches(state)
+
+	for {
+		fmt.Fprint(d.out, debugPrompt)
+		line, err := d.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(d.out)
+			return spiker.DebugStop
+		}
+
+		name, arg := strings.TrimSpace(line), ""
+		if idx := strings.IndexAny(name, " \t"); idx > 0 {
+			name, arg = name[:idx], strings.TrimSpace(name[idx+1:])
+		}
+
+		switch name {
+		case "":
+		case "step", "s":
+			return spiker.DebugStepInto
+		case "next", "n":
+			return spiker.DebugStepOver
+		case "out", "o":
+			return spiker.DebugStepOut
+		case "continue", "c":
+			return spiker.DebugContinue
+		case "quit", "q":
+			return spiker.DebugStop
+
+		case "break", "b":
+			if arg == "" {
+				fmt.Fprintln(d.out, "breakpoints:", strings.Trim(fmt.Sprint(d.Breakpoints()), "[]"))
+			} else if line, err := strconv.Atoi(arg); err == nil && line > 0 {
+				d.SetBreakpoint(line)
+			} else {
+				fmt.Fprintf(d.out, "invalid line %q\n", arg)
+			}
+
+		case "clear":
+			if line, err := strconv.Atoi(arg); err == nil {
+				d.ClearBreakpoint(line)
+			} else {
+				fmt.Fprintf(d.out, "invalid line %q\n", arg)
+			}
+
+		case "print", "p":
+			val, err := state.Eval(arg)
+			if err != nil {
+				fmt.Fprintln(d.out, "error:", err)
+			} else {
+				fmt.Fprintln(d.out, spiker.FormatValue(val))
+			}
+
+		case "watch", "w":
+			if arg != "" {
+				d.AddWatch(arg)
+			}
+			d.printWatches(state)
+
+		case "unwatch":
+			d.RemoveWatch(arg)
+
+		case "vars":
+			for s := state.Scope; s != nil; s = s.Enclosing() {
+				fmt.Fprintf(d.out, "%s (level %d)\n", s.Name(), s.Level())
+				vars := s.Vars()
+				names := make([]string, 0, len(vars))
+				for name := range vars {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(d.out, "    %s = %s\n", name, spiker.FormatValue(vars[name]))
+				}
+			}
+
+		case "stack":
+			for i, f := range state.Frames {
+				call := "<global>"
+				if f.Call != nil {
+					call = f.Call.Format()
+				}
+				fmt.Fprintf(d.out, "#%d %s line %d\n", i, call, f.Node.Pos().Line)
+			}
+
+		case "list", "l":
+			d.list(state.Pos.Line)
+
+		case "help", "h":
+			fmt.Fprint(d.out, debugHelp)
+
+		default:
+			fmt.Fprintf(d.out, "unknown command %s, see help\n", name)
+		}
+	}
+}
+
+// print the value of watch expressions
+func (d *debugger) printWatches(state *spiker.DebugState) {
+	for _, w := range state.Watches() {
+		if w.Err != nil {
+			fmt.Fprintf(d.out, "    %s: error: %v\n", w.Expr, w.Err)
+		} else {
+			fmt.Fprintf(d.out, "    %s = %s\n", w.Expr, spiker.FormatValue(w.Value))
+		}
+	}
+}
+
+// print the source lines around the current line,
+// marks the current line with "=>", and the breakpoints with "*"
+func (d *debugger) list(current int) {
+	breaks := make(map[int]bool)
+	for _, line := range d.Breakpoints() {
+		breaks[line] = true
+	}
+
+	from, to := current-3, current+3
+	if from < 1 {
+		from = 1
+	}
+	if to > len(d.source) {
+		to = len(d.source)
+	}
+	for line := from; line <= to; line++ {
+		mark := "  "
+		if line == current {
+			mark = "=>"
+		}
+		bp := " "
+		if breaks[line] {
+			bp = "*"
+		}
+		fmt.Fprintf(d.out, "%s%s%4d  %s\n", mark, bp, line, d.line(line))
+	}
+}
+
+// return the source of line, starts from 1
+func (d *debugger) line(n int) string {
+	if n < 1 || n > len(d.source) {
+		return ""
+	}
+	return strings.TrimRight(d.source[n-1], "\r")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdDebug(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"sum.src": "total = 0;\nadd = (a, b) -> {\n    c = a + b;\n    return c;\n};\n" +
+			"i = 0;\nwhile (i < 2) {\n    total = add(total, i);\n    i += 1;\n}\nexport(total);\n",
+		"fail.src":  "a = 1;\nf(a);",
+		"vars.json": `{"base": 10}`,
+	})
+	defer os.RemoveAll(dir)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "continue",
+			args:   []string{file("sum.src")},
+			stdin:  "c\n",
+			stdout: "line 1: total = 0;\n(debug) finished: 1\n",
+		},
+		{
+			name:  "breakpoints and inspection",
+			args:  []string{"-b", "3, 9", file("sum.src")},
+			stdin: "break\nclear 9\nwatch i\nc\nstack\nvars\nprint a + 10\nprint a +\nunwatch i\nlist\nc\nc\n",
+			stdout: "line 1: total = 0;\n" +
+				"(debug) breakpoints: 3 9\n" +
+				"(debug) (debug)     i = none\n" +
+				"(debug) line 3 in add(): c = a + b;\n    i = none\n" +
+				"(debug) #0 add(total, i) line 3\n#1 <global> line 8\n" +
+				"(debug) custom_func_add (level 2)\n    a = 0\n    b = 0\n" +
+				"(debug) 10\n" +
+				"(debug) error: syntax error: unexpected \";\" on line 1:4\n" +
+				"(debug) (debug)       1  total = 0;\n      2  add = (a, b) -> {\n=>*   3      c = a + b;\n      4      return c;\n      5  };\n      6  i = 0;\n" +
+				"(debug) line 3 in add(): c = a + b;\n" +
+				"(debug) finished: 1\n",
+		},
+		{
+			name:  "step",
+			args:  []string{file("sum.src"), "-b=8"},
+			stdin: "c\ns\nn\no\nn\nvars\nq\n",
+			stdout: "line 1: total = 0;\n" +
+				"(debug) line 8: total = add(total, i);\n" +
+				"(debug) line 3 in add(): c = a + b;\n" +
+				"(debug) line 4 in add(): return c;\n" +
+				"(debug) line 9: i += 1;\n" +
+				"(debug) line 8: total = add(total, i);\n" +
+				"(debug) GLOBAL (level 1)\n    i = 1\n    total = 0\n" +
+				"(debug) ",
+		},
+		{
+			name:   "the end of input stops",
+			args:   []string{"--vars", file("vars.json"), file("sum.src")},
+			stdin:  "p base\nbad\n",
+			stdout: "line 1: total = 0;\n(debug) 10\n(debug) unknown command bad, see help\n(debug) \n",
+		},
+		{
+			name:   "runtime error",
+			args:   []string{file("fail.src")},
+			stdin:  "n\nc\n",
+			code:   1,
+			stdout: "line 1: a = 1;\n(debug) line 2: f(a);\n(debug) ",
+			stderr: "fail.src: RUNTIME ERROR: call to undefined function f()",
+		},
+		{name: "invalid breakpoint", args: []string{"-b", "1,x", file("sum.src")}, code: 2, stderr: `invalid breakpoint "x"`},
+		{name: "standard input", args: []string{"-"}, code: 2, stderr: "usage: spiker debug"},
+		{name: "no file", args: []string{}, code: 2, stderr: "usage: spiker debug"},
+		{name: "missing file", args: []string{file("none.src")}, code: 1, stderr: "none.src"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"debug"}, tt.args...), strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Errorf("code = %d, want %d, stderr: %s", code, tt.code, stderr.String())
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("stdout = %q\nwant %q", stdout.String(), tt.stdout)
+			}
+			if tt.stderr == "" && stderr.Len() > 0 || !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/shockerli/spiker"
+)
+
+// format the files, write to stdout or overwrite the files
+func cmdFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("fmt", stderr)
+	write := fs.Bool("w", false, "write the result to the file instead of stdout")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+
+	if len(files) == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "spiker: can't use -w with the standard input")
+			return 2
+		}
+		files = []string{"-"}
+	}
+
+	code := 0
+	for _, name := range files {
+		if err := formatFile(name, *write, stdin, stdout); err != nil {
+			fmt.Fprintf(stderr, "spiker: %s: %v\n", name, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// format the file, the file is written only if it's changed
+func formatFile(name string, write bool, stdin io.Reader, stdout io.Writer) error {
+	src, err := readFile(name, stdin)
+	if err != nil {
+		return err
+	}
+	f, err := spiker.Format(string(src))
+	if err != nil {
+		return err
+	}
+	if f != "" {
+		f += "\n"
+	}
+
+	if !write {
+		_, err = io.WriteString(stdout, f)
+		return err
+	}
+	if f == string(src) {
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, []byte(f), info.Mode().Perm())
+}
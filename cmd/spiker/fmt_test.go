@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCmdFmt(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.src":   "a=1;b=[1,2]; # note",
+		"ok.src":  "a = 1;\n",
+		"bad.src": "a = ;",
+	})
+	defer os.RemoveAll(dir)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	// write to stdout
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"fmt", file("a.src"), file("ok.src")}, strings.NewReader(""), &stdout, &stderr)
+	if code != 0 || stdout.String() != "a = 1;\nb = [1, 2]; # note\na = 1;\n" || stderr.Len() != 0 {
+		t.Errorf("fmt = %d, %q, %q", code, stdout.String(), stderr.String())
+	}
+
+	// the standard input
+	stdout.Reset()
+	code = run([]string{"fmt"}, strings.NewReader("if(a){b=1;}"), &stdout, &stderr)
+	if code != 0 || stdout.String() != "if (a) {\n    b = 1;\n}\n" {
+		t.Errorf("fmt stdin = %d, %q", code, stdout.String())
+	}
+
+	// overwrite the files, continue after the error
+	stdout.Reset()
+	code = run([]string{"fmt", "-w", file("a.src"), file("bad.src"), file("ok.src")}, strings.NewReader(""), &stdout, &stderr)
+	if code != 1 || stdout.Len() != 0 || !strings.Contains(stderr.String(), `bad.src: syntax error: unexpected ";" on line 1:5`) {
+		t.Errorf("fmt -w = %d, %q, %q", code, stdout.String(), stderr.String())
+	}
+	for name, want := range map[string]string{
+		"a.src":   "a = 1;\nb = [1, 2]; # note\n",
+		"ok.src":  "a = 1;\n",
+		"bad.src": "a = ;",
+	} {
+		if got, _ := ioutil.ReadFile(file(name)); string(got) != want {
+			t.Errorf("fmt -w %s = %q, want %q", name, got, want)
+		}
+	}
+
+	stderr.Reset()
+	if code := run([]string{"fmt", "-w"}, strings.NewReader(""), &stdout, &stderr); code != 2 || !strings.Contains(stderr.String(), "standard input") {
+		t.Errorf("fmt -w stdin = %d, %q", code, stderr.String())
+	}
+}
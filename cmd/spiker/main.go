@@ -0,0 +1,99 @@
+// Command spiker is the command line tool of spiker scripts.
+//
+// Usage:
+//
+//	spiker [repl]                          start the interactive REPL
+//	spiker run [--vars vars.json] file     execute the file, and write the value as JSON
+//	spiker fmt [-w] [files...]             format the files
+//	spiker check files...                  report the syntax errors of files
+//	spiker debug [-b lines] file           debug the file with the commands of standard input
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const usage = `Usage:
+
+	spiker [repl]                          start the interactive REPL
+	spiker run [--vars vars.json] file     execute the file, and write the exported or final value as JSON,
+	                                       the file "-" is the standard input
+	spiker fmt [-w] [files...]             format the files, or the standard input if no file
+	spiker check files...                  report the syntax errors of files
+	spiker debug [--vars vars.json] [-b lines] file
+	                                       debug the file with the commands of standard input,
+	                                       the lines are the comma separated breakpoints
+	spiker help                            print this help
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run the command with arguments, return the exit code:
+// 0 is success, 1 is the error of script, 2 is the invalid usage
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return newRepl(stdin, stdout).run()
+	}
+
+	switch args[0] {
+	case "repl":
+		return newRepl(stdin, stdout).run()
+	case "run":
+		return cmdRun(args[1:], stdin, stdout, stderr)
+	case "fmt":
+		return cmdFmt(args[1:], stdin, stdout, stderr)
+	case "check":
+		return cmdCheck(args[1:], stderr)
+	case "debug":
+		return cmdDebug(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "spiker: unknown command %q\n\n%s", args[0], usage)
+	return 2
+}
+
+// return the flag set of subcommand, which reports the errors to stderr
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("spiker "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parse the flags, which are allowed after the arguments, return the arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if args = fs.Args(); len(args) == 0 {
+			return rest, nil
+		}
+		rest, args = append(rest, args[0]), args[1:]
+	}
+}
+
+// return the exit code of the invalid flags, 0 for -h
+func flagError(err error) int {
+	if err == flag.ErrHelp {
+		return 0
+	}
+	return 2
+}
+
+// read the file, or the standard input for "-"
+func readFile(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(name)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/shockerli/spiker"
+)
+
+const (
+	prompt         = "> "
+	continuePrompt = "... "
+)
+
+const replHelp = `Enter the statements to execute, the input continues until the braces balance,
+the meta command discards the unbalanced input.
+
+	:vars            list the variables
+	:funcs           list the functions
+	:reset           remove all variables and functions
+	:format [code]   format the code, or the last input
+	:ast [code]      print the syntax tree of code, or the last input
+	:help            print this help
+	:quit            exit the REPL
+`
+
+// repl the read-eval-print loop, keeps the variables and functions across inputs
+type repl struct {
+	engine *spiker.Engine
+	scope  *spiker.VariableScope
+	in     *bufio.Reader
+	out    io.Writer
+	last   string // the last executed input
+}
+
+func newRepl(in io.Reader, out io.Writer) *repl {
+	return &repl{
+		engine: spiker.New(),
+		scope:  spiker.NewScopeTable("repl", 1, nil),
+		in:     bufio.NewReader(in),
+		out:    out,
+	}
+}
+
+// run the loop until the end of input or :quit, return the exit code
+func (r *repl) run() int {
+	var input string
+	for {
+		if input == "" {
+			fmt.Fprint(r.out, prompt)
+		} else {
+			fmt.Fprint(r.out, continuePrompt)
+		}
+
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			if input != "" {
+				// the unbalanced input at the end
+				r.eval(input)
+			}
+			fmt.Fprintln(r.out)
+			return 0
+		}
+
+		// the meta command discards the unbalanced input
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			input = ""
+			if !r.command(strings.TrimSpace(line)) {
+				return 0
+			}
+			continue
+		}
+
+		input += line
+		if strings.TrimSpace(input) == "" {
+			input = ""
+			continue
+		}
+		if depth(input) > 0 {
+			continue
+		}
+		r.eval(input)
+		input = ""
+	}
+}
+
+// execute the input, and print its value
+func (r *repl) eval(input string) {
+	ast, err := r.engine.ParseAst(input)
+	if err != nil && strings.HasSuffix(strings.TrimSpace(input), "}") {
+		// the block of function definition ends without ";"
+		fixed, e := r.engine.ParseAst(input + ";")
+		if e == nil && len(fixed) > 0 {
+			if _, ok := fixed[len(fixed)-1].(*spiker.NodeFuncDef); ok {
+				ast, err, input = fixed, nil, input+";"
+			}
+		}
+	}
+	if err != nil {
+		r.error(err)
+		return
+	}
+	r.last = input
+	if len(ast) == 0 {
+		return
+	}
+
+	val, err := r.engine.EvaluateWithScope(ast, r.scope)
+	if err != nil {
+		r.error(err)
+		return
+	}
+
+	// the function definition has no value
+	if _, ok := ast[len(ast)-1].(*spiker.NodeFuncDef); ok {
+		return
+	}
+	fmt.Fprintln(r.out, spiker.FormatValue(val))
+}
+
+// run the meta command, return false to quit
+func (r *repl) command(line string) bool {
+	name, arg := line, ""
+	if idx := strings.IndexAny(line, " \t"); idx > 0 {
+		name, arg = line[:idx], strings.TrimSpace(line[idx+1:])
+	}
+	if arg == "" {
+		arg = r.last
+	}
+
+	switch name {
+	case ":quit", ":exit", ":q":
+		return false
+
+	case ":help", ":h":
+		fmt.Fprint(r.out, replHelp)
+
+	case ":vars":
+		vars := r.scope.Vars()
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.out, "%s = %s\n", name, spiker.FormatValue(vars[name]))
+		}
+
+	case ":funcs":
+		for _, fnd := range r.scope.Funcs() {
+			var ps []string
+			for _, p := range fnd.Params {
+				ps = append(ps, p.Format())
+			}
+			fmt.Fprintf(r.out, "%s(%s)\n", fnd.Name.Value, strings.Join(ps, ", "))
+		}
+		fmt.Fprintf(r.out, "builtin: %s\n", strings.Join(r.engine.Funcs(), ", "))
+
+	case ":reset":
+		r.scope.Clean()
+		r.last = ""
+		fmt.Fprintln(r.out, "the variables and functions are removed")
+
+	case ":format":
+		f, err := r.engine.Format(arg)
+		if err != nil {
+			r.error(err)
+		} else if f != "" {
+			fmt.Fprintln(r.out, f)
+		}
+
+	case ":ast":
+		ast, err := r.engine.ParseAst(arg)
+		if err != nil {
+			r.error(err)
+			break
+		}
+		printAst(r.out, ast)
+
+	default:
+		fmt.Fprintf(r.out, "unknown command %s, see :help\n", name)
+	}
+
+	return true
+}
+
+func (r *repl) error(err error) {
+	fmt.Fprintln(r.out, "error:", err)
+}
+
+// return the depth of the unclosed braces, brackets and parentheses
+func depth(code string) (n int) {
+	tokens, _ := spiker.TokenizeRecover(code)
+	for _, t := range tokens {
+		switch t.Symbol {
+		case spiker.SymbolLbrace, spiker.SymbolLbrack, spiker.SymbolLparen:
+			n++
+		case spiker.SymbolRbrace, spiker.SymbolRbrack, spiker.SymbolRparen:
+			n--
+		}
+	}
+	return
+}
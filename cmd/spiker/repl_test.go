@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "values",
+			input:  "1 + 2\n\"a\\\"b\"\n[1, [\"k\": true]]\na = none;\n# comment\n",
+			expect: "> 3\n> \"a\\\"b\"\n> [1, [\"k\": true]]\n> none\n> > \n",
+		},
+		{
+			name:   "persistent scope",
+			input:  "a = 2;\nb = a * 3;\nexport(a + b);\n",
+			expect: "> 2\n> 6\n> 8\n> \n",
+		},
+		{
+			name:   "multi-line block",
+			input:  "sum = (x, y) -> {\n    return x + y;\n}\nif (sum(1, 2) > 2) {\n    c = [\n        1,\n    ];\n}\nc\n",
+			expect: "> ... ... > ... ... ... ... [1]\n> [1]\n> \n",
+		},
+		{
+			name:   "balanced at the end",
+			input:  "a = (1 +\n2)",
+			expect: "> ... 3\n> \n",
+		},
+		{
+			name:   "unbalanced at the end",
+			input:  "a = [1,\n",
+			expect: "> ... error: syntax error: unexpected \";\" on line 1:8\n\n",
+		},
+		{
+			name:   "errors",
+			input:  "a = ;\nf(1)\n1 + *\n",
+			expect: "> error: syntax error: unexpected \";\" on line 1:5\n> error: RUNTIME ERROR: call to undefined function f() on line 1:1\n> error: syntax error: unexpected \"*\" on line 1:5\n> \n",
+		},
+		{
+			name:  "vars and funcs",
+			input: "b = [\"k\": 1];\na = \"x\";\ninc = x -> x + 1;\n:vars\n:funcs\n:reset\n:vars\n:funcs\n",
+			expect: "> [\"k\": 1]\n> \"x\"\n> > a = \"x\"\nb = [\"k\": 1]\n> inc(x)\nbuiltin: del, exist, export, len, print\n" +
+				"> the variables and functions are removed\n> > builtin: del, exist, export, len, print\n> \n",
+		},
+		{
+			name:   "format",
+			input:  ":format a=1;if(a){b=2;}\nf = (x) -> {\nreturn x;\n}\n:format\n:format a = (\n",
+			expect: "> a = 1;\nif (a) {\n    b = 2;\n}\n> ... ... > f = x -> {\n    return x;\n};\n> error: syntax error: unexpected \";\" on line 1:6\n> \n",
+		},
+		{
+			name:  "ast",
+			input: ":ast a = b[0] + f(1)\nx = !y;\n:ast\n",
+			expect: "> AssignOp = 1:1-1:16\n  Variable a 1:1-1:2\n  BinaryOp + 1:5-1:16\n    VarIndex 1:5-1:9\n      Variable b 1:5-1:6\n      Number 0 1:7-1:8\n" +
+				"    FuncCallOp 1:12-1:16\n      Variable f 1:12-1:13\n      Number 1 1:14-1:15\n" +
+				"> true\n> AssignOp = 1:1-1:7\n  Variable x 1:1-1:2\n  UnaryOp ! 1:5-1:7\n    Variable y 1:6-1:7\n> \n",
+		},
+		{
+			name:   "meta command discards the unbalanced input",
+			input:  "a = [1,\n:help\n:bad\n:quit\n1\n",
+			expect: "> ... " + replHelp + "> unknown command :bad, see :help\n> ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if code := newRepl(strings.NewReader(tt.input), &out).run(); code != 0 {
+				t.Errorf("run() = %d", code)
+			}
+			if out.String() != tt.expect {
+				t.Errorf("output = %q\nwant %q", out.String(), tt.expect)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"help"}, strings.NewReader(""), &stdout, &stderr); code != 0 || stdout.String() != usage {
+		t.Errorf("run(help) = %d, %q", code, stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run(nil, strings.NewReader("1 + 1\n"), &stdout, &stderr); code != 0 || stdout.String() != "> 2\n> \n" {
+		t.Errorf("run() = %d, %q", code, stdout.String())
+	}
+
+	if code := run([]string{"nope"}, strings.NewReader(""), &stdout, &stderr); code != 2 || !strings.Contains(stderr.String(), `unknown command "nope"`) {
+		t.Errorf("run(nope) = %d, %q", code, stderr.String())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/shockerli/spiker"
+)
+
+// execute the file with the variables of JSON object,
+// and write the exported or final value as JSON
+func cmdRun(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("run", stderr)
+	varsFile := fs.String("vars", "", "the JSON `file` of object, whose fields are the variables of script")
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(stderr, "usage: spiker run [--vars vars.json] file")
+		return 2
+	}
+
+	scope := spiker.NewScopeTable("GLOBAL", 1, nil)
+	if *varsFile != "" {
+		vars, err := readVars(*varsFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "spiker: %s: %v\n", *varsFile, err)
+			return 2
+		}
+		for name, val := range vars {
+			scope.Set(name, val)
+		}
+	}
+
+	code, err := readFile(files[0], stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "spiker:", err)
+		return 1
+	}
+	val, err := spiker.ExecuteWithScope(string(code), scope)
+	if err != nil {
+		fmt.Fprintf(stderr, "spiker: %s: %v\n", files[0], err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(val); err != nil {
+		fmt.Fprintf(stderr, "spiker: %s: %v\n", files[0], err)
+		return 1
+	}
+	return 0
+}
+
+// read the variables from the JSON object
+func readVars(name string) (vars map[string]interface{}, err error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &vars); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %v", err)
+	}
+	return
+}
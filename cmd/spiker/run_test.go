@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// write the files to a temporary directory, return the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "spiker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCmdRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"order.src": "total = price * qty;\nif (total > 10) {\n    export([\"total\": total, \"tag\": \"<a&b>\", \"items\": items]);\n}\ntotal",
+		"bad.src":   "a = ;",
+		"fail.src":  "f(1);",
+		"vars.json": `{"price": 2.5, "qty": 6, "items": [{"id": 1}]}`,
+		"low.json":  `{"price": 1, "qty": 2}`,
+		"list.json": `[1]`,
+	})
+	defer os.RemoveAll(dir)
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{file("order.src"), "--vars", file("vars.json")}, "", 0, `{"items":[{"id":1}],"tag":"<a&b>","total":15}` + "\n", ""},
+		{[]string{"--vars", file("low.json"), file("order.src")}, "", 0, "2\n", ""},
+		{[]string{"-vars=" + file("low.json"), "-"}, "[price, qty * 2, \"x\"]", 0, `[1,4,"x"]` + "\n", ""},
+		{[]string{"-"}, "a = 1;", 0, "1\n", ""},
+		{[]string{"-"}, "# nothing", 0, "null\n", ""},
+		{[]string{file("bad.src")}, "", 1, "", `bad.src: syntax error: unexpected ";" on line 1:5`},
+		{[]string{file("fail.src")}, "", 1, "", "fail.src: RUNTIME ERROR: call to undefined function f()"},
+		{[]string{file("none.src")}, "", 1, "", "none.src"},
+		{[]string{file("order.src"), "--vars", file("list.json")}, "", 2, "", "list.json: invalid JSON object"},
+		{[]string{file("order.src"), "--vars", file("none.json")}, "", 2, "", "none.json"},
+		{[]string{}, "", 2, "", "usage: spiker run"},
+		{[]string{"a.src", "b.src"}, "", 2, "", "usage: spiker run"},
+		{[]string{"--bad"}, "", 2, "", "flag provided but not defined: -bad"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"run"}, tt.args...), strings.NewReader(tt.stdin), &stdout, &stderr)
+		if code != tt.code || stdout.String() != tt.stdout || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("run %v = %d, %q, %q\nwant %d, %q, %q", tt.args, code, stdout.String(), stderr.String(), tt.code, tt.stdout, tt.stderr)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package spiker
+
+import "sort"
+
+// Comment the `#` comment in source
+type Comment struct {
+	Text string   // the text of comment, include the "#"
+	Pos  Position // the position of "#"
+	End  Position // the position after the comment
+}
+
+// Comments the comments attached to statement node
+type Comments struct {
+	Leading    []*Comment // the comment lines before node
+	Trailing   *Comment   // the comment at the end of the last line of node
+	Footer     []*Comment // the comment lines after node, at the end of block or code
+	Body       []*Comment // the comment lines in the empty block of if, while and function definition
+	Else       []*Comment // the comment lines in the empty else block
+	BeforeElse []*Comment // the comments between the if block and "else"
+}
+
+func (cs *Comments) isEmpty() bool {
+	return len(cs.Leading) == 0 && cs.Trailing == nil && len(cs.Footer) == 0 &&
+		len(cs.Body) == 0 && len(cs.Else) == 0 && len(cs.BeforeElse) == 0
+}
+
+// Comments return the attached comments, nil if none
+func (ast Ast) Comments() *Comments {
+	return ast.comments
+}
+
+func (ast *Ast) setComments(cs *Comments) {
+	ast.comments = cs
+}
+
+// return the comments of node, nil if none
+func commentsOf(node AstNode) *Comments {
+	if n, ok := node.(interface{ Comments() *Comments }); ok {
+		return n.Comments()
+	}
+	return nil
+}
+
+// return the comments of node for updating, nil if the node can't hold comments
+func editComments(node AstNode) *Comments {
+	n, ok := node.(interface {
+		Comments() *Comments
+		setComments(*Comments)
+	})
+	if !ok {
+		return nil
+	}
+	if n.Comments() == nil {
+		n.setComments(&Comments{})
+	}
+	return n.Comments()
+}
+
+// attach the comments to the statements by the source positions,
+// the tokens are the statements of nodes, to find the comments of blocks.
+// Return the comments which have no statement to attach, such as in the empty block
+func attachComments(nodes []AstNode, toks []*Token, comments []*Comment) []*Comment {
+	var last *Comments // the comments of last statement
+	var lastLine int   // the end line of last statement
+
+	for i, node := range nodes {
+		if node == nil || i >= len(toks) {
+			continue
+		}
+		pos, end := node.Pos(), node.End()
+		cs := editComments(node)
+		if cs == nil || !pos.IsValid() || !end.IsValid() {
+			continue
+		}
+
+		var inner []*Comment
+		for len(comments) > 0 && comments[0].Pos.Offset < end.Offset {
+			c := comments[0]
+			comments = comments[1:]
+			switch {
+			case c.Pos.Offset >= pos.Offset:
+				inner = append(inner, c)
+			case last != nil && last.Trailing == nil && c.Pos.Line == lastLine:
+				last.Trailing = c
+			default:
+				cs.Leading = append(cs.Leading, c)
+			}
+		}
+
+		// the comments inside statement but not in blocks are moved before it
+		cs.Leading = append(cs.Leading, attachInner(node, toks[i], inner)...)
+		sort.SliceStable(cs.Leading, func(i, j int) bool {
+			return cs.Leading[i].Pos.Offset < cs.Leading[j].Pos.Offset
+		})
+
+		last, lastLine = cs, end.Line
+	}
+
+	// after the last statement
+	var rest []*Comment
+	for _, c := range comments {
+		switch {
+		case last == nil:
+			rest = append(rest, c)
+		case last.Trailing == nil && len(last.Footer) == 0 && c.Pos.Line == lastLine:
+			last.Trailing = c
+		default:
+			last.Footer = append(last.Footer, c)
+		}
+	}
+
+	// nil if none
+	for _, node := range nodes {
+		if n, ok := node.(interface{ setComments(*Comments) }); ok && commentsOf(node) != nil && commentsOf(node).isEmpty() {
+			n.setComments(nil)
+		}
+	}
+
+	return rest
+}
+
+// attach the comments inside statement to the statements of its blocks
+func attachInner(node AstNode, tok *Token, comments []*Comment) []*Comment {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	var empty []*Comment
+	switch n := node.(type) {
+	case *NodeIf:
+		return attachIf(n, tok, comments)
+
+	case *NodeWhile:
+		if len(tok.children) > 1 {
+			comments, empty = attachBlock(n.Body, tok.children[1], comments)
+			if len(empty) > 0 {
+				editComments(n).Body = empty
+			}
+		}
+
+	case *NodeFuncDef:
+		if len(tok.children) > 1 && len(tok.children[1].children) > 1 {
+			comments, empty = attachBlock(n.Body, tok.children[1].children[1], comments)
+			if len(empty) > 0 {
+				editComments(n).Body = empty
+			}
+		}
+	}
+
+	return comments
+}
+
+// attach the comments to the blocks of if statement
+func attachIf(n *NodeIf, tok *Token, comments []*Comment) []*Comment {
+	if len(tok.children) < 2 {
+		return comments
+	}
+
+	body := tok.children[1]
+	comments, empty := attachBlock(n.Body, body, comments)
+	if len(empty) > 0 {
+		editComments(n).Body = empty
+	}
+	if len(tok.children) < 3 {
+		return comments
+	}
+
+	// after the "}" of if block, before the else block or else if
+	if body.end != nil {
+		var before []*Comment
+		before, comments = splitComments(comments, body.end.offset, tok.children[2].offset)
+		if len(before) > 0 {
+			editComments(n).BeforeElse = before
+		}
+	}
+
+	if n.ElseIf == nil {
+		comments, empty = attachBlock(n.Else, tok.children[2], comments)
+		if len(empty) > 0 {
+			editComments(n).Else = empty
+		}
+		return comments
+	}
+
+	// else if
+	in, out := splitComments(comments, n.ElseIf.Pos().Offset, n.ElseIf.End().Offset)
+	return append(out, attachIf(n.ElseIf, tok.children[2], in)...)
+}
+
+// attach the comments between "{" and "}" to the statements of block,
+// return the comments out of block, and the comments in the block without statement
+func attachBlock(nodes []AstNode, block *Token, comments []*Comment) (out, empty []*Comment) {
+	if block == nil || block.sym != SymbolLbrace || block.end == nil {
+		return comments, nil
+	}
+
+	in, out := splitComments(comments, block.offset+1, block.end.offset)
+	return out, attachComments(nodes, block.children, in)
+}
+
+// split the comments start in the range [start, end) from the others
+func splitComments(comments []*Comment, start, end int) (in, out []*Comment) {
+	for _, c := range comments {
+		if c.Pos.Offset >= start && c.Pos.Offset < end {
+			in = append(in, c)
+		} else {
+			out = append(out, c)
+		}
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package spiker
+
+// completionType type of completion record
+type completionType uint8
+
+const (
+	completionNormal   completionType = iota // evaluated normally
+	completionReturn                         // `return` statement
+	completionBreak                          // `break` statement
+	completionContinue                       // `continue` statement
+	completionExport                         // `export` builtin function
+)
+
+// completion record of evaluation,
+// the abrupt completion interrupts the statements until it is consumed
+type completion struct {
+	typ completionType
+	val interface{}
+}
+
+// return the normal completion of value
+func normal(val interface{}) completion {
+	return completion{val: val}
+}
+
+// report whether the completion interrupts the statements
+func (c completion) abrupt() bool {
+	return c.typ != completionNormal
+}
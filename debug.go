@@ -0,0 +1,270 @@
+package spiker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// DebugAction the action to resume the paused evaluation
+type DebugAction int
+
+// Supported debug actions
+const (
+	DebugContinue DebugAction = iota // run until the next breakpoint
+	DebugStepInto                    // pause at the next statement, include the statements of the called function
+	DebugStepOver                    // pause at the next statement of the current function, or its caller
+	DebugStepOut                     // pause at the next statement after the current function returns
+	DebugStop                        // stop the evaluation with ErrDebugStopped
+)
+
+// ErrDebugStopped returned when the evaluation is stopped by debugger
+var ErrDebugStopped = errors.New("RUNTIME ERROR: execution stopped by debugger")
+
+// DebugHandler called when the evaluation pauses before a statement,
+// return the action to resume it. The state is valid until the handler returns
+type DebugHandler func(state *DebugState) DebugAction
+
+// Debugger step debugger of the evaluation, the evaluation pauses before the statement
+// on breakpoint line, or the statement reached by step. It is not safe for concurrent evaluations
+type Debugger struct {
+	engine  *Engine
+	handler DebugHandler
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+	watches     []string
+	paused      bool // pause at the next statement
+}
+
+// NewDebugger return a debugger with the builtin functions of default engine
+func NewDebugger(handler DebugHandler) *Debugger {
+	return defaultEngine.NewDebugger(handler)
+}
+
+// NewDebugger return a debugger evaluates with the engine
+func (e *Engine) NewDebugger(handler DebugHandler) *Debugger {
+	return &Debugger{engine: e, handler: handler, breakpoints: make(map[int]bool)}
+}
+
+// SetBreakpoint pause before the statements start at the line
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mu.Lock()
+	d.breakpoints[line] = true
+	d.mu.Unlock()
+}
+
+// ClearBreakpoint remove the breakpoint of line
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	delete(d.breakpoints, line)
+	d.mu.Unlock()
+}
+
+// Breakpoints return the lines of breakpoints, sorted
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// AddWatch add the expression evaluated by DebugState.Watches
+func (d *Debugger) AddWatch(expr string) {
+	d.mu.Lock()
+	d.watches = append(d.watches, expr)
+	d.mu.Unlock()
+}
+
+// RemoveWatch remove the watch expression
+func (d *Debugger) RemoveWatch(expr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, w := range d.watches {
+		if w == expr {
+			d.watches = append(d.watches[:i], d.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pause pause before the next statement, such as the first statement of evaluation.
+// It's safe to call from another goroutine to interrupt the running evaluation
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	d.paused = true
+	d.mu.Unlock()
+}
+
+// Execute parse and evaluate the code with debugger
+func (d *Debugger) Execute(code string, scope *VariableScope) (val interface{}, err error) {
+	ast, err := d.engine.ParseAst(code)
+	if err != nil {
+		return
+	}
+	return d.Evaluate(context.Background(), ast, scope)
+}
+
+// Evaluate same as Engine.EvaluateContext, evaluate the nodes with debugger
+func (d *Debugger) Evaluate(ctx context.Context, nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
+	if scope == nil {
+		return nil, &RuntimeError{Message: "nil variable scope"}
+	}
+	defer d.engine.bind(ctx, scope)()
+
+	ex := scope.exec
+	ex.debug = &debugSession{debugger: d, frames: []*DebugFrame{{Scope: scope}}}
+	return evaluate(nodeList, scope)
+}
+
+// return whether the pause is requested, and whether the line has breakpoint.
+// The pause request is consumed
+func (d *Debugger) check(line int) (requested, breakpoint bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	requested, d.paused = d.paused, false
+	return requested, d.breakpoints[line]
+}
+
+// DebugFrame the function call of the paused evaluation
+type DebugFrame struct {
+	Func  string          // the name of function, empty for the global code
+	Call  *NodeFuncCallOp // the call of function, nil for the global code
+	Node  AstNode         // the statement being executed
+	Scope *VariableScope  // the scope of statement
+}
+
+// DebugState the state of paused evaluation
+type DebugState struct {
+	Node       AstNode       // the statement to be executed
+	Pos        Position      // the position of statement
+	Breakpoint bool          // the line of statement has breakpoint
+	Frames     []*DebugFrame // the call stack, the innermost first
+	Scope      *VariableScope
+
+	session *debugSession
+}
+
+// Eval evaluate the expression in the scope of paused statement,
+// the assignment changes the variable of scope
+func (s *DebugState) Eval(expr string) (val interface{}, err error) {
+	ast, err := parse(expr)
+	if err != nil {
+		return
+	}
+
+	// no pause in the expression
+	s.session.suspended = true
+	defer func() {
+		s.session.suspended = false
+	}()
+	return evaluate(ast, s.Scope)
+}
+
+// Watch the value of watch expression
+type Watch struct {
+	Expr  string
+	Value interface{}
+	Err   error
+}
+
+// Watches evaluate the watch expressions of debugger
+func (s *DebugState) Watches() []Watch {
+	d := s.session.debugger
+	d.mu.Lock()
+	exprs := append([]string(nil), d.watches...)
+	d.mu.Unlock()
+
+	watches := make([]Watch, 0, len(exprs))
+	for _, expr := range exprs {
+		val, err := s.Eval(expr)
+		watches = append(watches, Watch{Expr: expr, Value: val, Err: err})
+	}
+	return watches
+}
+
+// debugSession the debug state of an evaluation
+type debugSession struct {
+	debugger  *Debugger
+	frames    []*DebugFrame // the call stack, the outermost first
+	action    DebugAction   // the last action
+	depth     int           // the depth of call stack when the action is returned
+	suspended bool          // evaluating the watch expression
+}
+
+// pause before the statement if it's on breakpoint or reached by step
+func (s *debugSession) pause(node AstNode, scope *VariableScope) error {
+	if s.suspended {
+		return nil
+	}
+
+	frame := s.frames[len(s.frames)-1]
+	line := node.Pos().Line
+	// the breakpoint pauses once for the statements on the same line,
+	// but again when the execution goes back, such as the next iteration of loop
+	last := frame.Node
+	lineChanged := last == nil || last.Pos().Line != line || last.Pos().Offset >= node.Pos().Offset
+	frame.Node = node
+
+	var step bool
+	switch s.action {
+	case DebugStepInto:
+		step = true
+	case DebugStepOver:
+		step = len(s.frames) <= s.depth
+	case DebugStepOut:
+		step = len(s.frames) < s.depth
+	}
+	requested, breakpoint := s.debugger.check(line)
+	breakpoint = breakpoint && lineChanged
+	if !step && !requested && !breakpoint {
+		return nil
+	}
+
+	state := &DebugState{
+		Node:       node,
+		Pos:        node.Pos(),
+		Breakpoint: breakpoint,
+		Scope:      scope,
+		session:    s,
+	}
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		f := *s.frames[i]
+		state.Frames = append(state.Frames, &f)
+	}
+
+	s.action, s.depth = DebugContinue, len(s.frames)
+	if s.debugger.handler != nil {
+		s.action = s.debugger.handler(state)
+	}
+	if s.action == DebugStop {
+		return ErrDebugStopped
+	}
+	return nil
+}
+
+// enter the custom function call
+func (s *debugSession) enter(fnc *NodeFuncCallOp, scope *VariableScope) {
+	s.frames = append(s.frames, &DebugFrame{Func: fnc.Name.Value, Call: fnc, Scope: scope})
+}
+
+// leave the custom function call
+func (s *debugSession) leave() {
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+// pause before the statement when debugging
+func (ex *execution) pause(node AstNode, scope *VariableScope) error {
+	if ex.debug == nil {
+		return nil
+	}
+	return ex.debug.pause(node, scope)
+}
@@ -0,0 +1,249 @@
+package spiker_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+const debugCode = `total = 0;
+add = (a, b) -> {
+    c = a + b;
+    return c;
+};
+i = 0;
+while (i < 2) {
+    total = add(total, i);
+    i += 1;
+}
+export(total);
+`
+
+// record the pauses as "line func<caller: vars", and resume with the actions in order
+func debugTrace(actions ...spiker.DebugAction) (*[]string, spiker.DebugHandler) {
+	var trace []string
+	return &trace, func(state *spiker.DebugState) spiker.DebugAction {
+		var funcs []string
+		for _, f := range state.Frames {
+			funcs = append(funcs, f.Func)
+		}
+		var vars []string
+		for name, val := range state.Scope.Vars() {
+			vars = append(vars, name+"="+spiker.FormatValue(val))
+		}
+		sort.Strings(vars)
+		trace = append(trace, fmt.Sprintf("%d %s: %s", state.Pos.Line, strings.Join(funcs, "<"), strings.Join(vars, " ")))
+
+		if len(actions) == 0 {
+			return spiker.DebugContinue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+}
+
+func repeat(action spiker.DebugAction, n int) []spiker.DebugAction {
+	actions := make([]spiker.DebugAction, n)
+	for i := range actions {
+		actions[i] = action
+	}
+	return actions
+}
+
+func TestDebugger_Step(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []int
+		pause       bool
+		actions     []spiker.DebugAction
+		expect      []string
+	}{
+		{
+			name:        "breakpoint",
+			breakpoints: []int{3},
+			expect:      []string{"3 add<: a=0 b=0", "3 add<: a=0 b=1"},
+		},
+		{
+			name:    "step into",
+			pause:   true,
+			actions: repeat(spiker.DebugStepInto, 20),
+			expect: []string{
+				"1 : ", "2 : total=0", "6 : total=0", "7 : i=0 total=0",
+				"8 : i=0 total=0", "3 add<: a=0 b=0", "4 add<: a=0 b=0 c=0", "9 : i=0 total=0",
+				"8 : i=1 total=0", "3 add<: a=0 b=1", "4 add<: a=0 b=1 c=1", "9 : i=1 total=1",
+				"11 : i=2 total=1",
+			},
+		},
+		{
+			name:    "step over",
+			pause:   true,
+			actions: repeat(spiker.DebugStepOver, 20),
+			expect: []string{
+				"1 : ", "2 : total=0", "6 : total=0", "7 : i=0 total=0",
+				"8 : i=0 total=0", "9 : i=0 total=0", "8 : i=1 total=0", "9 : i=1 total=1",
+				"11 : i=2 total=1",
+			},
+		},
+		{
+			name:        "step out",
+			breakpoints: []int{3},
+			actions:     []spiker.DebugAction{spiker.DebugStepOut, spiker.DebugStepOver},
+			expect:      []string{"3 add<: a=0 b=0", "9 : i=0 total=0", "8 : i=1 total=0", "3 add<: a=0 b=1"},
+		},
+		{
+			name:        "step over the breakpoint in function",
+			breakpoints: []int{3, 8},
+			actions:     []spiker.DebugAction{spiker.DebugStepOver, spiker.DebugStepOver},
+			expect:      []string{"8 : i=0 total=0", "3 add<: a=0 b=0", "4 add<: a=0 b=0 c=0", "8 : i=1 total=0", "3 add<: a=0 b=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		trace, handler := debugTrace(tt.actions...)
+		d := spiker.NewDebugger(handler)
+		for _, line := range tt.breakpoints {
+			d.SetBreakpoint(line)
+		}
+		if tt.pause {
+			d.Pause()
+		}
+
+		val, err := d.Execute(debugCode, spiker.NewScopeTable("debug", 1, nil))
+		if err != nil || val != float64(1) {
+			t.Fatalf("%s: Execute() = %v, %v", tt.name, val, err)
+		}
+		if strings.Join(*trace, "\n") != strings.Join(tt.expect, "\n") {
+			t.Errorf("%s: trace =\n%s\nwant\n%s", tt.name, strings.Join(*trace, "\n"), strings.Join(tt.expect, "\n"))
+		}
+	}
+}
+
+func TestDebugger_Breakpoints(t *testing.T) {
+	d := spiker.NewDebugger(nil)
+	d.SetBreakpoint(9)
+	d.SetBreakpoint(3)
+	d.SetBreakpoint(9)
+	d.SetBreakpoint(11)
+	d.ClearBreakpoint(11)
+	if got := fmt.Sprint(d.Breakpoints()); got != "[3 9]" {
+		t.Errorf("Breakpoints() = %s", got)
+	}
+
+	// the nil handler continues
+	if val, err := d.Execute(debugCode, spiker.NewScopeTable("debug", 1, nil)); err != nil || val != float64(1) {
+		t.Errorf("Execute() = %v, %v", val, err)
+	}
+
+	// pause once for the statements on the same line
+	trace, handler := debugTrace()
+	d = spiker.NewDebugger(handler)
+	d.SetBreakpoint(1)
+	if _, err := d.Execute("a = 1; b = 2;\nc = 3; while (c > 0) { c -= 1; }", spiker.NewScopeTable("debug", 1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*trace) != 1 {
+		t.Errorf("trace = %v", *trace)
+	}
+
+	// pause at each iteration of loop
+	for _, tt := range []struct {
+		code string
+		line int
+		want string
+	}{
+		{"i = 0;\nwhile (i < 3) {\n  i = i + 1;\n}", 3, "[3 : i=0 3 : i=1 3 : i=2]"},
+		{"i = 0;\nwhile (i < 3) { i = i + 1; }", 2, "[2 : i=0 2 : i=1 2 : i=2]"},
+		{"f = x -> x * 2;\ni = 0;\nwhile (i < 2) {\n  i = f(i) + 1;\n}", 4, "[4 : i=0 4 : i=1]"},
+	} {
+		trace, handler := debugTrace()
+		d = spiker.NewDebugger(handler)
+		d.SetBreakpoint(tt.line)
+		if _, err := d.Execute(tt.code, spiker.NewScopeTable("debug", 1, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(*trace); got != tt.want {
+			t.Errorf("Execute(%q) trace = %s, want %s", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestDebugger_Stop(t *testing.T) {
+	_, handler := debugTrace(spiker.DebugStepInto, spiker.DebugStop)
+	d := spiker.NewDebugger(handler)
+	d.SetBreakpoint(8)
+
+	scope := spiker.NewScopeTable("debug", 1, nil)
+	if _, err := d.Execute(debugCode, scope); err != spiker.ErrDebugStopped {
+		t.Errorf("Execute() error = %v, want %v", err, spiker.ErrDebugStopped)
+	}
+	if val, _ := scope.Get("total"); val != float64(0) {
+		t.Errorf("total = %v, want 0", val)
+	}
+}
+
+func TestDebugger_Inspect(t *testing.T) {
+	var watches, scopes []string
+	d := spiker.NewDebugger(func(state *spiker.DebugState) spiker.DebugAction {
+		for _, w := range state.Watches() {
+			watches = append(watches, fmt.Sprintf("%s=%s,%v", w.Expr, spiker.FormatValue(w.Value), w.Err != nil))
+		}
+		for _, f := range state.Frames {
+			for s := f.Scope; s != nil; s = s.Enclosing() {
+				scopes = append(scopes, fmt.Sprintf("%s:%d:%s:%s", f.Func, s.Level(), s.Name(), spiker.FormatValue(s.Vars()["a"])))
+			}
+		}
+
+		switch state.Pos.Line {
+		case 9:
+			if _, err := state.Eval("total = total + 100"); err != nil {
+				t.Errorf("Eval() error = %v", err)
+			}
+		case 3:
+			// the evaluation of expression doesn't pause
+			if val, err := state.Eval("add(a, 10) - a"); err != nil || val != float64(10) {
+				t.Errorf("Eval() = %v, %v", val, err)
+			}
+			if _, err := state.Eval("a +"); err == nil {
+				t.Error("Eval() should report the syntax error")
+			}
+		}
+		return spiker.DebugContinue
+	})
+	d.SetBreakpoint(3)
+	d.SetBreakpoint(9)
+	d.AddWatch("i * 10")
+	d.AddWatch("b")
+	d.AddWatch("x(")
+	d.RemoveWatch("b")
+
+	parent := spiker.NewScopeTable("host", 1, nil)
+	parent.Set("a", "host")
+	val, err := d.Execute(debugCode, spiker.NewScopeTable("debug", 2, parent))
+	if err != nil || val != float64(201) {
+		t.Errorf("Execute() = %v, %v", val, err)
+	}
+
+	wantWatches := []string{
+		"i * 10=0,false", "x(=none,true", // line 3, i is undefined in the function
+		"i * 10=0,false", "x(=none,true", // line 9
+		"i * 10=0,false", "x(=none,true",
+		"i * 10=10,false", "x(=none,true",
+	}
+	if strings.Join(watches, "\n") != strings.Join(wantWatches, "\n") {
+		t.Errorf("watches =\n%s", strings.Join(watches, "\n"))
+	}
+
+	wantScopes := []string{
+		"add:3:custom_func_add:0", ":2:debug:none", ":1:host:\"host\"",
+		":2:debug:none", ":1:host:\"host\"",
+		"add:3:custom_func_add:100", ":2:debug:none", ":1:host:\"host\"",
+		":2:debug:none", ":1:host:\"host\"",
+	}
+	if strings.Join(scopes, "\n") != strings.Join(wantScopes, "\n") {
+		t.Errorf("scopes =\n%s", strings.Join(scopes, "\n"))
+	}
+}
@@ -0,0 +1,230 @@
+package spiker
+
+import (
+	"context"
+	"crypto/sha1"
+	"sort"
+	"sync"
+)
+
+// Engine isolated runtime, owns its builtin functions, AST cache and limits,
+// it is safe for concurrent use
+type Engine struct {
+	mu       sync.RWMutex
+	builtins map[string]Func
+	astCache bool
+	cached   sync.Map
+	limits   Limits
+	bytecode bool
+	optimize bool
+	tracer   Tracer
+}
+
+// Option engine option
+type Option func(*Engine)
+
+// WithAstCache enable or disable the AST cache of the engine
+func WithAstCache(enable bool) Option {
+	return func(e *Engine) {
+		e.astCache = enable
+	}
+}
+
+// WithFunc register a builtin function to the engine
+func WithFunc(name string, fn Func) Option {
+	return func(e *Engine) {
+		e.RegisterFunc(name, fn)
+	}
+}
+
+// WithoutBuiltins remove the standard builtin functions from the engine
+func WithoutBuiltins() Option {
+	return func(e *Engine) {
+		e.builtins = make(map[string]Func)
+	}
+}
+
+// default engine, used by the package level functions
+var defaultEngine *Engine
+
+// New return a new Engine with the standard builtin functions
+func New(opts ...Option) *Engine {
+	e := &Engine{
+		builtins: make(map[string]Func),
+		limits:   Limits{MaxCallDepth: DefaultMaxCallDepth},
+	}
+	registerBuiltins(e)
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Limits return the execution resource limits of the engine
+func (e *Engine) Limits() Limits {
+	return e.limits
+}
+
+// Default return the engine used by the package level functions
+func Default() *Engine {
+	return defaultEngine
+}
+
+// RegisterFunc register builtin function to the engine
+func (e *Engine) RegisterFunc(name string, fn Func) {
+	if name == "" || fn == nil {
+		return
+	}
+
+	e.mu.Lock()
+	e.builtins[name] = fn
+	e.mu.Unlock()
+}
+
+// UnregisterFunc remove a builtin function from the engine
+func (e *Engine) UnregisterFunc(name string) {
+	e.mu.Lock()
+	delete(e.builtins, name)
+	e.mu.Unlock()
+}
+
+// Funcs return the names of builtin functions of the engine, sorted
+func (e *Engine) Funcs() []string {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.builtins))
+	for name := range e.builtins {
+		names = append(names, name)
+	}
+	e.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// lookup the builtin function
+func (e *Engine) lookupFunc(name string) (fn Func, ok bool) {
+	e.mu.RLock()
+	fn, ok = e.builtins[name]
+	e.mu.RUnlock()
+	return
+}
+
+// Execute return the computed result of a string expression
+func (e *Engine) Execute(code string) (val interface{}, err error) {
+	ast, err := e.ParseAst(code)
+	if err != nil {
+		return
+	}
+
+	return e.Evaluate(ast)
+}
+
+// ExecuteWithScope return the execute result with scope
+func (e *Engine) ExecuteWithScope(code string, scope *VariableScope) (val interface{}, err error) {
+	ast, err := e.ParseAst(code)
+	if err != nil {
+		return
+	}
+
+	return e.EvaluateWithScope(ast, scope)
+}
+
+// ExecuteContext same as ExecuteWithScope, the execution is interrupted
+// when the context is canceled or its deadline is exceeded
+func (e *Engine) ExecuteContext(ctx context.Context, code string, scope *VariableScope) (val interface{}, err error) {
+	ast, err := e.ParseAst(code)
+	if err != nil {
+		return
+	}
+
+	return e.EvaluateContext(ctx, ast, scope)
+}
+
+// Format return the formatted expression
+func (e *Engine) Format(code string) (s string, err error) {
+	// format the original ast nodes
+	var ast []AstNode
+	if e.optimize {
+		ast, err = parse(code)
+	} else {
+		ast, err = e.ParseAst(code)
+	}
+	if err != nil {
+		return
+	}
+	if len(ast) == 0 {
+		return formatComments(code)
+	}
+
+	return FormatAst(ast)
+}
+
+// ParseAst lexer, statements, transform, and return the ast nodes
+// if the AST cache of engine is enabled, it will cache the ast nodes
+func (e *Engine) ParseAst(code string) (ast []AstNode, err error) {
+	return e.parseAst(code, e.astCache)
+}
+
+func (e *Engine) parseAst(code string, useCache bool) (ast []AstNode, err error) {
+	// get cached ast nodes
+	hashKey := sha1.Sum([]byte(code))
+	if useCache {
+		if ast, ok := e.cached.Load(hashKey); ok {
+			return ast.([]AstNode), nil
+		}
+	}
+
+	ast, err = parse(code)
+	if err != nil {
+		return
+	}
+	if e.optimize {
+		ast = Optimize(ast)
+	}
+
+	// cache ast nodes
+	if useCache {
+		e.cached.Store(hashKey, ast)
+	}
+
+	return
+}
+
+// Evaluate run the expression and evaluate the value
+func (e *Engine) Evaluate(nodeList []AstNode) (res interface{}, err error) {
+	globalScope := NewScopeTable("GLOBAL", 1, nil)
+
+	return e.EvaluateWithScope(nodeList, globalScope)
+}
+
+// EvaluateWithScope same as Evaluate, evaluate with scope
+func (e *Engine) EvaluateWithScope(nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
+	return e.EvaluateContext(context.Background(), nodeList, scope)
+}
+
+// EvaluateContext same as EvaluateWithScope, the evaluation is interrupted
+// when the context is canceled or its deadline is exceeded
+func (e *Engine) EvaluateContext(ctx context.Context, nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
+	if scope == nil {
+		return nil, &RuntimeError{Message: "nil variable scope"}
+	}
+	defer e.bind(ctx, scope)()
+
+	return evaluate(nodeList, scope)
+}
+
+// bind the execution state to the scope, return the function to restore it
+func (e *Engine) bind(ctx context.Context, scope *VariableScope) func() {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	prev := scope.exec
+	scope.exec = &execution{engine: e, ctx: ctx, global: scope, limits: e.limits, tracer: e.tracer}
+
+	return func() {
+		scope.exec = prev
+	}
+}
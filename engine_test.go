@@ -0,0 +1,127 @@
+package spiker_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestEngine_Isolated(t *testing.T) {
+	double := func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		return spiker.Interface2Float64(spiker.EvalExpr(fnc.Params[0], scope)) * 2
+	}
+
+	e1 := spiker.New(spiker.WithFunc("double", double))
+	e2 := spiker.New()
+
+	val, err := e1.Execute(`double(21)`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if val != float64(42) {
+		t.Errorf("Execute() = %v, want %v", val, 42)
+	}
+
+	if _, err := e2.Execute(`double(21)`); err == nil {
+		t.Error("function registered to another engine should be undefined")
+	}
+	if _, err := spiker.Execute(`double(21)`); err == nil {
+		t.Error("function registered to an engine should not leak to the default engine")
+	}
+
+	e1.UnregisterFunc("double")
+	if _, err := e1.Execute(`double(21)`); err == nil {
+		t.Error("unregistered function should be undefined")
+	}
+}
+
+func TestEngine_WithoutBuiltins(t *testing.T) {
+	e := spiker.New(spiker.WithoutBuiltins())
+	if _, err := e.Execute(`len("abc")`); err == nil {
+		t.Error("builtin function should be undefined")
+	}
+}
+
+func TestEngine_Funcs(t *testing.T) {
+	e := spiker.New(spiker.WithFunc("double", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		return nil
+	}))
+	e.UnregisterFunc("print")
+
+	want := []string{"del", "double", "exist", "export", "len"}
+	if got := e.Funcs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Funcs() = %v, want %v", got, want)
+	}
+	if got := spiker.New(spiker.WithoutBuiltins()).Funcs(); len(got) != 0 {
+		t.Errorf("Funcs() = %v, want empty", got)
+	}
+}
+
+func TestEngine_Methods(t *testing.T) {
+	e := spiker.New(spiker.WithAstCache(true))
+
+	scope := spiker.NewScopeTable("engine", 1, nil)
+	scope.Set("a", 3)
+	val, err := e.ExecuteWithScope(`b = a * 2; export(b);`, scope)
+	if err != nil {
+		t.Fatalf("ExecuteWithScope() error = %v", err)
+	}
+	if val != float64(6) {
+		t.Errorf("ExecuteWithScope() = %v, want %v", val, 6)
+	}
+
+	f, err := e.Format(`a=1;b+=2;`)
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	if f != "a = 1;\nb += 2;" {
+		t.Errorf("Format() = %q", f)
+	}
+
+	ast1, err := e.ParseAst(`a + 1`)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+	ast2, _ := e.ParseAst(`a + 1`)
+	if !reflect.DeepEqual(ast1, ast2) || ast1[0] != ast2[0] {
+		t.Error("ParseAst() should return the cached ast nodes")
+	}
+
+	ast3, _ := spiker.New().ParseAst(`a + 1`)
+	if ast1[0] == ast3[0] {
+		t.Error("ParseAst() cache should not be shared between engines")
+	}
+}
+
+func TestEngine_Concurrent(t *testing.T) {
+	e := spiker.New(spiker.WithAstCache(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("fn%d", i)
+			e.RegisterFunc(name, func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+				return i
+			})
+
+			for n := 0; n < 50; n++ {
+				val, err := e.Execute(name + `() + len("abc")`)
+				if err != nil {
+					t.Errorf("Execute() error = %v", err)
+					return
+				}
+				if val != float64(i+3) {
+					t.Errorf("Execute() = %v, want %v", val, i+3)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,150 @@
+package spiker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SyntaxError returned when the code can't be parsed
+type SyntaxError struct {
+	Line    int     // line number, starting at 1
+	Column  int     // column number in characters, starting at 1
+	Offset  int     // byte offset of the code, starting at 0
+	Message string  // error message without position
+	Node    AstNode // the unsupported node, nil if the tokens can't be parsed
+}
+
+// Error .
+func (e *SyntaxError) Error() string {
+	return "syntax error: " + e.Message + position(e.Line, e.Column)
+}
+
+// SyntaxErrors list of syntax errors, in the order of position
+type SyntaxErrors []*SyntaxError
+
+// Error .
+func (l SyntaxErrors) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Is report whether any of the syntax errors matches target, for errors.Is
+func (l SyntaxErrors) Is(target error) bool {
+	for _, e := range l {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As find the first syntax error matches target, for errors.As
+func (l SyntaxErrors) As(target interface{}) bool {
+	for _, e := range l {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuntimeError returned when the evaluation fails
+type RuntimeError struct {
+	Line    int     // line number, starting at 1
+	Column  int     // column number in characters, starting at 1
+	Offset  int     // byte offset of the code, starting at 0
+	Message string  // error message without position
+	Node    AstNode // the node failed to evaluate
+	Err     error   // the underlying error, nil if there is none
+	Stack   string  // stack of the unexpected panic
+}
+
+// Error .
+func (e *RuntimeError) Error() string {
+	msg := "RUNTIME ERROR: " + e.Message + position(e.Line, e.Column)
+	if e.Stack != "" {
+		msg += "\n" + e.Stack
+	}
+	return msg
+}
+
+// Unwrap return the underlying error
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// return the position suffix of error message
+func position(line int, col int) string {
+	if line > 0 {
+		return fmt.Sprintf(" on line %d:%d", line, col)
+	}
+	return ""
+}
+
+// return the start position of node, zero if unknown
+func nodePosition(node AstNode) (line int, col int, offset int) {
+	if node == nil {
+		return
+	}
+	pos := node.Pos()
+	return pos.Line, pos.Column, pos.Offset
+}
+
+// return a SyntaxError at the token
+func newSyntaxError(tok *Token, format string, a ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Line:    tok.line,
+		Column:  tok.col,
+		Offset:  tok.offset,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// return a SyntaxError of the unsupported node
+func nodeSyntaxError(node AstNode, format string, a ...interface{}) *SyntaxError {
+	e := &SyntaxError{Message: fmt.Sprintf(format, a...), Node: node}
+	e.Line, e.Column, e.Offset = nodePosition(node)
+	return e
+}
+
+// convert the error of node to RuntimeError,
+// the error which already has position is returned as it is
+func runtimeError(err error, node AstNode) error {
+	switch e := err.(type) {
+	case *LimitError, *SyntaxError:
+		return err
+
+	case *RuntimeError:
+		// position of the unexpected panic
+		if e.Node == nil && node != nil {
+			e.Node = node
+			e.Line, e.Column, e.Offset = nodePosition(node)
+		}
+		return err
+	}
+	if err == ErrCanceled || err == ErrDeadlineExceeded || err == ErrDebugStopped {
+		return err
+	}
+
+	e := &RuntimeError{
+		Message: strings.TrimPrefix(err.Error(), "RUNTIME ERROR: "),
+		Node:    node,
+		Err:     err,
+	}
+	e.Line, e.Column, e.Offset = nodePosition(node)
+	return e
+}
+
+// describe the token for error message
+func (t *Token) describe() string {
+	if t.sym == SymbolEOF {
+		return "end of code"
+	}
+	return fmt.Sprintf("%q", t.value)
+}
@@ -0,0 +1,143 @@
+package spiker_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		line    int
+		column  int
+		offset  int
+		message string
+	}{
+		{"invalid-char", "a = 1;\nb = 2 @ 3;", 2, 7, 13, `invalid character '@'`},
+		{"invalid-char-unicode", "s = \"中文\"; a = 1 ¥ 2;", 1, 17, 20, `invalid character '¥'`},
+		{"unterminated-string", "a = 1;\n  b = \"abc;", 2, 7, 13, "unterminated string"},
+		{"missing-semicolon", "a = 1;\nb = 2\nc = 3;", 2, 6, 12, `expected ";", but got "c"`},
+		{"missing-rparen", "a = (1;", 1, 7, 6, `expected ")", but got ";"`},
+		{"unexpected", "a = ;", 1, 5, 4, `unexpected ";"`},
+		{"not-operator", "a = 1 2;", 1, 6, 5, `expected ";", but got "2"`},
+		{"missing-block", "if (a) b = 1;", 1, 8, 7, `expected "{", but got "b"`},
+		{"expected-ident", "1 = 2;", 1, 1, 0, `expected identifier, but got "1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := spiker.Execute(tt.code)
+
+			var se *spiker.SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("Execute() error = %#v, want *SyntaxError", err)
+			}
+			if se.Line != tt.line || se.Column != tt.column || se.Offset != tt.offset {
+				t.Errorf("SyntaxError position = %d:%d(%d), want %d:%d(%d)",
+					se.Line, se.Column, se.Offset, tt.line, tt.column, tt.offset)
+			}
+			if se.Message != tt.message {
+				t.Errorf("SyntaxError message = %q, want %q", se.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestSyntaxError_Unsupported(t *testing.T) {
+	_, err := spiker.Compile("a = 1;\nb = [none];")
+
+	var se *spiker.SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("Compile() error = %#v, want *SyntaxError", err)
+	}
+	if se.Line != 2 || se.Node == nil {
+		t.Errorf("SyntaxError = %#v", se)
+	}
+	if se.Error() != "syntax error: unsupported expression on line 2:5" {
+		t.Errorf("SyntaxError.Error() = %q", se.Error())
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		line    int
+		column  int
+		offset  int
+		message string
+	}{
+		{"mod-by-zero", "a = 1;\nb = a % 0;", 2, 5, 11, "integer divide by zero"},
+		{"undefined-offset", "l = [1];\nx = l[2];", 2, 5, 13, "undefined offset 2"},
+		{"nested-call", "f = x -> x % 0;\nf(1);", 1, 10, 9, "integer divide by zero"},
+		{"builtin", "a = 1;\n  b = len(1, 2);", 2, 7, 13, "len() expects 1 parameters, 2 given"},
+		{"call-statement", "len(1, 2);", 1, 1, 0, "len() expects 1 parameters, 2 given"},
+		{"paren", "a = 1;\nb = (a) % 0;", 2, 5, 11, "integer divide by zero"},
+		{"undefined-function", "a = foo(1);", 1, 5, 4, "call to undefined function foo()"},
+	}
+	for _, tt := range tests {
+		for _, bytecode := range []bool{false, true} {
+			p, err := spiker.New(spiker.WithBytecode(bytecode)).Compile(tt.code)
+			if err != nil {
+				t.Fatalf("Compile(%s) error = %v", tt.name, err)
+			}
+			_, err = p.Run(nil)
+
+			var re *spiker.RuntimeError
+			if !errors.As(err, &re) {
+				t.Errorf("Run(%s, bytecode=%v) error = %#v, want *RuntimeError", tt.name, bytecode, err)
+				continue
+			}
+			if re.Line != tt.line || re.Column != tt.column || re.Offset != tt.offset {
+				t.Errorf("Run(%s, bytecode=%v) position = %d:%d(%d), want %d:%d(%d)",
+					tt.name, bytecode, re.Line, re.Column, re.Offset, tt.line, tt.column, tt.offset)
+			}
+			if re.Message != tt.message {
+				t.Errorf("Run(%s, bytecode=%v) message = %q, want %q", tt.name, bytecode, re.Message, tt.message)
+			}
+			if re.Node == nil {
+				t.Errorf("Run(%s, bytecode=%v) node should not be nil", tt.name, bytecode)
+			}
+		}
+	}
+}
+
+func TestRuntimeError_Unwrap(t *testing.T) {
+	errNotFound := errors.New("not found")
+	e := spiker.New(spiker.WithFunc("find", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		panic(errNotFound)
+	}))
+
+	_, err := e.Execute("a = 1;\nfind();")
+	if !errors.Is(err, errNotFound) {
+		t.Fatalf("Execute() error = %v, want %v", err, errNotFound)
+	}
+	var re *spiker.RuntimeError
+	if !errors.As(err, &re) || re.Line != 2 {
+		t.Errorf("Execute() error = %#v", err)
+	}
+}
+
+func TestLimitError_Position(t *testing.T) {
+	e := spiker.New(spiker.WithLimits(spiker.Limits{MaxStringLength: 3}))
+	_, err := e.Execute("a = 1;\ns = \"ab\" + \"cd\";")
+
+	var le *spiker.LimitError
+	if !errors.As(err, &le) {
+		t.Fatalf("Execute() error = %#v, want *LimitError", err)
+	}
+	if le.Line != 2 || le.Column != 5 || le.Offset != 11 {
+		t.Errorf("LimitError position = %d:%d(%d)", le.Line, le.Column, le.Offset)
+	}
+	if le.Message != "max string length 3 exceeded" {
+		t.Errorf("LimitError message = %q", le.Message)
+	}
+
+	// not a RuntimeError
+	var re *spiker.RuntimeError
+	if errors.As(err, &re) {
+		t.Errorf("LimitError should not be a RuntimeError")
+	}
+}
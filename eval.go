@@ -1,38 +1,102 @@
 package spiker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
 )
 
 // Evaluator run the expression and evaluate the value
 func Evaluator(nodeList []AstNode) (res interface{}, err error) {
-	globalScope := NewScopeTable("GLOBAL", 1, nil)
-
-	return EvaluateWithScope(nodeList, globalScope)
+	return defaultEngine.Evaluate(nodeList)
 }
 
 // EvaluateWithScope same as Evaluator, evaluate with scope
 func EvaluateWithScope(nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
+	return defaultEngine.EvaluateWithScope(nodeList, scope)
+}
+
+// ErrCanceled returned when the context of evaluation is canceled
+var ErrCanceled = errors.New("RUNTIME ERROR: execution canceled")
+
+// ErrDeadlineExceeded returned when the context deadline of evaluation is exceeded
+var ErrDeadlineExceeded = errors.New("RUNTIME ERROR: execution deadline exceeded")
+
+// EvaluateContext same as EvaluateWithScope, the evaluation is interrupted
+// when the context is canceled or its deadline is exceeded
+func EvaluateContext(ctx context.Context, nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
+	return defaultEngine.EvaluateContext(ctx, nodeList, scope)
+}
+
+// execution state of a single evaluation
+type execution struct {
+	engine *Engine
+	ctx    context.Context
+	global *VariableScope
+	limits Limits
+	steps  int
+	depth  int
+	debug  *debugSession // nil if not debugging
+	tracer Tracer        // nil if not tracing
+	event  *TraceEvent   // the innermost traced event
+}
+
+// return error if the context is done
+func (ex *execution) checkContext() error {
+	select {
+	case <-ex.ctx.Done():
+		if errors.Is(ex.ctx.Err(), context.DeadlineExceeded) {
+			return ErrDeadlineExceeded
+		}
+		return ErrCanceled
+	default:
+	}
+	return nil
+}
+
+// evaluate the statements, the execution state must be bound to the scope
+func evaluate(nodeList []AstNode, scope *VariableScope) (res interface{}, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			if e, ok := e.(directiveExport); ok {
-				res = e.val
-				return
-			}
-
-			err = fmt.Errorf("%v", e)
+			err = panicError(e)
 		}
 	}()
 
+	ex := scope.exec
 	for _, node := range nodeList {
+		if err = ex.checkContext(); err != nil {
+			return
+		}
+		if err = ex.pause(node, scope); err != nil {
+			return
+		}
+
+		ev := ex.traceEnter(TraceStatement, "", node)
+		c, err := eval(node, scope)
+		ex.traceExit(ev, c.val, err)
+		if err != nil {
+			return res, err
+		}
+
+		switch c.typ {
+		case completionExport:
+			return c.val, nil
+		case completionBreak, completionContinue:
+			return res, nil
+		}
+
 		// store the last expression value
-		v := EvalExpr(node, scope)
-		if v != nil {
-			res = v
+		if c.val != nil {
+			res = c.val
+		}
+		if c.typ == completionReturn {
+			return res, nil
 		}
 	}
 
@@ -40,8 +104,59 @@ func EvaluateWithScope(nodeList []AstNode, scope *VariableScope) (res interface{
 	return
 }
 
-// EvalExpr returns the value of the expression
+// convert the unexpected panic to error, with the stack
+func panicError(e interface{}) error {
+	err, _ := e.(error)
+	return &RuntimeError{
+		Message: fmt.Sprintf("panic: %v", e),
+		Err:     err,
+		Stack:   string(debug.Stack()),
+	}
+}
+
+// EvalExpr returns the value of the expression, for builtin functions.
+// The error and abrupt completion unwind the builtin function,
+// they are recovered by the function call
 func EvalExpr(node AstNode, scope *VariableScope) interface{} {
+	c, err := eval(node, scope)
+	if err != nil {
+		panic(err)
+	}
+	if c.abrupt() {
+		panic(c)
+	}
+	return c.val
+}
+
+// eval evaluate the node, return the completion record
+func eval(node AstNode, scope *VariableScope) (completion, error) {
+	ex := scope.execution()
+	if err := ex.step(node); err != nil {
+		return completion{}, err
+	}
+
+	c, err := evalNode(node, scope)
+	if err != nil {
+		return c, runtimeError(err, node)
+	}
+	if c.abrupt() {
+		return c, nil
+	}
+
+	switch node.(type) {
+	case *NodeVariable, *NodeVarIndex:
+		// read an existing value
+	default:
+		if err := ex.checkValue(node, c.val); err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
+
+// dispatch the node to its evaluation
+func evalNode(node AstNode, scope *VariableScope) (completion, error) {
 	switch node := node.(type) {
 	case *NodeAssignOp:
 		return evalAssign(node, scope)
@@ -53,16 +168,16 @@ func EvalExpr(node AstNode, scope *VariableScope) interface{} {
 		return evalBinary(node, scope)
 
 	case *NodeVariable:
-		return evalVariable(node, scope)
+		return normal(evalVariable(node, scope)), nil
 
 	case *NodeNumber:
-		return node.Value
+		return normal(node.Value), nil
 
 	case *NodeString:
-		return node.Value
+		return normal(node.Value), nil
 
 	case *NodeBool:
-		return node.Value
+		return normal(node.Value), nil
 
 	case *NodeList:
 		return evalList(node, scope)
@@ -87,7 +202,7 @@ func EvalExpr(node AstNode, scope *VariableScope) interface{} {
 
 	}
 
-	return nil
+	return normal(nil), nil
 }
 
 // return the variable value from scope
@@ -99,69 +214,97 @@ func evalVariable(expr *NodeVariable, scope *VariableScope) interface{} {
 }
 
 // init the map value
-func evalMap(expr *NodeMap, scope *VariableScope) interface{} {
+func evalMap(expr *NodeMap, scope *VariableScope) (completion, error) {
 	dict := make(ValueMap)
 	for idx, val := range expr.Map {
-		dict[Interface2String(EvalExpr(idx, scope))] = EvalExpr(val, scope)
+		k, err := eval(idx, scope)
+		if err != nil || k.abrupt() {
+			return k, err
+		}
+		v, err := eval(val, scope)
+		if err != nil || v.abrupt() {
+			return v, err
+		}
+		dict[Interface2String(k.val)] = v.val
 	}
-	return dict
+	return normal(dict), nil
 }
 
 // init the list value
-func evalList(expr *NodeList, scope *VariableScope) interface{} {
+func evalList(expr *NodeList, scope *VariableScope) (completion, error) {
 	list := make(ValueList, 0)
 	for _, sub := range expr.List {
-		list = append(list, EvalExpr(sub, scope))
+		c, err := eval(sub, scope)
+		if err != nil || c.abrupt() {
+			return c, err
+		}
+		list = append(list, c.val)
 	}
-	return list
+	return normal(list), nil
 }
 
 // assign and return a value
-func evalAssign(expr *NodeAssignOp, scope *VariableScope) interface{} {
+func evalAssign(expr *NodeAssignOp, scope *VariableScope) (completion, error) {
 	name := expr.Var.Value
-	exprVal := EvalExpr(expr.Expr, scope)
+	c, err := eval(expr.Expr, scope)
+	if err != nil || c.abrupt() {
+		return c, err
+	}
 	initVal, ok := scope.Get(name) // original value
+
+	val, err := calcAssign(expr.Op, initVal, ok, c.val)
+	if err != nil {
+		return completion{}, err
+	}
+	scope.set(name, val)
+
+	return normal(val), nil
+}
+
+// return the new value of assignment
+// `exists` means the variable has the original value
+func calcAssign(symbol Symbol, initVal interface{}, exists bool, exprVal interface{}) (interface{}, error) {
 	// initial value
-	if !ok {
+	if !exists {
 		initVal = 0
 		// string concat
-		if expr.Op == SymbolAssignAdd && !IsNumber(Interface2String(exprVal)) {
+		if symbol == SymbolAssignAdd && !IsNumber(Interface2String(exprVal)) {
 			initVal = ""
 		}
 	}
 
-	switch expr.Op {
-	case SymbolAssign:
-		scope.Set(name, exprVal)
-
+	switch symbol {
 	case SymbolAssignAdd:
-		scope.Set(name, calcMath(SymbolAdd, initVal, exprVal))
+		return calcMath(SymbolAdd, initVal, exprVal)
 
 	case SymbolAssignSub:
-		scope.Set(name, calcMath(SymbolSub, initVal, exprVal))
+		return calcMath(SymbolSub, initVal, exprVal)
 
 	case SymbolAssignMul:
-		scope.Set(name, calcMath(SymbolMul, initVal, exprVal))
+		return calcMath(SymbolMul, initVal, exprVal)
 
 	case SymbolAssignDiv:
-		scope.Set(name, calcMath(SymbolDiv, initVal, exprVal))
+		return calcMath(SymbolDiv, initVal, exprVal)
 
 	case SymbolAssignMod:
-		scope.Set(name, calcMath(SymbolMod, initVal, exprVal))
+		return calcMath(SymbolMod, initVal, exprVal)
 	}
 
-	if val, ok := scope.Get(name); ok {
-		return val
-	}
-
-	return nil
+	return exprVal, nil
 }
 
 // evalUnary unary operation
-func evalUnary(expr *NodeUnaryOp, scope *VariableScope) interface{} {
-	right := EvalExpr(expr.Right, scope)
+func evalUnary(expr *NodeUnaryOp, scope *VariableScope) (completion, error) {
+	c, err := eval(expr.Right, scope)
+	if err != nil || c.abrupt() {
+		return c, err
+	}
+	return normal(calcUnary(expr.Op, c.val)), nil
+}
 
-	switch expr.Op {
+// unary calculation
+func calcUnary(symbol Symbol, right interface{}) interface{} {
+	switch symbol {
 	case SymbolLogicNot:
 		return !IsTrue(right)
 
@@ -177,29 +320,41 @@ func evalUnary(expr *NodeUnaryOp, scope *VariableScope) interface{} {
 }
 
 // evalBinary binary operator
-func evalBinary(expr *NodeBinaryOp, scope *VariableScope) interface{} {
-	left := EvalExpr(expr.Left, scope)
-	right := EvalExpr(expr.Right, scope)
+func evalBinary(expr *NodeBinaryOp, scope *VariableScope) (completion, error) {
+	left, err := eval(expr.Left, scope)
+	if err != nil || left.abrupt() {
+		return left, err
+	}
+	right, err := eval(expr.Right, scope)
+	if err != nil || right.abrupt() {
+		return right, err
+	}
 
-	switch expr.Op {
+	val, err := calcBinary(expr.Op, left.val, right.val)
+	return normal(val), err
+}
+
+// binary calculation
+func calcBinary(symbol Symbol, left interface{}, right interface{}) (interface{}, error) {
+	switch symbol {
 	case SymbolAdd, SymbolSub, SymbolMul, SymbolDiv, SymbolMod, SymbolPow,
 		SymbolAnd, SymbolOr, SymbolXor, SymbolSHR, SymbolSHL:
-		return calcMath(expr.Op, left, right)
+		return calcMath(symbol, left, right)
 
 	case SymbolLogicAnd:
-		return IsTrue(left) && IsTrue(right)
+		return IsTrue(left) && IsTrue(right), nil
 
 	case SymbolLogicOr:
-		return IsTrue(left) || IsTrue(right)
+		return IsTrue(left) || IsTrue(right), nil
 
 	case SymbolEQL, SymbolNEQ, SymbolGTR, SymbolGTE, SymbolLSS, SymbolLTE:
-		return calcComparison(expr.Op, left, right)
+		return calcComparison(symbol, left, right), nil
 
 	case SymbolIn:
-		return calcIn(left, right)
+		return calcIn(left, right), nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 // report whether element is within a value
@@ -232,9 +387,22 @@ func calcIn(elem interface{}, set interface{}) bool {
 }
 
 // mathematical calculation
-func calcMath(symbol Symbol, left interface{}, right interface{}) interface{} {
-	bigLeft := new(big.Float).SetFloat64(Interface2Float64(left))
-	bigRight := new(big.Float).SetFloat64(Interface2Float64(right))
+func calcMath(symbol Symbol, left interface{}, right interface{}) (interface{}, error) {
+	// fast path for the finite numbers
+	if l, ok := finiteNumber(left); ok {
+		if r, ok := finiteNumber(right); ok {
+			if val, ok := calcNumber(symbol, l, r); ok {
+				return val, nil
+			}
+		}
+	}
+
+	leftFloat, rightFloat := Interface2Float64(left), Interface2Float64(right)
+	if math.IsNaN(leftFloat) || math.IsNaN(rightFloat) {
+		return nil, errors.New("invalid operation on NaN")
+	}
+	bigLeft := new(big.Float).SetFloat64(leftFloat)
+	bigRight := new(big.Float).SetFloat64(rightFloat)
 
 	leftString := Interface2String(left)
 	rightString := Interface2String(right)
@@ -244,293 +412,542 @@ func calcMath(symbol Symbol, left interface{}, right interface{}) interface{} {
 	isNumberExpr := leftErr == nil && rightErr == nil && IsNumber(leftString) && IsNumber(rightString)
 
 	var bigNumber *big.Float
+	var err error
 	switch symbol {
 	case SymbolAdd:
 		if !isNumberExpr {
 			// concat string
-			return Interface2String(left) + Interface2String(right)
+			return Interface2String(left) + Interface2String(right), nil
 		}
 
 		// number addition
-		bigNumber = new(big.Float).Add(bigLeft, bigRight)
+		bigNumber, err = bigCalc(new(big.Float).Add, bigLeft, bigRight)
 
 	case SymbolSub:
-		bigNumber = new(big.Float).Sub(bigLeft, bigRight)
+		bigNumber, err = bigCalc(new(big.Float).Sub, bigLeft, bigRight)
 
 	case SymbolMul:
-		bigNumber = new(big.Float).Mul(bigLeft, bigRight)
+		bigNumber, err = bigCalc(new(big.Float).Mul, bigLeft, bigRight)
 
 	case SymbolDiv:
-		if bigRight == new(big.Float).SetFloat64(0) {
-			panic("RUNTIME ERROR: division by zero")
-		}
-		bigNumber = new(big.Float).Quo(bigLeft, bigRight)
+		bigNumber, err = bigCalc(new(big.Float).Quo, bigLeft, bigRight)
 
 	case SymbolMod:
-		return int(leftNumber) % int(rightNumber)
+		if int(rightNumber) == 0 {
+			return nil, errors.New("integer divide by zero")
+		}
+		return int(leftNumber) % int(rightNumber), nil
 
 	case SymbolPow:
-		return math.Pow(leftNumber, rightNumber)
+		return math.Pow(leftNumber, rightNumber), nil
 
 	case SymbolAnd:
-		return int(leftNumber) & int(rightNumber)
+		return int(leftNumber) & int(rightNumber), nil
 
 	case SymbolOr:
-		return int(leftNumber) | int(rightNumber)
+		return int(leftNumber) | int(rightNumber), nil
 
 	case SymbolXor:
-		return int(leftNumber) ^ int(rightNumber)
+		return int(leftNumber) ^ int(rightNumber), nil
 
 	case SymbolSHR:
-		return int(leftNumber) >> int(rightNumber)
+		if int(rightNumber) < 0 {
+			return nil, errors.New("negative shift amount")
+		}
+		return int(leftNumber) >> int(rightNumber), nil
 
 	case SymbolSHL:
-		return int(leftNumber) << int(rightNumber)
+		if int(rightNumber) < 0 {
+			return nil, errors.New("negative shift amount")
+		}
+		return int(leftNumber) << int(rightNumber), nil
 	}
 
-	if bigNumber != nil {
+	if err != nil {
+		return nil, err
+	} else if bigNumber != nil {
 		res, _ := strconv.ParseFloat(bigNumber.String(), 64)
-		return res
+		return res, nil
 	} else if isNumberExpr {
-		return 0
+		return 0, nil
+	}
+
+	return "", nil
+}
+
+// big float operation, return the big.ErrNaN as error
+func bigCalc(op func(x, y *big.Float) *big.Float, x, y *big.Float) (res *big.Float, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			nan, ok := e.(big.ErrNaN)
+			if !ok {
+				panic(e)
+			}
+			err = nan
+		}
+	}()
+
+	return op(x, y), nil
+}
+
+// same as calcMath, but only for finite numbers,
+// report false if the result may be different from the big float calculation
+func calcNumber(symbol Symbol, left float64, right float64) (interface{}, bool) {
+	var res float64
+	switch symbol {
+	case SymbolAdd:
+		res = left + right
+
+	case SymbolSub:
+		res = left - right
+
+	case SymbolMul:
+		res = left * right
+		if isUnderflow(res) || (res == 0 && left != 0 && right != 0) {
+			return nil, false
+		}
+
+	case SymbolDiv:
+		if right == 0 {
+			return nil, false
+		}
+		res = left / right
+		if isUnderflow(res) || (res == 0 && left != 0) {
+			return nil, false
+		}
+
+	case SymbolMod:
+		if int(right) == 0 {
+			return nil, false
+		}
+		return int(left) % int(right), true
+
+	case SymbolPow:
+		return math.Pow(left, right), true
+
+	case SymbolAnd:
+		return int(left) & int(right), true
+
+	case SymbolOr:
+		return int(left) | int(right), true
+
+	case SymbolXor:
+		return int(left) ^ int(right), true
+
+	case SymbolSHR:
+		if int(right) < 0 {
+			return nil, false
+		}
+		return int(left) >> int(right), true
+
+	case SymbolSHL:
+		if int(right) < 0 {
+			return nil, false
+		}
+		return int(left) << int(right), true
+
+	default:
+		return nil, false
 	}
 
-	return ""
+	// integer of at most 10 digits is exact, no need to round
+	if math.Abs(res) < 1e10 && res == math.Trunc(res) {
+		return res, true
+	}
+
+	// same precision as big.Float.String()
+	res, _ = strconv.ParseFloat(strconv.FormatFloat(res, 'g', 10, 64), 64)
+	return res, true
+}
+
+// the result is a subnormal number
+func isUnderflow(f float64) bool {
+	return f != 0 && math.Abs(f) < 0x1p-1022
+}
+
+// return the float64 of the finite number value
+func finiteNumber(val interface{}) (float64, bool) {
+	switch val := val.(type) {
+	case float64:
+		return val, !math.IsInf(val, 0) && !math.IsNaN(val)
+	case int:
+		return float64(val), true
+	}
+	return 0, false
 }
 
 // compare two value
 func calcComparison(symbol Symbol, left interface{}, right interface{}) bool {
+	// fast path for the finite numbers
+	if l, ok := finiteNumber(left); ok {
+		if r, ok := finiteNumber(right); ok {
+			return compareNumber(symbol, l, r)
+		}
+	}
+
 	leftString := Interface2String(left)
 	rightString := Interface2String(right)
 	leftNumber, leftErr := ParseNumber(leftString)
 	rightNumber, rightErr := ParseNumber(rightString)
 	isNumberExpr := leftErr == nil && rightErr == nil && IsNumber(leftString) && IsNumber(rightString)
 
+	if isNumberExpr {
+		return compareNumber(symbol, leftNumber, rightNumber)
+	}
+
 	switch symbol {
 	case SymbolEQL:
-		if isNumberExpr {
-			return leftNumber == rightNumber
-		}
 		return leftString == rightString
 	case SymbolNEQ:
-		if isNumberExpr {
-			return leftNumber != rightNumber
-		}
 		return leftString != rightString
 	case SymbolGTR:
-		if isNumberExpr {
-			return leftNumber > rightNumber
-		}
 		return leftString > rightString
 	case SymbolGTE:
-		if isNumberExpr {
-			return leftNumber >= rightNumber
-		}
 		return leftString >= rightString
 	case SymbolLSS:
-		if isNumberExpr {
-			return leftNumber < rightNumber
-		}
 		return leftString < rightString
 	case SymbolLTE:
-		if isNumberExpr {
-			return leftNumber <= rightNumber
-		}
 		return leftString <= rightString
 	}
 
 	return false
 }
 
+// compare two number
+func compareNumber(symbol Symbol, left float64, right float64) bool {
+	switch symbol {
+	case SymbolEQL:
+		return left == right
+	case SymbolNEQ:
+		return left != right
+	case SymbolGTR:
+		return left > right
+	case SymbolGTE:
+		return left >= right
+	case SymbolLSS:
+		return left < right
+	case SymbolLTE:
+		return left <= right
+	}
+
+	return false
+}
+
 // function call
-func evalFuncCall(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
-	// custom function
-	if fnd, ok := scope.Get("_custom_func_" + fnc.Name.Value); ok {
+func evalFuncCall(fnc *NodeFuncCallOp, scope *VariableScope) (completion, error) {
+	ex := scope.execution()
+
+	// custom function, fallback to the global scope for recursion
+	fnd, ok := scope.Get("_custom_func_" + fnc.Name.Value)
+	if !ok && ex.global != nil {
+		fnd, ok = ex.global.Get("_custom_func_" + fnc.Name.Value)
+	}
+	if ok {
 		if fn, ok := fnd.(*NodeFuncDef); ok {
 			return execCustomFunc(fnc, fn, scope)
 		}
 	}
 
 	// builtin function
+	if bfn, ok := ex.engine.lookupFunc(fnc.Name.Value); ok {
+		if err := ex.checkContext(); err != nil {
+			return completion{}, err
+		}
+		ev := ex.traceEnter(TraceBuiltin, fnc.Name.Value, fnc)
+		c, err := callBuiltin(fnc, bfn, scope)
+		ex.traceExit(ev, c.val, err)
+		return c, err
+	}
+	return completion{}, fmt.Errorf("call to undefined function %s()", fnc.Name.Value)
+}
+
+// call the builtin function with a local scope,
+// recover the error and abrupt completion unwinding it
+func callBuiltin(fnc *NodeFuncCallOp, bfn Func, scope *VariableScope) (c completion, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			switch e := e.(type) {
+			case completion:
+				c = e
+			case error:
+				if _, ok := e.(runtime.Error); ok {
+					err = panicError(e)
+					return
+				}
+				err = e
+			case string:
+				// builtin function reports error by panic
+				err = errors.New(e)
+			default:
+				err = panicError(e)
+			}
+		}
+	}()
+
 	localScope := NewScopeTable("builtin_func_"+fnc.Name.Value, scope.scopeLevel+1, scope)
-	if bfn, ok := builtinMap[fnc.Name.Value]; ok {
-		return bfn(fnc, localScope)
+	val, err := ToValue(bfn(fnc, localScope))
+	if err != nil {
+		return completion{}, err
 	}
-	panic(fmt.Sprintf("call to undefined function %s()", fnc.Name.Value))
+	return normal(val), nil
 }
 
 // register function declare
 func evalFuncDef(fnd *NodeFuncDef, scope *VariableScope) {
-	scope.Set("_custom_func_"+fnd.Name.Value, fnd)
+	scope.set("_custom_func_"+fnd.Name.Value, fnd)
 }
 
 // exec custom function
-func execCustomFunc(fnc *NodeFuncCallOp, fnd *NodeFuncDef, scope *VariableScope) (val interface{}) {
+func execCustomFunc(fnc *NodeFuncCallOp, fnd *NodeFuncDef, scope *VariableScope) (completion, error) {
+	ex := scope.execution()
+	if err := ex.checkContext(); err != nil {
+		return completion{}, err
+	}
+	if err := ex.enterCall(fnc); err != nil {
+		return completion{}, err
+	}
+	defer ex.leaveCall()
+
 	if len(fnc.Params) != len(fnd.Params) {
-		panic(fmt.Sprintf(
+		return completion{}, fmt.Errorf(
 			"%s() expects at least %d parameters, %d given",
-			fnc.Name.Value, len(fnd.Params), len(fnc.Params)),
+			fnc.Name.Value, len(fnd.Params), len(fnc.Params),
 		)
 	}
 
 	localScope := NewScopeTable("custom_func_"+fnc.Name.Value, scope.scopeLevel+1, nil)
+	localScope.exec = scope.exec
 	for i, p := range fnc.Params {
-		localScope.Set(fnd.Params[i].Name.Value, EvalExpr(p, scope))
+		c, err := eval(p, scope)
+		if err != nil || c.abrupt() {
+			return c, err
+		}
+		localScope.set(fnd.Params[i].Name.Value, c.val)
 	}
 
-	// before return, recover `return` statement
-	defer func() {
-		if e := recover(); e != nil {
-			if e, ok := e.(directiveReturn); ok {
-				val = e.val
-				return
-			}
-			panic(e)
-		}
-	}()
+	if ex.debug != nil {
+		ex.debug.enter(fnc, localScope)
+		defer ex.debug.leave()
+	}
 
 	// eval body statements
-	val = evalStmts(fnd.Body, localScope, true)
+	ev := ex.traceEnter(TraceFunc, fnc.Name.Value, fnc)
+	c, err := evalStmts(fnd.Body, localScope, true)
+	ex.traceExit(ev, c.val, err)
+	if err != nil || c.typ == completionExport {
+		return c, err
+	}
 
-	return
+	// return/break/continue end the function
+	return normal(c.val), nil
 }
 
 // return the index value
-func evalVarIndex(vi *NodeVarIndex, scope *VariableScope) interface{} {
-	varVal := EvalExpr(vi.Var, scope)
+func evalVarIndex(vi *NodeVarIndex, scope *VariableScope) (completion, error) {
+	c, err := eval(vi.Var, scope)
+	if err != nil || c.abrupt() {
+		return c, err
+	}
+	if !isIndexable(c.val) {
+		return normal(nil), nil
+	}
+
+	index, err := eval(vi.Index, scope)
+	if err != nil || index.abrupt() {
+		return index, err
+	}
+
+	val, err := calcIndex(c.val, index.val)
+	return normal(val), err
+}
+
+// report whether the value supports index
+func isIndexable(val interface{}) bool {
+	switch val.(type) {
+	case string, float64, int, ValueList, ValueMap:
+		return true
+	}
+	return false
+}
+
+// return the value of the specified index
+func calcIndex(varVal interface{}, index interface{}) (interface{}, error) {
 	switch varVal := varVal.(type) {
 	case string:
-		idx := int(EvalExpr(vi.Index, scope).(float64))
+		idx, err := indexNumber(index)
+		if err != nil {
+			return nil, err
+		}
 		r := []rune(varVal)
 		if len(r) > idx {
-			return string(r[idx])
+			return string(r[idx]), nil
 		}
-		panic(fmt.Sprintf("RUNTIME ERROR: undefined offset %d", idx))
+		return nil, fmt.Errorf("undefined offset %d", idx)
 
 	case float64:
-		idx := int(EvalExpr(vi.Index, scope).(float64))
+		idx, err := indexNumber(index)
+		if err != nil {
+			return nil, err
+		}
 		r := strconv.FormatFloat(varVal, 'f', -1, 64)
 		if len(r) > idx {
-			return r[idx]
+			return r[idx], nil
 		}
-		panic(fmt.Sprintf("RUNTIME ERROR: undefined offset %d", idx))
+		return nil, fmt.Errorf("undefined offset %d", idx)
 
 	case int:
-		idx := int(EvalExpr(vi.Index, scope).(float64))
+		idx, err := indexNumber(index)
+		if err != nil {
+			return nil, err
+		}
 		r := strconv.Itoa(varVal)
 		if len(r) > idx {
-			return r[idx]
+			return r[idx], nil
 		}
-		panic(fmt.Sprintf("RUNTIME ERROR: undefined offset %d", idx))
+		return nil, fmt.Errorf("undefined offset %d", idx)
 
 	case ValueList:
-		idx := int(EvalExpr(vi.Index, scope).(float64))
+		idx, err := indexNumber(index)
+		if err != nil {
+			return nil, err
+		}
 		r := varVal
 		if len(r) > idx {
-			return r[idx]
+			return r[idx], nil
 		}
-		panic(fmt.Sprintf("RUNTIME ERROR: undefined offset %d", idx))
+		return nil, fmt.Errorf("undefined offset %d", idx)
 
 	case ValueMap:
-		idx := Interface2String(EvalExpr(vi.Index, scope))
+		idx := Interface2String(index)
 		r := varVal
 		if val, ok := r[idx]; ok {
-			return val
+			return val, nil
 		}
-		panic(fmt.Sprintf("RUNTIME ERROR: undefined offset %s", idx))
+		return nil, fmt.Errorf("undefined offset %s", idx)
 	}
 
-	return nil
+	return nil, nil
+}
+
+// return the offset of list/string index
+func indexNumber(index interface{}) (int, error) {
+	idx, ok := index.(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid offset %s", Interface2String(index))
+	}
+	if int(idx) < 0 {
+		return 0, fmt.Errorf("undefined offset %d", int(idx))
+	}
+	return int(idx), nil
 }
 
 // if-else statement
-func evalIfStmt(expr *NodeIf, scope *VariableScope) (val interface{}) {
+func evalIfStmt(expr *NodeIf, scope *VariableScope) (completion, error) {
 	if expr.Expr == nil {
-		return
+		return normal(nil), nil
+	}
+
+	c, err := eval(expr.Expr, scope)
+	if err != nil || c.abrupt() {
+		return c, err
 	}
 
-	if IsTrue(EvalExpr(expr.Expr, scope)) {
-		val = evalStmts(expr.Body, scope, false)
+	if IsTrue(c.val) {
+		return evalStmts(expr.Body, scope, false)
 	} else if expr.ElseIf != nil {
 		return evalIfStmt(expr.ElseIf, scope)
-	} else {
-		val = evalStmts(expr.Else, scope, false)
 	}
-
-	return
+	return evalStmts(expr.Else, scope, false)
 }
 
-// while statement
-func evalWhileStmt(expr *NodeWhile, scope *VariableScope) (val interface{}) {
+// while statement, return the value of the last iteration
+func evalWhileStmt(expr *NodeWhile, scope *VariableScope) (completion, error) {
 	if expr.Expr == nil {
-		return
-	}
-
-	for IsTrue(EvalExpr(expr.Expr, scope)) {
-		var brk Symbol
-		brk, val = func() (brk Symbol, val interface{}) {
-			defer func() {
-				if e := recover(); e != nil {
-					switch e.(type) {
-					case directiveContinue:
-						brk = SymbolContinue
-					case directiveBreak:
-						brk = SymbolBreak
-					default:
-						panic(e)
-					}
-				}
-			}()
+		return normal(nil), nil
+	}
 
-			val = evalStmts(expr.Body, scope, false)
-			return
-		}()
+	ex := scope.execution()
+	var val interface{}
+	for {
+		cond, err := eval(expr.Expr, scope)
+		if err != nil || cond.abrupt() {
+			return cond, err
+		}
+		if !IsTrue(cond.val) {
+			break
+		}
+		if err := ex.checkContext(); err != nil {
+			return completion{}, err
+		}
+
+		c, err := evalStmts(expr.Body, scope, false)
+		if err != nil {
+			return c, err
+		}
 
-		if brk == SymbolContinue {
+		switch c.typ {
+		case completionBreak:
+			return normal(nil), nil
+		case completionContinue:
+			val = nil
 			continue
-		} else if brk == SymbolBreak {
-			break
+		case completionReturn, completionExport:
+			return c, nil
 		}
+		val = c.val
 	}
 
-	return
+	return normal(val), nil
 }
 
-// eval statements, with return/break/continue
-// `isf` means function not support break/continue
-func evalStmts(nodes []AstNode, scope *VariableScope, isf bool) (val interface{}) {
+// eval statements, the abrupt completion interrupts them
+// `isf` means function body, break/continue have no effect
+func evalStmts(nodes []AstNode, scope *VariableScope, isf bool) (c completion, err error) {
+	ex := scope.execution()
 	for _, node := range nodes {
-		val = EvalExpr(node, scope)
+		if err = ex.pause(node, scope); err != nil {
+			return
+		}
+		ev := ex.traceEnter(TraceStatement, "", node)
+		c, err = evalStmt(node, scope, isf)
+		ex.traceExit(ev, c.val, err)
+		if err != nil || c.abrupt() {
+			return
+		}
+	}
 
-		switch node := node.(type) {
-		case *NodeReturn: // return
-			var ret = directiveReturn{
-				hasVal: true,
-			}
-			var tuples []interface{}
-			for _, a := range node.Tuples {
-				tuples = append(tuples, EvalExpr(a, scope))
-			}
-			if len(tuples) == 0 {
-				ret.hasVal = false
-			} else if len(tuples) == 1 {
-				ret.val = tuples[0]
-			} else {
-				ret.val = tuples
-			}
-			panic(ret)
+	return
+}
 
-		case *NodeBreak: // break
-			if !isf {
-				panic(directiveBreak{})
-			}
+// eval a statement of block
+func evalStmt(node AstNode, scope *VariableScope, isf bool) (completion, error) {
+	c, err := eval(node, scope)
+	if err != nil || c.abrupt() {
+		return c, err
+	}
 
-		case *NodeContinue: // continue
-			if !isf {
-				panic(directiveContinue{})
+	switch node := node.(type) {
+	case *NodeReturn: // return
+		var tuples []interface{}
+		for _, a := range node.Tuples {
+			t, err := eval(a, scope)
+			if err != nil || t.abrupt() {
+				return t, err
 			}
+			tuples = append(tuples, t.val)
+		}
+		return completion{typ: completionReturn, val: tupleValue(tuples)}, nil
+
+	case *NodeBreak: // break
+		if !isf {
+			return completion{typ: completionBreak}, nil
+		}
+
+	case *NodeContinue: // continue
+		if !isf {
+			return completion{typ: completionContinue}, nil
 		}
 	}
 
-	return
+	return c, nil
 }
@@ -1,7 +1,13 @@
 package spiker_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/shockerli/spiker"
 )
@@ -70,3 +76,189 @@ func TestEvaluateWithScope(t *testing.T) {
 		}
 	}
 }
+
+func TestEvaluate_CustomFunc(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want interface{}
+	}{
+		{"recursion", "fact = n -> {\n    if (n <= 1) {\n        return 1;\n    }\n    return n * fact(n - 1);\n};\nfact(5);", float64(120)},
+		{"call-global", "inc = x -> x + 1;\ntwice = x -> inc(inc(x));\ntwice(1);", float64(3)},
+		{"local-shadows-global", "g = x -> x;\nf = x -> {\n    g = y -> y * 10;\n    return g(x);\n};\nf(2);", float64(20)},
+		{"local-not-leaked", "f = x -> {\n    h = y -> y;\n    return x;\n};\nf(1);\nexist(h);", false},
+	}
+
+	for _, tt := range tests {
+		got, err := spiker.Execute(tt.code)
+		if err != nil {
+			t.Errorf("%q. Execute() error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q. Execute() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{"canceled-while", `while (true) { a = 1; }`, func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			return ctx, cancel
+		}, spiker.ErrCanceled},
+		{"deadline-while", `while (true) { a = 1; }`, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}, spiker.ErrDeadlineExceeded},
+		{"deadline-func", `f = x -> x + 1; while (true) { f(1); }`, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}, spiker.ErrDeadlineExceeded},
+		{"canceled-before", `a = 1;`, func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, spiker.ErrCanceled},
+		{"not-canceled", `a = 1;`, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Minute)
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			scope := spiker.NewScopeTable("ctx", 1, nil)
+			_, err := spiker.ExecuteContext(ctx, tt.code, scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExecuteContext() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateContext_Builtin(t *testing.T) {
+	e := spiker.New(spiker.WithFunc("wait", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		<-scope.Context().Done()
+		return "done"
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	val, err := e.ExecuteContext(ctx, `wait()`, spiker.NewScopeTable("ctx", 1, nil))
+	if err != nil {
+		t.Fatalf("ExecuteContext() error = %v", err)
+	}
+	if val != "done" {
+		t.Errorf("ExecuteContext() = %v, want %v", val, "done")
+	}
+}
+
+func TestEvaluate_Completion(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		want    interface{}
+		wantErr string
+	}{
+		{"return-in-if", `a = 1; if (a) { return a + 1; } a = 3;`, float64(2), ""},
+		{"return-in-while", `i = 0; while (true) { i += 1; if (i > 2) { return i; } } i = 10;`, float64(3), ""},
+		{"break-out-of-loop", `a = 1; if (a) { break; } a = 2;`, float64(1), ""},
+		{"break-in-func", `
+f = () -> {
+    if (true) {
+        break;
+    }
+    return 1;
+};
+i = 0;
+while (i < 3) {
+    i += 1;
+    f();
+}
+export(i);`, float64(3), ""},
+		{"export-in-func", `f = x -> { export(x * 2); return 1; }; f(3) + 1;`, float64(6), ""},
+		{"export-in-param", `a = len(export(5));`, float64(5), ""},
+		{"error-in-param", `l = [1]; a = len(l[2]);`, nil, "RUNTIME ERROR: undefined offset 2 on line 1:18"},
+		{"mod-by-zero", `a = 1 % 0;`, nil, "RUNTIME ERROR: integer divide by zero on line 1:5"},
+		{"invalid-offset", `l = [1]; a = l["a"];`, nil, "RUNTIME ERROR: invalid offset a on line 1:14"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spiker.Execute(tt.code)
+			if (err != nil || tt.wantErr != "") && fmt.Sprint(err) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate_BuiltinPanic(t *testing.T) {
+	e := spiker.New(
+		spiker.WithFunc("crash", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+			var list []int
+			return list[len(fnc.Params)]
+		}),
+		spiker.WithFunc("fail", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+			panic("fail() always fails")
+		}),
+	)
+
+	_, err := e.Execute(`a = 1; crash();`)
+	if err == nil {
+		t.Fatal("Execute() should return error")
+	}
+	if !strings.HasPrefix(err.Error(), "RUNTIME ERROR: panic: runtime error: index out of range") {
+		t.Errorf("Execute() error = %v", err)
+	}
+	// keep the stack of panic
+	if !strings.Contains(err.Error(), "eval_test.go") {
+		t.Errorf("Execute() error should contain the stack: %v", err)
+	}
+
+	_, err = e.Execute(`fail();`)
+	if err == nil || err.Error() != "RUNTIME ERROR: fail() always fails on line 1:1" {
+		t.Errorf("Execute() error = %v", err)
+	}
+}
+
+func BenchmarkEvaluate_While(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		code string
+	}{
+		{"plain", `i = 0; while (i < 1000) { i += 1; }`},
+		{"continue", `i = 0; while (i < 1000) { i += 1; continue; }`},
+		{"break", `i = 0; while (i < 1000) { j = 0; while (true) { break; } i += 1; }`},
+		{"return", `f = x -> { return x + 1; }; i = 0; while (i < 1000) { i = f(i); }`},
+	}
+
+	for _, bm := range benchmarks {
+		ast, err := spiker.ParseAst(bm.code)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bm.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := spiker.Evaluator(ast); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
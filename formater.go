@@ -2,32 +2,450 @@ package spiker
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 const indentStep = "    "
 
+// FormatOptions the options of formatter, the zero value is same as Format
+type FormatOptions struct {
+	Indent           string // the indent of block, default is 4 spaces
+	MaxLineWidth     int    // break the long list, map and call arguments across lines, 0 is unlimited
+	PreserveMapOrder bool   // keep the entries of map in the order of source, default is sorted by key
+	MinimalParens    bool   // only keep the parentheses required by the binding powers of operators
+	TrailingCommas   bool   // add comma after the last item of list and map broken across lines
+}
+
+// FormatWithOptions return the formatted expression with options
+func FormatWithOptions(code string, opts FormatOptions) (s string, err error) {
+	ast, err := ParseAst(code)
+	if err != nil {
+		return
+	}
+	if len(ast) == 0 {
+		return formatComments(code)
+	}
+
+	return FormatAstWithOptions(ast, opts)
+}
+
 // FormatAst format AST to source code
 func FormatAst(nodeList []AstNode) (f string, err error) {
+	return FormatAstWithOptions(nodeList, FormatOptions{})
+}
+
+// FormatAstWithOptions format AST to source code with options
+func FormatAstWithOptions(nodeList []AstNode, opts FormatOptions) (f string, err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("%v", e)
 		}
 	}()
 
-	for _, node := range nodeList {
+	f = strings.TrimRight(newPrinter(opts).stmts(nodeList, 0), "\n")
+
+	return
+}
+
+// the printer of Format
+var defaultPrinter = newPrinter(FormatOptions{})
+
+// printer format the nodes with options
+type printer struct {
+	opts FormatOptions
+	reg  *tokenRegistry // the binding powers of operators, for the minimal parentheses
+}
+
+func newPrinter(opts FormatOptions) *printer {
+	if opts.Indent == "" {
+		opts.Indent = indentStep
+	}
+	p := &printer{opts: opts}
+	if opts.MinimalParens {
+		p.reg = getTokenRegistry()
+	}
+	return p
+}
+
+// format the statements with their comments, each line ends with "\n".
+// The level is the depth of block
+func (p *printer) stmts(nodes []AstNode, level int) string {
+	var str string
+	pad := p.indent(level)
+	line := 0 // the source line of the last output, 0 if unknown
+
+	// keep the blank line before comment or after the leading comments
+	blank := func(pos Position) {
+		if line > 0 && pos.Line > line+1 && str != "" {
+			str += "\n"
+		}
+	}
+	comments := func(cs []*Comment) {
+		for _, c := range cs {
+			blank(c.Pos)
+			str += pad + c.Text + "\n"
+			line = c.End.Line
+		}
+	}
+
+	for _, node := range nodes {
 		if node == nil {
 			continue
 		}
-		f += node.Format()
-		switch node.(type) {
-		case *NodeIf, *NodeFuncDef, *NodeWhile:
-		default:
-			f += ";"
+		cs := commentsOf(node)
+		if cs == nil {
+			cs = &Comments{}
+		}
+
+		comments(cs.Leading)
+		if len(cs.Leading) > 0 {
+			blank(node.Pos())
+		}
+
+		str += pad + p.stmt(node, level)
+		if cs.Trailing != nil {
+			str += " " + cs.Trailing.Text
 		}
-		f += "\n"
+		str += "\n"
+		line = node.End().Line
+
+		comments(cs.Footer)
 	}
-	f = strings.TrimRight(f, "\n")
 
-	return
+	return str
+}
+
+// format statement, end with ";" except the block statements
+func (p *printer) stmt(node AstNode, level int) string {
+	str := p.expr(node, p.width(p.indent(level)), level)
+	switch node.(type) {
+	case NodeIf, NodeFuncDef, NodeWhile, *NodeIf, *NodeFuncDef, *NodeWhile:
+		return str
+	}
+	return str + ";"
+}
+
+// format node starts at the column of line, which is indented by level.
+// The column is negative if the line width is unlimited
+func (p *printer) expr(node AstNode, col, level int) string {
+	switch n := pointerNode(node).(type) {
+	case *NodeList:
+		items := make([]func(col, level int) string, 0, len(n.List))
+		for _, v := range n.List {
+			items = append(items, p.item(v))
+		}
+		return p.group("[", "]", items, col, level, p.opts.TrailingCommas)
+
+	case *NodeMap:
+		entries := p.entries(n.Map)
+		items := make([]func(col, level int) string, 0, len(entries))
+		for _, e := range entries {
+			e := e
+			items = append(items, func(col, level int) string {
+				key := p.expr(e.key, col, level) + ": "
+				return key + p.expr(e.value, p.advance(col, key), level)
+			})
+		}
+		return p.group("[", "]", items, col, level, p.opts.TrailingCommas)
+
+	case *NodeBinaryOp:
+		left := p.operand(n.Left, n, false, col, level)
+		op := " " + string(n.Op) + " "
+		return left + op + p.operand(n.Right, n, true, p.advance(col, left+op), level)
+
+	case *NodeUnaryOp:
+		switch pointerNode(n.Right).(type) {
+		case *NodeVariable, *NodeNumber, *NodeString, *NodeBool, *NodeList, *NodeMap, *NodeUnaryOp:
+			return string(n.Op) + p.expr(n.Right, p.advance(col, string(n.Op)), level)
+		}
+		// the prefix operator binds tighter than the others
+		return string(n.Op) + "(" + p.expr(n.Right, p.advance(col, string(n.Op)+"("), level) + ")"
+
+	case *NodeAssignOp:
+		left := n.Var.Format() + " " + string(n.Op) + " "
+		return left + p.expr(n.Expr, p.advance(col, left), level)
+
+	case *NodeFuncCallOp:
+		items := make([]func(col, level int) string, 0, len(n.Params))
+		for _, v := range n.Params {
+			items = append(items, p.item(v))
+		}
+		// the arguments of function call can't end with comma
+		name := n.Name.Format()
+		return name + p.group("(", ")", items, p.advance(col, name), level, false)
+
+	case *NodeVarIndex:
+		v := p.expr(n.Var, col, level)
+		if name, ok := n.Index.(*NodeString); ok && n.Member {
+			return v + "." + name.Value
+		}
+		return v + "[" + p.expr(n.Index, p.advance(col, v+"["), level) + "]"
+
+	case *NodeFuncDef:
+		return p.funcDef(n, col, level)
+
+	case *NodeIf:
+		return p.ifStmt(n, col, level)
+
+	case *NodeWhile:
+		head := "while ("
+		return head + p.expr(n.Expr, p.advance(col, head), level) + ") {\n" +
+			p.block(n.Body, bodyComments(n), level+1) + p.indent(level) + "}"
+
+	case *NodeReturn:
+		str := SymbolReturn.String()
+		if len(n.Tuples) == 1 {
+			str += " " + p.expr(n.Tuples[0], p.advance(col, str+" "), level)
+		} else if len(n.Tuples) > 1 {
+			items := make([]func(col, level int) string, 0, len(n.Tuples))
+			for _, v := range n.Tuples {
+				items = append(items, p.item(v))
+			}
+			str += " " + p.group("(", ")", items, p.advance(col, str+" "), level, false)
+		}
+		return str
+	}
+
+	return node.Format()
+}
+
+// return the pointer of composite node, the value is also allowed to be the node
+func pointerNode(node AstNode) AstNode {
+	switch n := node.(type) {
+	case NodeList:
+		return &n
+	case NodeMap:
+		return &n
+	case NodeBinaryOp:
+		return &n
+	case NodeUnaryOp:
+		return &n
+	case NodeAssignOp:
+		return &n
+	case NodeFuncCallOp:
+		return &n
+	case NodeVarIndex:
+		return &n
+	case NodeFuncDef:
+		return &n
+	case NodeIf:
+		return &n
+	case NodeWhile:
+		return &n
+	case NodeReturn:
+		return &n
+	}
+	return node
+}
+
+// format the function definition
+func (p *printer) funcDef(fn *NodeFuncDef, col, level int) string {
+	var ps []string
+	for _, v := range fn.Params {
+		ps = append(ps, v.Format())
+	}
+	var params = strings.Join(ps, ", ")
+	if len(ps) != 1 {
+		params = "(" + params + ")"
+	}
+
+	head := fn.Name.Format() + " = " + params + " -> "
+	var body string
+	var l = len(fn.Body)
+	if l == 0 && len(bodyComments(fn)) == 0 {
+		body = "{}"
+	} else if l == 1 && fn.SingleStmt {
+		body = p.expr(fn.Body[0], p.advance(col, head), level)
+	} else {
+		body = "{\n" + p.block(fn.Body, bodyComments(fn), level+1) + p.indent(level) + "}"
+	}
+
+	return head + body + ";"
+}
+
+// format the if statement
+func (p *printer) ifStmt(ifs *NodeIf, col, level int) string {
+	str := ""
+	cs := commentsOf(ifs)
+	if cs == nil {
+		cs = &Comments{}
+	}
+
+	if ifs.Expr != nil {
+		head := "if ("
+		str += head + p.expr(ifs.Expr, p.advance(col, head), level) + ") {\n"
+		str += p.block(ifs.Body, cs.Body, level+1)
+		str += p.indent(level) + "}"
+	}
+
+	// the comments after "}" break the line before "else"
+	elseHead := " else "
+	if len(cs.BeforeElse) > 0 {
+		str += " " + cs.BeforeElse[0].Text + "\n"
+		for _, c := range cs.BeforeElse[1:] {
+			str += p.indent(level) + c.Text + "\n"
+		}
+		elseHead = p.indent(level) + "else "
+	}
+
+	if ifs.ElseIf != nil {
+		str += elseHead
+		str += p.ifStmt(ifs.ElseIf, p.advance(col, str), level)
+	}
+
+	if ifs.Else != nil || len(cs.Else) > 0 {
+		str += elseHead + "{\n"
+		str += p.block(ifs.Else, cs.Else, level+1)
+		str += p.indent(level) + "}"
+	}
+
+	return str
+}
+
+// format the statements of block, the comments are in the block without statement
+func (p *printer) block(nodes []AstNode, comments []*Comment, level int) string {
+	if len(nodes) > 0 {
+		return p.stmts(nodes, level)
+	}
+	return commentLines(comments, p.indent(level))
+}
+
+// return the comments in the empty block of node
+func bodyComments(node AstNode) []*Comment {
+	if cs := commentsOf(node); cs != nil {
+		return cs.Body
+	}
+	return nil
+}
+
+// format the operand of binary operator, with parentheses if required
+func (p *printer) operand(node AstNode, parent *NodeBinaryOp, right bool, col, level int) string {
+	node = pointerNode(node)
+	paren := false
+	switch n := node.(type) {
+	case *NodeAssignOp:
+		paren = true
+	case *NodeBinaryOp:
+		paren = true
+		if p.opts.MinimalParens {
+			// the binary operators are left associative
+			bp, parentBp := p.power(n.Op), p.power(parent.Op)
+			paren = bp < parentBp || (right && bp == parentBp)
+		}
+	}
+
+	if paren {
+		return "(" + p.expr(node, p.advance(col, "("), level) + ")"
+	}
+	return p.expr(node, col, level)
+}
+
+// return the binding power of operator
+func (p *printer) power(op Symbol) int {
+	if t, ok := p.reg.symTable[op]; ok {
+		return t.bindingPower
+	}
+	return 0
+}
+
+// return the entries of map, sorted by key or in the order of source
+func (p *printer) entries(m map[AstNode]AstNode) []mapEntry {
+	entries := sortedEntries(m)
+	if !p.opts.PreserveMapOrder {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].key.Format() < entries[j].key.Format()
+		})
+	}
+	return entries
+}
+
+// return the formatter of item in group
+func (p *printer) item(node AstNode) func(col, level int) string {
+	return func(col, level int) string {
+		return p.expr(node, col, level)
+	}
+}
+
+// format the items in one line, or one item per line if it's too long
+func (p *printer) group(open, close string, items []func(col, level int) string, col, level int, trailing bool) string {
+	flat := open
+	for idx, item := range items {
+		if idx > 0 {
+			flat += ", "
+		}
+		flat += item(-1, level)
+	}
+	flat += close
+	if len(items) == 0 || p.fits(col, flat) {
+		return flat
+	}
+
+	pad := p.indent(level + 1)
+	str := open + "\n"
+	for idx, item := range items {
+		str += pad + item(p.width(pad), level+1)
+		if idx+1 < len(items) || trailing {
+			str += ","
+		}
+		str += "\n"
+	}
+
+	return str + p.indent(level) + close
+}
+
+// whether the text fits in the line from column
+func (p *printer) fits(col int, s string) bool {
+	return col < 0 || p.opts.MaxLineWidth <= 0 || (!strings.Contains(s, "\n") && col+p.width(s) <= p.opts.MaxLineWidth)
+}
+
+// return the column after the text
+func (p *printer) advance(col int, s string) int {
+	if col < 0 {
+		return col
+	}
+	if idx := strings.LastIndexByte(s, '\n'); idx >= 0 {
+		return p.width(s[idx+1:])
+	}
+	return col + p.width(s)
+}
+
+// return the display width of text, the tab is 4 columns
+func (p *printer) width(s string) int {
+	return utf8.RuneCountInString(s) + 3*strings.Count(s, "\t")
+}
+
+func (p *printer) indent(level int) string {
+	return strings.Repeat(p.opts.Indent, level)
+}
+
+// format the code without statement, keep the comments only
+func formatComments(code string) (string, error) {
+	lexer := NewLexer(code)
+	for {
+		tok, err := scanToken(lexer)
+		if err != nil {
+			return "", err
+		}
+		if tok.sym == SymbolEOF {
+			break
+		}
+	}
+
+	return strings.TrimRight(commentLines(lexer.Comments(), ""), "\n"), nil
+}
+
+// format the comment lines with the indent, keep the blank lines between them
+func commentLines(comments []*Comment, pad string) string {
+	var str string
+	line := 0
+	for _, c := range comments {
+		if line > 0 && c.Pos.Line > line+1 {
+			str += "\n"
+		}
+		str += pad + c.Text + "\n"
+		line = c.End.Line
+	}
+	return str
 }
@@ -0,0 +1,184 @@
+package spiker_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestFormat_Comments(t *testing.T) {
+	want := strings.TrimRight(readFile("testdata/comment.fmt"), "\n")
+
+	got, err := spiker.Format(readFile("testdata/comment.src"))
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", got, want)
+	}
+
+	// the formatted code is stable
+	if again, _ := spiker.Format(got); again != got {
+		t.Errorf("Format() again =\n%s\nwant\n%s", again, got)
+	}
+}
+
+func TestFormat_Comment(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"a = 1; # one", "a = 1; # one"},
+		{"a = 1 # without semicolon", "a = 1; # without semicolon"},
+		{"a = 1\n# the end\n", "a = 1;\n# the end"},
+		{"#first\na = 1;\n\n\n#second\nb = 2;", "#first\na = 1;\n\n#second\nb = 2;"},
+		{"# only\n\n# comments", "# only\n\n# comments"},
+		{`a = "#"; # string`, `a = "#"; # string`},
+		{"if (a) {\n  b = 1;\n} # end", "if (a) {\n    b = 1;\n} # end"},
+		{"if (a) {} else {\n  # empty\n}", "if (a) {\n} else {\n    # empty\n}"},
+		{"if (a) {\n  # todo\n}", "if (a) {\n    # todo\n}"},
+		{"if (a) {\n  b = 1;\n} else if (c) {\n  # todo\n}", "if (a) {\n    b = 1;\n} else if (c) {\n    # todo\n}"},
+		{"if (a) {\n  b = 1;\n} # one\n# two\nelse {\n  c = 2;\n}", "if (a) {\n    b = 1;\n} # one\n# two\nelse {\n    c = 2;\n}"},
+		{"while (a) {\n  # todo\n}", "while (a) {\n    # todo\n}"},
+		{"f = () -> {\n  # todo\n\n  # more\n};", "f = () -> {\n    # todo\n\n    # more\n};"},
+		{"f = x -> x + 1; # incr", "f = x -> x + 1; # incr"},
+		{"while (a) {\n  a -= 1;\n  # next\n}", "while (a) {\n    a -= 1;\n    # next\n}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := spiker.Format(tt.code)
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+			if again, _ := spiker.Format(got); again != got {
+				t.Errorf("Format() again = %q, want %q", again, got)
+			}
+		})
+	}
+}
+
+func TestFormat_CommentError(t *testing.T) {
+	for _, code := range []string{`} "x`, `} @`, "# only\n} @"} {
+		t.Run(code, func(t *testing.T) {
+			_, err := spiker.Format(code)
+			var se *spiker.SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("Format() error = %v, want SyntaxError", err)
+			}
+		})
+	}
+}
+
+func TestParseAst_Comments(t *testing.T) {
+	ast, err := spiker.ParseAst("# total\ntotal = 1; # one\nx = 2;\n# end")
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	cs := ast[0].(*spiker.NodeAssignOp).Comments()
+	if cs == nil || len(cs.Leading) != 1 || cs.Leading[0].Text != "# total" || cs.Trailing.Text != "# one" {
+		t.Fatalf("Comments() = %+v", cs)
+	}
+	if pos := cs.Trailing.Pos; pos.String() != "2:12" || pos.Offset != 19 {
+		t.Errorf("Trailing.Pos = %v, offset %d", pos, pos.Offset)
+	}
+
+	cs = ast[1].(*spiker.NodeAssignOp).Comments()
+	if cs == nil || len(cs.Leading) != 0 || len(cs.Footer) != 1 || cs.Footer[0].Text != "# end" {
+		t.Errorf("Comments() = %+v", cs)
+	}
+
+	// the comments of broken statement are kept
+	ast, _ = spiker.ParseAstRecover("a = ; # broken\n# keep\nb = 1;")
+	if got, _ := spiker.FormatAst(ast); got != "# broken\n# keep\nb = 1;" {
+		t.Errorf("FormatAst() = %q", got)
+	}
+}
+
+func TestFormatWithOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		opts spiker.FormatOptions
+		want string
+	}{
+		{
+			"default",
+			`m = ["b": 1, "a": 2]; x = a + b * c;`,
+			spiker.FormatOptions{},
+			"m = [\"a\": 2, \"b\": 1];\nx = a + (b * c);",
+		},
+		{
+			"indent",
+			"if (a) { while (b) { c = 1; } }",
+			spiker.FormatOptions{Indent: "\t"},
+			"if (a) {\n\twhile (b) {\n\t\tc = 1;\n\t}\n}",
+		},
+		{
+			"preserve map order",
+			`m = ["b": 1, "a": 2, 3];`,
+			spiker.FormatOptions{PreserveMapOrder: true},
+			`m = ["b": 1, "a": 2, 0: 3];`,
+		},
+		{
+			"minimal parens",
+			`x = (a + (b * c)) - (d - e) + ((f + g) * h) ** 2 + (a in b) + (c = 1);`,
+			spiker.FormatOptions{MinimalParens: true},
+			`x = a + b * c - (d - e) + ((f + g) * h) ** 2 + a in b + (c = 1);`,
+		},
+		{
+			"unary operand",
+			`x = -(a + b) + !(exist(c)) + -(a[0]) + !!d;`,
+			spiker.FormatOptions{MinimalParens: true},
+			`x = -(a + b) + !(exist(c)) + -(a[0]) + !!d;`,
+		},
+		{
+			"wrap list",
+			`list = ["alpha", "beta", "gamma", "delta"];`,
+			spiker.FormatOptions{MaxLineWidth: 30},
+			"list = [\n    \"alpha\",\n    \"beta\",\n    \"gamma\",\n    \"delta\"\n];",
+		},
+		{
+			"wrap nested with trailing commas",
+			`if (a) { m = ["k": [1, 2, 3, 4, 5, 6], "v": [[1, 2], [3, 4]]]; }`,
+			spiker.FormatOptions{Indent: "  ", MaxLineWidth: 24, TrailingCommas: true},
+			"if (a) {\n  m = [\n    \"k\": [\n      1,\n      2,\n      3,\n      4,\n      5,\n      6,\n    ],\n    \"v\": [\n      [1, 2],\n      [3, 4],\n    ],\n  ];\n}",
+		},
+		{
+			"wrap call without trailing comma",
+			`total = sum(price * quantity, shipping, tax);`,
+			spiker.FormatOptions{MaxLineWidth: 40, TrailingCommas: true},
+			"total = sum(\n    price * quantity,\n    shipping,\n    tax\n);",
+		},
+		{
+			"short enough",
+			`a = [1, 2];`,
+			spiker.FormatOptions{MaxLineWidth: 11},
+			`a = [1, 2];`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spiker.FormatWithOptions(tt.code, tt.opts)
+			if err != nil {
+				t.Fatalf("FormatWithOptions() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatWithOptions() =\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// the formatted code has the same ast
+			want, _ := spiker.Format(tt.code)
+			if again, err := spiker.Format(got); err != nil || again != want {
+				t.Errorf("Format() = %q, %v, want %q", again, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package spiker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// RegisterGoFunc register the Go function as builtin function to the default engine
+func RegisterGoFunc(name string, fn interface{}, defaults ...interface{}) error {
+	return defaultEngine.RegisterGoFunc(name, fn, defaults...)
+}
+
+// RegisterGoFunc register the Go function as builtin function to the engine,
+// the arguments are converted to the parameter types, and the results are
+// converted by ToValue:
+//
+// - the defaults are the values of optional trailing parameters
+// - the variadic parameter accepts zero or more arguments
+// - the first parameter of context.Context is passed the evaluation context
+// - the function returns nothing, a value, an error, or a value and an error,
+// the returned error is reported as runtime error
+//
+// Example: RegisterGoFunc("round", math.Round)
+func (e *Engine) RegisterGoFunc(name string, fn interface{}, defaults ...interface{}) error {
+	if name == "" {
+		return fmt.Errorf("empty function name")
+	}
+	bfn, err := newGoFunc(name, fn, defaults)
+	if err != nil {
+		return err
+	}
+
+	e.RegisterFunc(name, bfn)
+	return nil
+}
+
+// the signature of Go function
+type goFunc struct {
+	fn       reflect.Value
+	ctx      bool            // the first parameter is context.Context
+	params   []reflect.Type  // excluding the context
+	defaults []reflect.Value // the values of optional trailing parameters
+	variadic bool
+	hasValue bool // returns a value
+	hasError bool // returns an error as the last result
+}
+
+// inspect the signature of Go function, and return the builtin function
+func newGoFunc(name string, fn interface{}, defaults []interface{}) (Func, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return nil, fmt.Errorf("%s() is %T, not a function", name, fn)
+	}
+
+	gf := &goFunc{fn: rv, variadic: rv.Type().IsVariadic()}
+	rt := rv.Type()
+	for i := 0; i < rt.NumIn(); i++ {
+		if i == 0 && rt.In(i) == contextType {
+			gf.ctx = true
+			continue
+		}
+		gf.params = append(gf.params, rt.In(i))
+	}
+
+	switch rt.NumOut() {
+	case 0:
+	case 1:
+		if rt.Out(0) == errorType {
+			gf.hasError = true
+		} else {
+			gf.hasValue = true
+		}
+	case 2:
+		if rt.Out(1) != errorType {
+			return nil, fmt.Errorf("the second result of %s() must be error, but got %s", name, rt.Out(1))
+		}
+		gf.hasValue, gf.hasError = true, true
+	default:
+		return nil, fmt.Errorf("%s() returns %d results, expects at most 2", name, rt.NumOut())
+	}
+
+	// the defaults belong to the trailing parameters before the variadic one
+	fixed := gf.fixed()
+	if len(defaults) > fixed {
+		return nil, fmt.Errorf("%s() has %d parameters, %d defaults given", name, fixed, len(defaults))
+	}
+	for i, v := range defaults {
+		pt := gf.params[fixed-len(defaults)+i]
+		val, err := ToValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s in default %d of %s()", err, i+1, name)
+		}
+		d := valueDecoder{}
+		dv, err := d.decode(val, pt)
+		if err != nil {
+			return nil, fmt.Errorf("%s in default %d of %s()", err, i+1, name)
+		}
+		gf.defaults = append(gf.defaults, dv)
+	}
+
+	return gf.call, nil
+}
+
+// the number of parameters, excluding the context and variadic
+func (gf *goFunc) fixed() int {
+	if gf.variadic {
+		return len(gf.params) - 1
+	}
+	return len(gf.params)
+}
+
+// the builtin function
+func (gf *goFunc) call(fnc *NodeFuncCallOp, scope *VariableScope) interface{} {
+	name := fnc.Name.Value
+	fixed := gf.fixed()
+	required := fixed - len(gf.defaults)
+
+	given := len(fnc.Params)
+	switch {
+	case gf.variadic && given < required:
+		panic(fmt.Sprintf("%s() expects least %d parameters, %d given", name, required, given))
+	case !gf.variadic && (given < required || given > fixed):
+		if required == fixed {
+			panic(fmt.Sprintf("%s() expects %d parameters, %d given", name, fixed, given))
+		}
+		panic(fmt.Sprintf("%s() expects %d to %d parameters, %d given", name, required, fixed, given))
+	}
+
+	var args []reflect.Value
+	if gf.ctx {
+		args = append(args, reflect.ValueOf(scope.Context()))
+	}
+	for i, p := range fnc.Params {
+		var pt reflect.Type
+		if i < fixed {
+			pt = gf.params[i]
+		} else {
+			pt = gf.params[fixed].Elem()
+		}
+
+		d := valueDecoder{}
+		arg, err := d.decode(EvalExpr(p, scope), pt)
+		if err != nil {
+			panic(runtimeError(fmt.Errorf("%s in argument %d of %s()", err, i+1, name), p))
+		}
+		args = append(args, arg)
+	}
+	for i := given; i < fixed; i++ {
+		args = append(args, gf.defaults[i-required])
+	}
+
+	out := gf.fn.Call(args)
+	if gf.hasError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			panic(&RuntimeError{Message: name + "(): " + err.Error(), Err: err})
+		}
+	}
+	if gf.hasValue {
+		return out[0].Interface()
+	}
+
+	return nil
+}
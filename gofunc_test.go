@@ -0,0 +1,165 @@
+package spiker_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shockerli/spiker"
+)
+
+var errDivision = errors.New("division by zero")
+
+type goFuncPoint struct {
+	X int `spiker:"x"`
+	Y int `spiker:"y"`
+}
+
+func newGoFuncEngine(t *testing.T, bytecode bool) *spiker.Engine {
+	e := spiker.New(spiker.WithBytecode(bytecode))
+	funcs := []struct {
+		name     string
+		fn       interface{}
+		defaults []interface{}
+	}{
+		{"round", math.Round, nil},
+		{"join", strings.Join, []interface{}{","}},
+		{"repeat", strings.Repeat, []interface{}{2}},
+		{"sum", func(base int, xs ...float64) float64 {
+			for _, x := range xs {
+				base += int(x)
+			}
+			return float64(base)
+		}, nil},
+		{"div", func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivision
+			}
+			return a / b, nil
+		}, nil},
+		{"check", func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		}, nil},
+		{"nothing", func() {}, nil},
+		{"move", func(p goFuncPoint, dx int8) goFuncPoint {
+			p.X += int(dx)
+			return p
+		}, nil},
+		{"keys", func(m map[string]int) int { return len(m) }, nil},
+		{"year", func(t time.Time) int { return t.Year() }, nil},
+		{"deadline", func(ctx context.Context) bool {
+			_, ok := ctx.Deadline()
+			return ok
+		}, nil},
+		{"kind", func(v interface{}) string { return reflect.TypeOf(v).String() }, nil},
+	}
+	for _, f := range funcs {
+		if err := e.RegisterGoFunc(f.name, f.fn, f.defaults...); err != nil {
+			t.Fatalf("RegisterGoFunc(%s) error = %v", f.name, err)
+		}
+	}
+	return e
+}
+
+func TestEngine_RegisterGoFunc(t *testing.T) {
+	tests := []struct {
+		code string
+		want interface{}
+		err  string
+	}{
+		{code: `round(1.6);`, want: float64(2)},
+		{code: `join(["a", "b"]);`, want: "a,b"},
+		{code: `join(["a", "b"], "-");`, want: "a-b"},
+		{code: `repeat("ab");`, want: "abab"},
+		{code: `repeat("ab", 3);`, want: "ababab"},
+		{code: `sum(1);`, want: float64(1)},
+		{code: `sum(1, 2, 3.5);`, want: float64(6)},
+		{code: `div(1, 4);`, want: 0.25},
+		{code: `check(true);`, want: nil},
+		{code: `nothing();`, want: nil},
+		{code: `move(["x": 1, "y": 2], 3);`, want: spiker.ValueMap{"x": 4, "y": 2}},
+		{code: `p = move(["x": 1, "y": 2], 3); p.x;`, want: 4},
+		{code: `keys(["a": 1, "b": 2]);`, want: 2},
+		{code: `year("2021-03-04T05:06:07Z");`, want: 2021},
+		{code: `deadline();`, want: false},
+		{code: `kind([1]);`, want: "spiker.ValueList"},
+
+		{code: `round();`, err: "RUNTIME ERROR: round() expects 1 parameters, 0 given on line 1:1"},
+		{code: `join();`, err: "RUNTIME ERROR: join() expects 1 to 2 parameters, 0 given on line 1:1"},
+		{code: `join([], ",", 1);`, err: "RUNTIME ERROR: join() expects 1 to 2 parameters, 3 given on line 1:1"},
+		{code: `sum();`, err: "RUNTIME ERROR: sum() expects least 1 parameters, 0 given on line 1:1"},
+		{code: `round("x");`, err: "RUNTIME ERROR: cannot use string as number in argument 1 of round() on line 1:7"},
+		{code: `sum(1.5);`, err: "RUNTIME ERROR: cannot use 1.5 as int in argument 1 of sum() on line 1:5"},
+		{code: `sum(1, 2, true);`, err: "RUNTIME ERROR: cannot use bool as number in argument 3 of sum() on line 1:11"},
+		{code: `join([1]);`, err: "RUNTIME ERROR: cannot use number as string at [0] in argument 1 of join() on line 1:6"},
+		{code: `move(["x": "1"], 1);`, err: "RUNTIME ERROR: cannot use string as number at x in argument 1 of move() on line 1:6"},
+		{code: `move([], 300);`, err: "RUNTIME ERROR: cannot use list as map in argument 1 of move() on line 1:6"},
+		{code: `move(["x": 1], 300);`, err: "RUNTIME ERROR: cannot use 300 as int8 in argument 2 of move() on line 1:16"},
+		{code: `year("2021");`, err: "RUNTIME ERROR: cannot parse \"2021\" as time in argument 1 of year() on line 1:6"},
+		{code: `div(1, 0);`, err: "RUNTIME ERROR: div(): division by zero on line 1:1"},
+		{code: `a = 1; check(a > 1);`, err: "RUNTIME ERROR: check(): check failed on line 1:8"},
+	}
+	for _, bytecode := range []bool{false, true} {
+		e := newGoFuncEngine(t, bytecode)
+		for _, tt := range tests {
+			got, err := e.Execute(tt.code)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Execute(%q, bytecode=%v) error = %v, want %s", tt.code, bytecode, err, tt.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Execute(%q, bytecode=%v) error = %v", tt.code, bytecode, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Execute(%q, bytecode=%v) = %#v, want %#v", tt.code, bytecode, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestEngine_RegisterGoFunc_Error(t *testing.T) {
+	e := newGoFuncEngine(t, false)
+
+	_, err := e.Execute(`div(1, 0);`)
+	if !errors.Is(err, errDivision) {
+		t.Errorf("Execute() error = %v, want %v", err, errDivision)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	got, err := e.ExecuteContext(ctx, `deadline();`, spiker.NewScopeTable("test", 1, nil))
+	if err != nil || got != true {
+		t.Errorf("ExecuteContext() = %v, %v", got, err)
+	}
+
+	tests := []struct {
+		name     string
+		fn       interface{}
+		defaults []interface{}
+		err      string
+	}{
+		{"", math.Abs, nil, "empty function name"},
+		{"f", 1, nil, "f() is int, not a function"},
+		{"f", (func())(nil), nil, "f() is func(), not a function"},
+		{"f", func() (int, int) { return 0, 0 }, nil, "the second result of f() must be error, but got int"},
+		{"f", func() (int, int, error) { return 0, 0, nil }, nil, "f() returns 3 results, expects at most 2"},
+		{"f", math.Abs, []interface{}{1, 2}, "f() has 1 parameters, 2 defaults given"},
+		{"f", math.Abs, []interface{}{"x"}, "cannot use string as number in default 1 of f()"},
+	}
+	for _, tt := range tests {
+		err := e.RegisterGoFunc(tt.name, tt.fn, tt.defaults...)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("RegisterGoFunc(%q) error = %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package spiker
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -99,6 +102,75 @@ func Interface2String(inter interface{}) string {
 	return ""
 }
 
+// FormatValue return the value in the literal syntax of script, such as `["a": 1, "b": [2, 3]]`,
+// nil is "none", the keys of map are sorted, the numeric keys are in numeric order
+func FormatValue(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return SymbolNone.String()
+	case string:
+		return quoteString(val)
+	case int:
+		return strconv.Itoa(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case *NodeFuncDef:
+		return val.Format()
+
+	case ValueList:
+		items := make([]string, 0, len(val))
+		for _, v := range val {
+			items = append(items, FormatValue(v))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+
+	case ValueMap:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ni, iok := numericKey(keys[i])
+			nj, jok := numericKey(keys[j])
+			if iok && jok {
+				return ni < nj
+			}
+			if iok != jok {
+				return iok
+			}
+			return keys[i] < keys[j]
+		})
+
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			key := quoteString(k)
+			if _, ok := numericKey(k); ok {
+				key = k
+			}
+			items = append(items, key+": "+FormatValue(val[k]))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return fmt.Sprint(val)
+}
+
+// return the number of the map key, which is converted from number literal
+func numericKey(key string) (float64, bool) {
+	num, err := strconv.ParseFloat(key, 64)
+	if err != nil || strconv.FormatFloat(num, 'f', -1, 64) != key {
+		return 0, false
+	}
+	return num, true
+}
+
+// return the string literal, escape the characters which are unescaped by lexer
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
+
 // Interface2Float64 convert interface{} to float64
 func Interface2Float64(inter interface{}) float64 {
 	switch inter := inter.(type) {
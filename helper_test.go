@@ -149,6 +149,45 @@ func TestInterface2String(t *testing.T) {
 	}
 }
 
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		input  interface{}
+		expect string
+	}{
+		{nil, "none"},
+		{"abc", `"abc"`},
+		{"a\"b\\c\n", `"a\"b\\c\n"`},
+		{123, "123"},
+		{-12.01, "-12.01"},
+		{float64(3), "3"},
+		{true, "true"},
+		{false, "false"},
+		{spiker.ValueList{}, "[]"},
+		{spiker.ValueList{1, "a", spiker.ValueList{true}}, `[1, "a", [true]]`},
+		{spiker.ValueMap{}, "[]"},
+		{spiker.ValueMap{"10": 1, "9": 2, "b": 3, "a": nil, "1.50": 4}, `[9: 2, 10: 1, "1.50": 4, "a": none, "b": 3]`},
+		{spiker.ValueMap{"t": spiker.ValueMap{"b": spiker.ValueList{1}}}, `["t": ["b": [1]]]`},
+	}
+
+	for index, tt := range tests {
+		val := spiker.FormatValue(tt.input)
+		if val != tt.expect {
+			t.Errorf("test[%d], expected = %s, got = %s", index, tt.expect, val)
+		}
+	}
+
+	// the literal is evaluated to the same value
+	for _, tt := range tests[1:] {
+		val, err := spiker.Execute(spiker.FormatValue(tt.input) + ";")
+		if err != nil {
+			t.Fatalf("Execute(%s) error = %v", spiker.FormatValue(tt.input), err)
+		}
+		if got := spiker.FormatValue(val); got != tt.expect {
+			t.Errorf("Execute(%s) = %s", tt.expect, got)
+		}
+	}
+}
+
 func TestInterface2Float64(t *testing.T) {
 	tests := []struct {
 		input  interface{}
@@ -3,6 +3,7 @@ package spiker
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -16,20 +17,23 @@ type Lexer struct {
 	col    int
 	tok    *Token
 	cached bool
+
+	comments []*Comment // the scanned comments, in source order
 }
 
-func (lex *Lexer) nextString() *Token {
+// the string token starts at col and offset
+func (lex *Lexer) nextString(col int, offset int) *Token {
 	var text bytes.Buffer
 	r, size := utf8.DecodeRuneInString(lex.source[lex.index:])
-	for size > 0 {
+	for {
+		if size == 0 || r == '\n' {
+			panic(&SyntaxError{Line: lex.line, Column: col, Offset: offset, Message: "unterminated string"})
+		}
 		if r == '"' {
 			lex.col++
 			lex.index += size
 			break
 		}
-		if r == '\n' {
-			panic(fmt.Sprint("UNTERMINATED STRING AT ", lex.line, ":", lex.col))
-		}
 		if r == '\\' {
 			lex.col++
 			lex.index += size
@@ -51,10 +55,17 @@ func (lex *Lexer) nextString() *Token {
 		lex.consumeRune(&text, r, size)
 		r, size = utf8.DecodeRuneInString(lex.source[lex.index:])
 	}
-	return lex.tokReg.token(SymbolString, text.String(), lex.line, lex.col)
+	return lex.tokReg.token(SymbolString, text.String(), lex.line, col, offset)
 }
 
 func (lex *Lexer) next() *Token {
+	tok := lex.scan()
+	tok.endLine, tok.endCol, tok.endOffset = lex.line, lex.col, lex.index
+	return tok
+}
+
+// scan the next token
+func (lex *Lexer) scan() *Token {
 	// invalidate peekable cache
 	lex.cached = false
 
@@ -66,19 +77,20 @@ func (lex *Lexer) next() *Token {
 	}
 
 	// end of file
+	offset := lex.index
 	if len(lex.source[lex.index:]) == 0 {
-		return lex.tokReg.token(SymbolEOF, "EOF", lex.line, lex.col)
+		return lex.tokReg.token(SymbolEOF, "EOF", lex.line, lex.col, offset)
 	}
 
 	var text bytes.Buffer
+	line, col := lex.line, lex.col
 	r, size := utf8.DecodeRuneInString(lex.source[lex.index:])
 	for size > 0 {
 		if r == '"' { // parse string
 			lex.col++
 			lex.index += size
-			return lex.nextString()
+			return lex.nextString(col, offset)
 		} else if isFirstIdentChar(r) { // parse identifiers/keywords
-			col := lex.col
 			lex.consumeRune(&text, r, size)
 			for {
 				r, size = utf8.DecodeRuneInString(lex.source[lex.index:])
@@ -90,12 +102,11 @@ func (lex *Lexer) next() *Token {
 			}
 			symbol := text.String()
 			if lex.tokReg.defined(Symbol(symbol)) {
-				return lex.tokReg.token(Symbol(symbol), symbol, lex.line, col)
+				return lex.tokReg.token(Symbol(symbol), symbol, lex.line, col, offset)
 			}
 
-			return lex.tokReg.token(SymbolIdent, symbol, lex.line, col)
+			return lex.tokReg.token(SymbolIdent, symbol, lex.line, col, offset)
 		} else if unicode.IsDigit(r) { // parse numbers
-			col := lex.col
 			lex.consumeRune(&text, r, size)
 			for {
 				r, size = utf8.DecodeRuneInString(lex.source[lex.index:])
@@ -116,9 +127,8 @@ func (lex *Lexer) next() *Token {
 					}
 				}
 			}
-			return lex.tokReg.token(SymbolNumber, text.String(), lex.line, col)
+			return lex.tokReg.token(SymbolNumber, text.String(), lex.line, col, offset)
 		} else if isOperatorChar(r) { // parse operators
-			col := lex.col
 			lex.consumeRune(&text, r, size)
 
 			// try to parse operators made of two characters
@@ -130,20 +140,23 @@ func (lex *Lexer) next() *Token {
 				if lex.tokReg.defined(Symbol(twoChar.String())) {
 					lex.consumeRune(&text, r, size)
 					textStr := text.String()
-					return lex.tokReg.token(Symbol(textStr), textStr, lex.line, col)
+					return lex.tokReg.token(Symbol(textStr), textStr, lex.line, col, offset)
 				}
 			}
 
 			// single character operator
 			textStr := text.String()
 			if lex.tokReg.defined(Symbol(textStr)) {
-				return lex.tokReg.token(Symbol(textStr), textStr, lex.line, col)
+				return lex.tokReg.token(Symbol(textStr), textStr, lex.line, col, offset)
 			}
 		} else {
 			break
 		}
 	}
-	panic(fmt.Sprint("INVALID CHARACTER ", lex.line, lex.col))
+	// skip the invalid character, the parsing could be recovered
+	r, size = utf8.DecodeRuneInString(lex.source[offset:])
+	lex.index, lex.col = offset+size, col+1
+	panic(&SyntaxError{Line: line, Column: col, Offset: offset, Message: fmt.Sprintf("invalid character %q", r)})
 }
 
 func (lex *Lexer) consumeWhitespace() {
@@ -163,12 +176,31 @@ func (lex *Lexer) consumeWhitespace() {
 func (lex *Lexer) consumeComments() {
 	r, size := utf8.DecodeRuneInString(lex.source[lex.index:])
 	if Symbol(r) == SymbolPound {
+		pos := Position{Line: lex.line, Column: lex.col, Offset: lex.index}
 		for size > 0 && r != '\n' {
 			lex.col++
 			lex.index += size
 			r, size = utf8.DecodeRuneInString(lex.source[lex.index:])
 		}
+		lex.keepComment(pos, Position{Line: lex.line, Column: lex.col, Offset: lex.index})
+	}
+}
+
+// keep the comment as trivia, once even if it is scanned again by peek
+func (lex *Lexer) keepComment(pos, end Position) {
+	if n := len(lex.comments); n > 0 && lex.comments[n-1].Pos.Offset >= pos.Offset {
+		return
 	}
+	// the trailing spaces are not the part of comment
+	text := strings.TrimRightFunc(lex.source[pos.Offset:end.Offset], unicode.IsSpace)
+	end.Column -= utf8.RuneCountInString(lex.source[pos.Offset+len(text) : end.Offset])
+	end.Offset = pos.Offset + len(text)
+	lex.comments = append(lex.comments, &Comment{Text: text, Pos: pos, End: end})
+}
+
+// Comments return the comments scanned so far
+func (lex *Lexer) Comments() []*Comment {
+	return lex.comments
 }
 
 func (lex *Lexer) consumeRune(text *bytes.Buffer, r rune, size int) {
@@ -256,7 +288,7 @@ func getTokenRegistry() *tokenRegistry {
 	// (
 	t.infixLed(SymbolLparen, 90, func(token *Token, p *Parser, left *Token) *Token {
 		if left.sym != SymbolIdent && left.sym != SymbolLbrack && left.sym != SymbolLparen && left.sym != SymbolFuncDeclare {
-			panic(fmt.Sprint("BAD FUNC CALL LEFT OPERAND: ", left))
+			panic(newSyntaxError(left, "bad function call left operand %s", left.describe()))
 		}
 		token.children = append(token.children, left)
 		t := p.Lexer.peek()
@@ -269,17 +301,15 @@ func getTokenRegistry() *tokenRegistry {
 				}
 				p.advance(SymbolComma)
 			}
-			p.advance(SymbolRparen)
-		} else {
-			p.advance(SymbolRparen)
 		}
+		token.end = p.advance(SymbolRparen)
 		return token
 	})
 
 	// [
 	t.infixLed(SymbolLbrack, 80, func(token *Token, p *Parser, left *Token) *Token {
-		if left.sym != SymbolIdent && left.sym != SymbolLbrack && left.sym != SymbolLparen {
-			panic(fmt.Sprint("BAD ARRAY LEFT OPERAND: ", left))
+		if left.sym != SymbolIdent && left.sym != SymbolLbrack && left.sym != SymbolLparen && left.sym != SymbolDot {
+			panic(newSyntaxError(left, "bad index left operand %s", left.describe()))
 		}
 		token.children = append(token.children, left)
 		t := p.Lexer.peek()
@@ -292,10 +322,20 @@ func getTokenRegistry() *tokenRegistry {
 				}
 				p.advance(SymbolComma)
 			}
-			p.advance(SymbolRbrack)
-		} else {
-			p.advance(SymbolRbrack)
 		}
+		token.end = p.advance(SymbolRbrack)
+		return token
+	})
+
+	// .
+	t.infixLed(SymbolDot, 80, func(token *Token, p *Parser, left *Token) *Token {
+		if left.sym != SymbolIdent && left.sym != SymbolLbrack && left.sym != SymbolLparen && left.sym != SymbolDot {
+			panic(newSyntaxError(left, "bad member left operand %s", left.describe()))
+		}
+		if name := p.Lexer.peek(); name.sym != SymbolIdent {
+			panic(newSyntaxError(name, "expected member name, but got %s", name.describe()))
+		}
+		token.children = append(token.children, left, p.Lexer.next())
 		return token
 	})
 
@@ -309,7 +349,7 @@ func getTokenRegistry() *tokenRegistry {
 	// ->
 	t.infixRightLed(SymbolFuncDeclare, 10, func(token *Token, p *Parser, left *Token) *Token {
 		if left.sym != SymbolTuple && left.sym != SymbolIdent {
-			panic(fmt.Sprint("INVALID FUNC DECLARATION TUPLE: ", left))
+			panic(newSyntaxError(left, "invalid function parameters %s", left.describe()))
 		}
 		if left.sym == SymbolTuple && len(left.children) != 0 {
 			named := true
@@ -320,7 +360,7 @@ func getTokenRegistry() *tokenRegistry {
 				}
 			}
 			if !named {
-				panic(fmt.Sprint("INVALID FUNC DECLARATION TUPLE: ", left))
+				panic(newSyntaxError(left, "invalid function parameters %s", left.describe()))
 			}
 		}
 		token.children = append(token.children, left)
@@ -352,12 +392,13 @@ func getTokenRegistry() *tokenRegistry {
 				p.advance(SymbolComma)
 			}
 		}
-		p.advance(SymbolRparen)
+		t.end = p.advance(SymbolRparen)
 		if len(t.children) == 0 || comma {
 			t.sym = SymbolTuple
 			t.value = "TUPLE"
 			return t
 		}
+		t.children[0].paren = t
 		return t.children[0]
 	})
 
@@ -390,7 +431,7 @@ func getTokenRegistry() *tokenRegistry {
 				p.advance(SymbolComma)
 			}
 		}
-		p.advance(SymbolRbrack)
+		t.end = p.advance(SymbolRbrack)
 		t.children = children
 		if isArray {
 			t.sym = SymbolArray
@@ -428,12 +469,8 @@ func getTokenRegistry() *tokenRegistry {
 
 	// {
 	t.stmt(SymbolLbrace, func(t *Token, p *Parser) *Token {
-		stmts, err := p.Statements()
-		if err != nil {
-			panic(err.Error())
-		}
-		t.children = append(t.children, stmts...)
-		p.advance(SymbolRbrace)
+		t.children = append(t.children, p.statements()...)
+		t.end = p.advance(SymbolRbrace)
 		return t
 	})
 
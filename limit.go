@@ -0,0 +1,124 @@
+package spiker
+
+import "fmt"
+
+// DefaultMaxCallDepth default maximum call depth of custom functions,
+// to keep the recursive function from blowing the Go stack
+const DefaultMaxCallDepth = 1000
+
+// Limits execution resource limits, zero means the default, negative means unlimited.
+// Only the call depth has a default limit, DefaultMaxCallDepth
+type Limits struct {
+	MaxSteps          int // maximum evaluated nodes
+	MaxCallDepth      int // maximum call depth of custom functions
+	MaxStringLength   int // maximum length(bytes) of string value
+	MaxCollectionSize int // maximum size of list/map value
+}
+
+// WithLimits set the execution resource limits of the engine,
+// the zero fields keep the default limits
+func WithLimits(limits Limits) Option {
+	return func(e *Engine) {
+		if limits.MaxCallDepth == 0 {
+			limits.MaxCallDepth = DefaultMaxCallDepth
+		}
+		e.limits = limits
+	}
+}
+
+// Limit name of the resource limit
+type Limit string
+
+// Supported limit
+const (
+	LimitSteps          Limit = "max steps"
+	LimitCallDepth      Limit = "max call depth"
+	LimitStringLength   Limit = "max string length"
+	LimitCollectionSize Limit = "max collection size"
+)
+
+// Sentinel limit errors, for errors.Is
+var (
+	ErrMaxSteps          = &LimitError{Limit: LimitSteps, Message: string(LimitSteps) + " exceeded"}
+	ErrMaxCallDepth      = &LimitError{Limit: LimitCallDepth, Message: string(LimitCallDepth) + " exceeded"}
+	ErrMaxStringLength   = &LimitError{Limit: LimitStringLength, Message: string(LimitStringLength) + " exceeded"}
+	ErrMaxCollectionSize = &LimitError{Limit: LimitCollectionSize, Message: string(LimitCollectionSize) + " exceeded"}
+)
+
+// LimitError returned when the evaluation exceeds a resource limit
+type LimitError struct {
+	Limit   Limit
+	Max     int
+	Node    AstNode
+	Line    int
+	Column  int
+	Offset  int
+	Message string
+}
+
+// Error .
+func (e *LimitError) Error() string {
+	return "RUNTIME ERROR: " + e.Message + position(e.Line, e.Column)
+}
+
+// Is report whether the target is a LimitError of the same limit
+func (e *LimitError) Is(target error) bool {
+	t, ok := target.(*LimitError)
+	return ok && t.Limit == e.Limit
+}
+
+// return a new LimitError with the node position
+func newLimitError(limit Limit, max int, node AstNode) *LimitError {
+	e := &LimitError{
+		Limit:   limit,
+		Max:     max,
+		Node:    node,
+		Message: fmt.Sprintf("%s %d exceeded", limit, max),
+	}
+	e.Line, e.Column, e.Offset = nodePosition(node)
+	return e
+}
+
+// count an evaluated node
+func (ex *execution) step(node AstNode) error {
+	ex.steps++
+	if ex.limits.MaxSteps > 0 && ex.steps > ex.limits.MaxSteps {
+		return newLimitError(LimitSteps, ex.limits.MaxSteps, node)
+	}
+	return nil
+}
+
+// enter a custom function call
+func (ex *execution) enterCall(node AstNode) error {
+	if ex.limits.MaxCallDepth > 0 && ex.depth >= ex.limits.MaxCallDepth {
+		return newLimitError(LimitCallDepth, ex.limits.MaxCallDepth, node)
+	}
+	ex.depth++
+	return nil
+}
+
+// leave a custom function call
+func (ex *execution) leaveCall() {
+	ex.depth--
+}
+
+// check the size of the value produced by node
+func (ex *execution) checkValue(node AstNode, val interface{}) error {
+	switch val := val.(type) {
+	case string:
+		if ex.limits.MaxStringLength > 0 && len(val) > ex.limits.MaxStringLength {
+			return newLimitError(LimitStringLength, ex.limits.MaxStringLength, node)
+		}
+
+	case ValueList:
+		if ex.limits.MaxCollectionSize > 0 && len(val) > ex.limits.MaxCollectionSize {
+			return newLimitError(LimitCollectionSize, ex.limits.MaxCollectionSize, node)
+		}
+
+	case ValueMap:
+		if ex.limits.MaxCollectionSize > 0 && len(val) > ex.limits.MaxCollectionSize {
+			return newLimitError(LimitCollectionSize, ex.limits.MaxCollectionSize, node)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package spiker_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  spiker.Limits
+		code    string
+		wantErr error
+		line    int
+	}{
+		{"steps", spiker.Limits{MaxSteps: 100}, `
+a = 0;
+while (true) {
+    a += 1;
+}`, spiker.ErrMaxSteps, 4},
+		{"steps-enough", spiker.Limits{MaxSteps: 100}, `a = 1 + 2;`, nil, 0},
+		{"call-depth", spiker.Limits{MaxCallDepth: 50}, `
+f = x -> f(x + 1);
+f(1);`, spiker.ErrMaxCallDepth, 2},
+		{"call-depth-default", spiker.New().Limits(), `f = x -> f(x + 1); f(1);`, spiker.ErrMaxCallDepth, 1},
+		{"call-depth-kept", spiker.Limits{MaxSteps: 1 << 30}, `f = x -> f(x + 1); f(1);`, spiker.ErrMaxCallDepth, 1},
+		{"string-length", spiker.Limits{MaxStringLength: 10}, `
+s = "a";
+while (true) {
+    s += "a";
+}`, spiker.ErrMaxStringLength, 4},
+		{"collection-size", spiker.Limits{MaxCollectionSize: 3}, `a = [1, 2, 3, 4];`, spiker.ErrMaxCollectionSize, 1},
+		{"collection-size-map", spiker.Limits{MaxCollectionSize: 1}, `a = ["a": 1, "b": 2];`, spiker.ErrMaxCollectionSize, 1},
+		{"unlimited", spiker.Limits{MaxCallDepth: -1}, `
+f = x -> {
+    if (x > 0) {
+        return f(x - 1) + 1;
+    }
+    return 0;
+};
+export(f(2000));`, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := spiker.New(spiker.WithLimits(tt.limits))
+			_, err := e.Execute(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var le *spiker.LimitError
+			if errors.As(err, &le) {
+				if le.Line != tt.line {
+					t.Errorf("LimitError line = %d, want %d", le.Line, tt.line)
+				}
+				if le.Node == nil {
+					t.Error("LimitError node should not be nil")
+				}
+			}
+		})
+	}
+}
+
+func TestLimits_Recursion(t *testing.T) {
+	val, err := spiker.Execute(`
+fib = n -> {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+};
+export(fib(10));`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if val != float64(55) {
+		t.Errorf("Execute() = %v, want %v", val, 55)
+	}
+}
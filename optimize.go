@@ -0,0 +1,232 @@
+package spiker
+
+import "math"
+
+// WithOptimize optimize the ast nodes after parsing, see Optimize
+func WithOptimize(enable bool) Option {
+	return func(e *Engine) {
+		e.optimize = enable
+	}
+}
+
+// Optimize fold the constant expressions and prune the constant branches,
+// return the new ast nodes, the evaluation result is the same.
+//
+// The binary and unary operations over literals are folded into a literal,
+// if the result is a finite number, string or bool.
+// The `if` with constant condition keeps the executed branch only,
+// the `while (false)` has no body, and they are removed if the statement value isn't used.
+func Optimize(nodeList []AstNode) []AstNode {
+	return optimizeList(nodeList, true)
+}
+
+// optimize the statements, `top` means the top level statements,
+// whose nil value is ignored
+func optimizeList(nodes []AstNode, top bool) []AstNode {
+	if nodes == nil {
+		return nil
+	}
+
+	list := make([]AstNode, 0, len(nodes))
+	for idx, node := range nodes {
+		node = optimizeNode(node)
+
+		// the last statement is the value of body
+		if (top || idx < len(nodes)-1) && isNoop(node) {
+			continue
+		}
+		list = append(list, node)
+	}
+
+	return list
+}
+
+// optimize the node, return a copy, the original node is not modified
+func optimizeNode(node AstNode) AstNode {
+	switch node := node.(type) {
+	case *NodeAssignOp:
+		n := *node
+		n.Expr = optimizeNode(node.Expr)
+		return &n
+
+	case *NodeUnaryOp:
+		n := *node
+		n.Right = optimizeNode(node.Right)
+		if right, ok := literalValue(n.Right); ok {
+			if lit, ok := literalNode(calcUnary(n.Op, right), &n); ok {
+				return lit
+			}
+		}
+		return &n
+
+	case *NodeBinaryOp:
+		n := *node
+		n.Left = optimizeNode(node.Left)
+		n.Right = optimizeNode(node.Right)
+		if left, ok := literalValue(n.Left); ok {
+			if right, ok := literalValue(n.Right); ok {
+				// keep the runtime error
+				if val, err := calcBinary(n.Op, left, right); err == nil {
+					if lit, ok := literalNode(val, &n); ok {
+						return lit
+					}
+				}
+			}
+		}
+		return &n
+
+	case *NodeList:
+		n := *node
+		n.List = make([]AstNode, len(node.List))
+		for i, v := range node.List {
+			n.List[i] = optimizeNode(v)
+		}
+		return &n
+
+	case *NodeMap:
+		n := *node
+		n.Map = make(map[AstNode]AstNode, len(node.Map))
+		for k, v := range node.Map {
+			n.Map[optimizeNode(k)] = optimizeNode(v)
+		}
+		return &n
+
+	case *NodeVarIndex:
+		n := *node
+		n.Var = optimizeNode(node.Var)
+		n.Index = optimizeNode(node.Index)
+		return &n
+
+	case *NodeFuncCallOp:
+		n := *node
+		n.Params = make([]AstNode, len(node.Params))
+		for i, v := range node.Params {
+			n.Params[i] = optimizeNode(v)
+		}
+		return &n
+
+	case *NodeFuncDef:
+		n := *node
+		n.Body = optimizeList(node.Body, false)
+		return &n
+
+	case *NodeIf:
+		return optimizeIf(node)
+
+	case *NodeWhile:
+		if node.Expr == nil {
+			return node
+		}
+		n := *node
+		n.Expr = optimizeNode(node.Expr)
+		if cond, ok := literalValue(n.Expr); ok && !IsTrue(cond) {
+			n.Body = nil
+			return &n
+		}
+		n.Body = optimizeList(node.Body, false)
+		return &n
+
+	case *NodeReturn:
+		n := *node
+		n.Tuples = make([]AstNode, len(node.Tuples))
+		for i, v := range node.Tuples {
+			n.Tuples[i] = optimizeNode(v)
+		}
+		return &n
+	}
+
+	return node
+}
+
+// optimize the if statement, keep the executed branch if the condition is constant
+func optimizeIf(node *NodeIf) *NodeIf {
+	if node.Expr == nil {
+		return node
+	}
+
+	n := *node
+	n.Expr = optimizeNode(node.Expr)
+	if cond, ok := literalValue(n.Expr); ok {
+		if IsTrue(cond) {
+			n.Body = optimizeList(node.Body, false)
+			n.ElseIf, n.Else = nil, nil
+			return &n
+		}
+		if node.ElseIf != nil {
+			return optimizeIf(node.ElseIf)
+		}
+		if len(node.Else) == 0 {
+			n.Body, n.Else = nil, nil
+			return &n
+		}
+
+		// the else branch is always executed
+		return &NodeIf{
+			Ast:  node.Ast,
+			Expr: &NodeBool{Ast: Ast{raw: spanToken(n.Expr.Pos(), n.Expr.End())}, Value: true},
+			Body: optimizeList(node.Else, false),
+		}
+	}
+
+	n.Body = optimizeList(node.Body, false)
+	if node.ElseIf != nil {
+		n.ElseIf = optimizeIf(node.ElseIf)
+	}
+	n.Else = optimizeList(node.Else, false)
+
+	return &n
+}
+
+// report whether the statement does nothing and its value is nil
+func isNoop(node AstNode) bool {
+	switch node := node.(type) {
+	case *NodeIf:
+		if cond, ok := literalValue(node.Expr); ok {
+			if IsTrue(cond) {
+				return len(node.Body) == 0
+			}
+			return node.ElseIf == nil && len(node.Else) == 0
+		}
+
+	case *NodeWhile:
+		if cond, ok := literalValue(node.Expr); ok {
+			return !IsTrue(cond)
+		}
+	}
+
+	return false
+}
+
+// return the value of literal node
+func literalValue(node AstNode) (interface{}, bool) {
+	switch node := node.(type) {
+	case *NodeNumber:
+		return node.Value, true
+	case *NodeString:
+		return node.Value, true
+	case *NodeBool:
+		return node.Value, true
+	}
+	return nil, false
+}
+
+// return the literal node of value, which covers the folded node,
+// report false if the value has no literal,
+// the int value isn't folded since NodeNumber is float64
+func literalNode(val interface{}, folded AstNode) (AstNode, bool) {
+	raw := spanToken(folded.Pos(), folded.End())
+	// keep the parentheses, the position of enclosing node starts at them
+	raw.paren = parenOf(folded)
+	switch val := val.(type) {
+	case float64:
+		if math.IsInf(val, 0) || math.IsNaN(val) {
+			return nil, false
+		}
+		return &NodeNumber{Ast: Ast{raw: raw}, Value: val}, true
+	case string:
+		return &NodeString{Ast: Ast{raw: raw}, Value: val}, true
+	case bool:
+		return &NodeBool{Ast: Ast{raw: raw}, Value: val}, true
+	}
+	return nil, false
+}
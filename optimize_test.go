@@ -0,0 +1,147 @@
+package spiker_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`a = rate * (60 * 60 * 24);`, `a = rate * 86400;`},
+		{`a = rate * 60 * 60;`, `a = (rate * 60) * 60;`},
+		{`a = -(1 + 2);`, `a = -3;`},
+		{`a = !(1 > 2) && "x" in "xyz";`, `a = true;`},
+		{`a = "id:" + 3;`, `a = "id:3";`},
+		{`a = 0.1 + 0.2;`, `a = 0.3;`},
+		{`a = 7 % 2;`, `a = 7 % 2;`},
+		{`a = 1 / 0;`, `a = 1 / 0;`},
+		{`a = 0 / 0;`, `a = 0 / 0;`},
+		{`a = [1 + 1, 2 * 3];`, `a = [2, 6];`},
+		{`a = len("ab" + "c");`, `a = len("abc");`},
+		{`if (1 > 2) { a = 1; } b = 2;`, `b = 2;`},
+		{`if (1 < 2) { a = 1; } else { a = 2; }`, "if (true) {\n    a = 1;\n}"},
+		{`if (false) { a = 1; } else if (x) { a = 2; } else { a = 3; }`, "if (x) {\n    a = 2;\n} else {\n    a = 3;\n}"},
+		{`if (0) { a = 1; } else { a = 2; }`, "if (true) {\n    a = 2;\n}"},
+		{`while (false) { a = 1; } b = 2;`, `b = 2;`},
+		{`while (1 - 1) { a = 1; }`, ``},
+		{`f = x -> { while (false) { a = 1; } return x; };`, "f = x -> {\n    return x;\n};"},
+		// the value of the last statement is used
+		{`f = x -> { a = x; while (false) { a = 2; } };`, "f = x -> {\n    a = x;\n    while (false) {\n    }\n};"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			ast, err := spiker.ParseAst(tt.code)
+			if err != nil {
+				t.Fatalf("ParseAst() error = %v", err)
+			}
+			before, _ := spiker.FormatAst(ast)
+
+			got, err := spiker.FormatAst(spiker.Optimize(ast))
+			if err != nil {
+				t.Fatalf("FormatAst() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Optimize() = %q, want %q", got, tt.want)
+			}
+
+			// the original ast nodes are not modified
+			if after, _ := spiker.FormatAst(ast); after != before {
+				t.Errorf("Optimize() modified the ast nodes: %q", after)
+			}
+		})
+	}
+}
+
+func TestWithOptimize(t *testing.T) {
+	e := spiker.New(spiker.WithOptimize(true), spiker.WithAstCache(true))
+
+	ast, err := e.ParseAst(`a = 60 * 60; if (false) { a = 1; }`)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+	if got, _ := spiker.FormatAst(ast); got != "a = 3600;" {
+		t.Errorf("ParseAst() = %q", got)
+	}
+
+	// format the original code
+	if got, _ := e.Format(`a = 60 * 60;`); got != "a = 60 * 60;" {
+		t.Errorf("Format() = %q", got)
+	}
+
+	p, err := e.Compile(`export(60 * 60);`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if got, _ := spiker.FormatAst(p.Ast()); got != "export(3600);" {
+		t.Errorf("Compile() = %q", got)
+	}
+}
+
+func TestOptimize_SameResult(t *testing.T) {
+	plain := spiker.New()
+	optimized := spiker.New(spiker.WithOptimize(true))
+
+	var cases []string
+	for _, file := range srcTests {
+		cases = append(cases, readFile(file))
+	}
+	cases = append(cases, bytecodeTests...)
+	cases = append(cases,
+		`a = 1; if (false) { a = 2; }`,
+		`a = 1; if (true) { a = 2; b = 3; }`,
+		`f = x -> { if (x) { 1; } else { 2; } }; export([f(true), f(false)]);`,
+		`f = () -> { i = 0; while (i < 3) { i += 1; if (true) { continue; } i = 10; } return i; }; export(f());`,
+		`f = () -> { if (true) { break; } return 1; }; export(f());`,
+		`a = while (false) { 1; };`,
+	)
+
+	// random expressions over literals
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		cases = append(cases, "a = "+randomExpr(rnd, 3)+";")
+	}
+
+	for _, code := range cases {
+		want, wantErr := plain.Execute(code)
+		got, err := optimized.Execute(code)
+		if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+			t.Errorf("Execute(%q) error = %v, want %v", code, err, wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) && fmt.Sprint(got) != "NaN" {
+			t.Errorf("Execute(%q) = %#v, want %#v", code, got, want)
+		}
+	}
+}
+
+var (
+	randomLiterals  = []string{"0", "1", "2", "3.5", "0.1", "123456789", "\"a\"", "\"12\"", "\"\"", "true", "false"}
+	randomOperators = []string{"+", "-", "*", "/", "%", "**", "&", "|", "^", ">>", "<<", "&&", "||", "==", "!=", ">", ">=", "<", "<=", "in"}
+)
+
+// random expression over literals
+func randomExpr(rnd *rand.Rand, depth int) string {
+	if depth == 0 || rnd.Intn(4) == 0 {
+		return randomLiterals[rnd.Intn(len(randomLiterals))]
+	}
+
+	switch rnd.Intn(5) {
+	case 0:
+		return []string{"-", "!", "~"}[rnd.Intn(3)] + "(" + randomExpr(rnd, depth-1) + ")"
+	default:
+		return strings.Join([]string{
+			"(" + randomExpr(rnd, depth-1) + ")",
+			randomOperators[rnd.Intn(len(randomOperators))],
+			"(" + randomExpr(rnd, depth-1) + ")",
+		}, " ")
+	}
+}
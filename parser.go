@@ -7,23 +7,28 @@ import (
 // Parser Lexer parser
 type Parser struct {
 	Lexer *Lexer
+
+	recovery bool           // keep parsing after syntax error
+	errs     []*SyntaxError // the reported syntax errors in recovery mode
 }
 
 func (psr *Parser) expression(rbp int) *Token {
 	var left *Token
-	t := psr.Lexer.next()
+	t := psr.Lexer.peek()
 
 	if t.nud != nil {
+		t = psr.Lexer.next()
 		left = t.nud(t, psr)
 	} else {
-		panic(fmt.Sprint("syntax error: NOT PREFIX ", t.Format()))
+		panic(newSyntaxError(t, "unexpected %s", t.describe()))
 	}
 	for rbp < psr.Lexer.peek().bindingPower {
-		t := psr.Lexer.next()
+		t := psr.Lexer.peek()
 		if t.led != nil {
+			t = psr.Lexer.next()
 			left = t.led(t, psr, left)
 		} else {
-			panic(fmt.Sprint("syntax error: NOT INFIX ", t.Format()))
+			panic(newSyntaxError(t, "unexpected %s, expecting operator", t.describe()))
 		}
 	}
 
@@ -34,24 +39,157 @@ func (psr *Parser) expression(rbp int) *Token {
 func (psr *Parser) Statements() (stmts []*Token, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = fmt.Errorf("%v", e)
+			err = recoverSyntaxError(e)
 		}
 	}()
 
-	next := psr.Lexer.peek()
-	for next.sym != SymbolEOF && next.sym != SymbolRbrace {
-		stmts = append(stmts, psr.statement())
-		next = psr.Lexer.peek()
+	return psr.statements(), nil
+}
+
+// StatementsRecover parse statements, and keep going after syntax error,
+// the tokens are skipped until the next ";" or "}".
+// Return the parsed statements and all syntax errors as SyntaxErrors,
+// the statement with syntax error is dropped
+func (psr *Parser) StatementsRecover() (stmts []*Token, err error) {
+	psr.recovery = true
+	psr.errs = nil
+	defer func() {
+		psr.recovery = false
+	}()
+
+	for {
+		stmts = append(stmts, psr.statements()...)
+
+		// the unmatched "}" at top level
+		var next *Token
+		if psr.attempt(func() { next = psr.Lexer.peek() }) {
+			if next.sym == SymbolEOF {
+				break
+			}
+			psr.report(newSyntaxError(next, "unexpected %s", next.describe()))
+			psr.Lexer.next()
+		}
 	}
 
+	if len(psr.errs) > 0 {
+		err = SyntaxErrors(psr.errs)
+	}
 	return
 }
 
+// parse statements until EOF or "}"
+func (psr *Parser) statements() (stmts []*Token) {
+	for {
+		var next *Token
+		if !psr.attempt(func() { next = psr.Lexer.peek() }) {
+			continue
+		}
+		if next.sym == SymbolEOF || next.sym == SymbolRbrace {
+			return
+		}
+
+		var stmt *Token
+		if psr.attempt(func() { stmt = psr.statement() }) {
+			stmts = append(stmts, stmt)
+		} else {
+			psr.synchronize()
+		}
+	}
+}
+
+// run the parsing function, report whether it succeeded.
+// The syntax error is reported in recovery mode, otherwise it unwinds the parsing
+func (psr *Parser) attempt(fn func()) (ok bool) {
+	if !psr.recovery {
+		fn()
+		return true
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			se, isSyntax := e.(*SyntaxError)
+			if !isSyntax {
+				panic(e)
+			}
+			psr.report(se)
+		}
+	}()
+
+	fn()
+	return true
+}
+
+// report the syntax error, once at the same position
+func (psr *Parser) report(err *SyntaxError) {
+	if n := len(psr.errs); n > 0 && psr.errs[n-1].Offset == err.Offset {
+		return
+	}
+	psr.errs = append(psr.errs, err)
+}
+
+// skip the tokens of the broken statement, until the ";" at the same level,
+// or the "}" of an enclosing block, which is left to the block.
+// The braces in the skipped tokens are balanced,
+// so a broken statement with block is skipped as a whole
+func (psr *Parser) synchronize() {
+	depth := 0
+	for {
+		var t *Token
+		if !psr.attempt(func() { t = psr.Lexer.peek() }) {
+			continue
+		}
+
+		switch t.sym {
+		case SymbolEOF:
+			return
+
+		case SymbolLbrace:
+			depth++
+
+		case SymbolRbrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				psr.Lexer.next()
+				psr.skipBlockTail()
+				return
+			}
+
+		case SymbolSemicolon:
+			if depth == 0 {
+				psr.Lexer.next()
+				return
+			}
+		}
+
+		psr.Lexer.next()
+	}
+}
+
+// skip the rest of statement after a block, such as the else branch
+// and the ";" of function definition
+func (psr *Parser) skipBlockTail() {
+	var t *Token
+	if !psr.attempt(func() { t = psr.Lexer.peek() }) {
+		return
+	}
+	switch t.sym {
+	case SymbolSemicolon:
+		psr.Lexer.next()
+	case SymbolElse:
+		psr.Lexer.next()
+		psr.synchronize()
+	}
+}
+
 func (psr *Parser) block() *Token {
-	t := psr.Lexer.next()
+	t := psr.Lexer.peek()
 	if t.sym != SymbolLbrace {
-		panic(fmt.Sprint("syntax error: was looking for block start ", t.Format()))
+		panic(newSyntaxError(t, `expected "{", but got %s`, t.describe()))
 	}
+	t = psr.Lexer.next()
 	return t.std(t, psr)
 }
 
@@ -69,9 +207,27 @@ func (psr *Parser) statement() *Token {
 func (psr *Parser) advance(sym Symbol) *Token {
 	line := psr.Lexer.line
 	col := psr.Lexer.col
-	t := psr.Lexer.next()
+	offset := psr.Lexer.index
+	t := psr.Lexer.peek()
 	if t.sym != sym {
-		panic(fmt.Sprintf(`syntax error: expected "%s", but got "%s", on line %d:%d`, sym, t.sym, line, col))
+		// the position after the previous token
+		panic(&SyntaxError{
+			Line:    line,
+			Column:  col,
+			Offset:  offset,
+			Message: fmt.Sprintf(`expected "%s", but got %s`, sym, t.describe()),
+		})
+	}
+	return psr.Lexer.next()
+}
+
+// convert the recovered value of parsing to error
+func recoverSyntaxError(e interface{}) error {
+	switch e := e.(type) {
+	case *SyntaxError:
+		return e
+	case error:
+		return &SyntaxError{Message: e.Error()}
 	}
-	return t
+	return &SyntaxError{Message: fmt.Sprint(e)}
 }
@@ -1,7 +1,9 @@
 package spiker_test
 
 import (
+	"errors"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	"github.com/shockerli/spiker"
@@ -10,6 +12,7 @@ import (
 var srcTests = []string{
 	"testdata/assign.src",
 	"testdata/collect.src",
+	"testdata/comment.src",
 	"testdata/function.src",
 	"testdata/operator.src",
 	"testdata/value.src",
@@ -48,3 +51,106 @@ func TestParser_Statements(t *testing.T) {
 		}
 	}
 }
+
+func TestParser_StatementsRecover(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		format string   // the parsed statements
+		errs   []string // the syntax errors
+	}{
+		{"valid", "a = 1;\nb = 2;", "a = 1;\nb = 2;", nil},
+		{
+			"statements",
+			"a = ;\nb = 2;\nc = 1 2;\nd = 4;",
+			"b = 2;\nd = 4;",
+			[]string{
+				`syntax error: unexpected ";" on line 1:5`,
+				`syntax error: expected ";", but got "2" on line 3:6`,
+			},
+		},
+		{
+			"block",
+			"if (a) {\n  b = ;\n  c = 3;\n}\nd = 4;",
+			"if (a) {\n    c = 3;\n}\nd = 4;",
+			[]string{`syntax error: unexpected ";" on line 2:7`},
+		},
+		{
+			"broken-block-statement",
+			"if (a b) {\n  c = 3;\n} else {\n  c = 4;\n}\nf = (x y) -> {\n  x;\n};\nd = 4;",
+			"d = 4;",
+			[]string{
+				`syntax error: expected ")", but got "b" on line 1:6`,
+				`syntax error: expected ")", but got "y" on line 6:7`,
+			},
+		},
+		{
+			"invalid-characters",
+			"a = 1 @ 2;\nb = 2;\nc = \"x;\nd = 4 $;",
+			"b = 2;",
+			[]string{
+				`syntax error: invalid character '@' on line 1:7`,
+				`syntax error: unterminated string on line 3:5`,
+				`syntax error: invalid character '$' on line 4:7`,
+			},
+		},
+		{
+			"unmatched-rbrace",
+			"a = 1;\n}\nb = 2;",
+			"a = 1;\nb = 2;",
+			[]string{`syntax error: unexpected "}" on line 2:1`},
+		},
+		{
+			"transform",
+			"1 = 2;\nb = 2;",
+			"b = 2;",
+			[]string{`syntax error: expected identifier, but got "1" on line 1:1`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, err := spiker.ParseAstRecover(tt.code)
+
+			var errs []string
+			if err != nil {
+				list, ok := err.(spiker.SyntaxErrors)
+				if !ok {
+					t.Fatalf("ParseAstRecover() error = %#v, want SyntaxErrors", err)
+				}
+				for _, e := range list {
+					errs = append(errs, e.Error())
+				}
+			}
+			if !reflect.DeepEqual(errs, tt.errs) {
+				t.Errorf("ParseAstRecover() errors = %q, want %q", errs, tt.errs)
+			}
+
+			if got, _ := spiker.FormatAst(ast); got != tt.format {
+				t.Errorf("ParseAstRecover() = %q, want %q", got, tt.format)
+			}
+		})
+	}
+}
+
+func TestParser_StatementsRecover_Error(t *testing.T) {
+	_, err := spiker.ParseAstRecover("a = ;\nb = ;\nc = ;")
+	if err == nil || err.Error() != `syntax error: unexpected ";" on line 1:5 (and 2 more errors)` {
+		t.Errorf("ParseAstRecover() error = %v", err)
+	}
+
+	// the first error is the same as the error of ParseAst
+	_, first := spiker.ParseAst("a = ;\nb = ;\nc = ;")
+	if list, ok := err.(spiker.SyntaxErrors); !ok || list[0].Error() != first.Error() {
+		t.Errorf("ParseAstRecover() error = %v, ParseAst() error = %v", err, first)
+	}
+
+	// errors.As and errors.Is find the error in the list
+	var se *spiker.SyntaxError
+	if !errors.As(err, &se) || se.Error() != first.Error() {
+		t.Errorf("errors.As() = %v, want %v", se, first)
+	}
+	list := err.(spiker.SyntaxErrors)
+	if !errors.Is(err, list[1]) || errors.Is(err, first) || errors.Is(spiker.SyntaxErrors{}, list[0]) {
+		t.Errorf("errors.Is() should match the errors in list only")
+	}
+}
@@ -0,0 +1,373 @@
+package spiker
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ProfileGlobal the function name of the top level statements in profile
+const ProfileGlobal = "global"
+
+// Profiler the tracer aggregates the call counts and time per function and per line,
+// it is safe for concurrent use
+type Profiler struct {
+	mu      sync.Mutex
+	start   time.Time
+	samples map[string]*profileSample // by the stack
+	calls   map[string]int            // the calls of function
+	execs   map[profileFrame]int      // the executions of line
+}
+
+// the line of function, 0 if unknown
+type profileFrame struct {
+	fn   string
+	line int
+}
+
+// the aggregated events of a stack
+type profileSample struct {
+	stack []profileFrame // the innermost first
+	count int
+	time  time.Duration // the self time
+}
+
+// ProfileEntry the profile of a function, or a line
+type ProfileEntry struct {
+	Func  string
+	Line  int           // 0 for the function
+	Count int           // the calls of function, or the executions of line
+	Flat  time.Duration // the time spent in itself
+	Cum   time.Duration // the time spent in itself and the called functions
+}
+
+// NewProfiler return a profiler, set it to engine by WithTracer
+func NewProfiler() *Profiler {
+	p := &Profiler{}
+	p.Reset()
+	return p
+}
+
+// Reset discard the profiled events
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	p.start = time.Now()
+	p.samples = make(map[string]*profileSample)
+	p.calls = make(map[string]int)
+	p.execs = make(map[profileFrame]int)
+	p.mu.Unlock()
+}
+
+// Enter .
+func (p *Profiler) Enter(ev *TraceEvent) {}
+
+// Exit record the self time of event with its stack
+func (p *Profiler) Exit(ev *TraceEvent) {
+	stack := profileStack(ev)
+	var key strings.Builder
+	for _, f := range stack {
+		key.WriteString(f.fn)
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(f.line))
+		key.WriteByte(';')
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &profileSample{stack: stack}
+		p.samples[key.String()] = s
+	}
+	s.count++
+	s.time += ev.Self()
+
+	if ev.Kind == TraceStatement {
+		p.execs[stack[0]]++
+	} else {
+		p.calls[ev.Name]++
+	}
+}
+
+// return the stack of event, the innermost first.
+// The line of frame is the statement being executed, or the call of function
+func profileStack(ev *TraceEvent) (stack []profileFrame) {
+	var line int
+	for e := ev; e != nil; e = e.Parent {
+		if e.Kind == TraceStatement {
+			if line == 0 {
+				line = e.Pos.Line
+			}
+			continue
+		}
+		stack = append(stack, profileFrame{fn: e.Name, line: line})
+		line = e.Pos.Line
+	}
+	return append(stack, profileFrame{fn: ProfileGlobal, line: line})
+}
+
+// Functions return the profile of functions, sorted by the flat and cum time
+func (p *Profiler) Functions() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := make(map[string]*ProfileEntry)
+	entry := func(fn string) *ProfileEntry {
+		e, ok := entries[fn]
+		if !ok {
+			e = &ProfileEntry{Func: fn}
+			entries[fn] = e
+		}
+		return e
+	}
+
+	for fn, n := range p.calls {
+		entry(fn).Count = n
+	}
+	for _, s := range p.samples {
+		entry(s.stack[0].fn).Flat += s.time
+		// the recursive call counts once
+		seen := make(map[string]bool)
+		for _, f := range s.stack {
+			if !seen[f.fn] {
+				seen[f.fn] = true
+				entry(f.fn).Cum += s.time
+			}
+		}
+	}
+
+	list := make([]ProfileEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	return sortProfile(list)
+}
+
+// Lines return the profile of source lines, sorted by the flat and cum time.
+// The time of builtin function is the flat time of the line calls it
+func (p *Profiler) Lines() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := make(map[profileFrame]*ProfileEntry)
+	entry := func(f profileFrame) *ProfileEntry {
+		e, ok := entries[f]
+		if !ok {
+			e = &ProfileEntry{Func: f.fn, Line: f.line}
+			entries[f] = e
+		}
+		return e
+	}
+
+	for f, n := range p.execs {
+		entry(f).Count = n
+	}
+	for _, s := range p.samples {
+		flat := true
+		seen := make(map[profileFrame]bool)
+		for _, f := range s.stack {
+			if f.line == 0 || seen[f] {
+				continue
+			}
+			seen[f] = true
+			e := entry(f)
+			if flat {
+				e.Flat += s.time
+				flat = false
+			}
+			e.Cum += s.time
+		}
+	}
+
+	list := make([]ProfileEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	return sortProfile(list)
+}
+
+// sort the entries by the flat and cum time, then the name and line
+func sortProfile(list []ProfileEntry) []ProfileEntry {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Flat != b.Flat {
+			return a.Flat > b.Flat
+		}
+		if a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		return a.Line < b.Line
+	})
+	return list
+}
+
+// WriteText write the profile of functions and lines as text report
+func (p *Profiler) WriteText(w io.Writer) error {
+	p.mu.Lock()
+	duration := time.Since(p.start)
+	p.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Duration: %s\n\n", duration.Round(time.Microsecond))
+	fmt.Fprint(tw, "flat\tcum\tcalls\t  function\n")
+	for _, e := range p.Functions() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t  %s\n", e.Flat.Round(time.Microsecond), e.Cum.Round(time.Microsecond), e.Count, e.Func)
+	}
+	fmt.Fprint(tw, "\nflat\tcum\tcount\tline\t  function\n")
+	for _, e := range p.Lines() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t  %s\n", e.Flat.Round(time.Microsecond), e.Cum.Round(time.Microsecond), e.Count, e.Line, e.Func)
+	}
+	return tw.Flush()
+}
+
+// WritePprof write the profile in the gzipped protobuf format of pprof,
+// the samples are the execution counts and self time of the stacks
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		i, ok := strs[s]
+		if !ok {
+			i = len(table)
+			strs[s] = i
+			table = append(table, s)
+		}
+		return uint64(i)
+	}
+	valueType := func(typ, unit string) func(b *protobuf) {
+		return func(b *protobuf) {
+			b.uint64(1, str(typ))
+			b.uint64(2, str(unit))
+		}
+	}
+
+	var b protobuf
+	b.message(1, valueType("executions", "count"))
+	b.message(1, valueType("time", "nanoseconds"))
+
+	// sort the samples for the stable output
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	funcs := make(map[string]uint64)
+	locs := make(map[profileFrame]uint64)
+	var funcList []string
+	var locList []profileFrame
+	for _, key := range keys {
+		s := p.samples[key]
+		ids := make([]uint64, len(s.stack))
+		for i, f := range s.stack {
+			if _, ok := funcs[f.fn]; !ok {
+				funcList = append(funcList, f.fn)
+				funcs[f.fn] = uint64(len(funcList))
+			}
+			if _, ok := locs[f]; !ok {
+				locList = append(locList, f)
+				locs[f] = uint64(len(locList))
+			}
+			ids[i] = locs[f]
+		}
+		b.message(2, func(b *protobuf) {
+			b.packed(1, ids)
+			b.packed(2, []uint64{uint64(s.count), uint64(s.time)})
+		})
+	}
+
+	for i, f := range locList {
+		b.message(4, func(b *protobuf) {
+			b.uint64(1, uint64(i+1))
+			b.message(4, func(b *protobuf) {
+				b.uint64(1, funcs[f.fn])
+				b.uint64(2, uint64(f.line))
+			})
+		})
+	}
+	for i, fn := range funcList {
+		b.message(5, func(b *protobuf) {
+			b.uint64(1, uint64(i+1))
+			b.uint64(2, str(fn))
+			b.uint64(3, str(fn))
+		})
+	}
+
+	b.uint64(9, uint64(p.start.UnixNano()))
+	b.uint64(10, uint64(time.Since(p.start)))
+	b.message(11, valueType("time", "nanoseconds"))
+	b.uint64(12, 1)
+	b.uint64(14, str("time"))
+	// the string table is the last, all strings are collected
+	for _, s := range table {
+		b.string(6, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protobuf the encoder of protocol buffers wire format
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// the varint field, omitted if zero
+func (b *protobuf) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+// the length-delimited field
+func (b *protobuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protobuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+// the repeated varint field, packed
+func (b *protobuf) packed(field int, xs []uint64) {
+	var p protobuf
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.data)
+}
+
+// the embedded message field
+func (b *protobuf) message(field int, encode func(b *protobuf)) {
+	var m protobuf
+	encode(&m)
+	b.bytes(field, m.data)
+}
@@ -0,0 +1,173 @@
+package spiker_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+const profileCode = `fib = n -> {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+};
+i = 0;
+while (i < 3) {
+    s = fib(4) + len([i]);
+    i += 1;
+}
+`
+
+func TestProfiler(t *testing.T) {
+	p := spiker.NewProfiler()
+	e := spiker.New(spiker.WithTracer(p))
+	for i := 0; i < 2; i++ {
+		if _, err := e.Execute(profileCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := make(map[string]int)
+	var flat, global int64
+	for _, f := range p.Functions() {
+		counts[f.Func] = f.Count
+		flat += int64(f.Flat)
+		if f.Flat < 0 || f.Flat > f.Cum {
+			t.Errorf("%s: flat %s, cum %s", f.Func, f.Flat, f.Cum)
+		}
+		if f.Func == spiker.ProfileGlobal {
+			global = int64(f.Cum)
+		}
+	}
+	// fib(4) calls fib 9 times
+	if counts["fib"] != 54 || counts["len"] != 6 || counts[spiker.ProfileGlobal] != 0 || len(counts) != 3 {
+		t.Errorf("calls = %v", counts)
+	}
+	if flat != global {
+		t.Errorf("the sum of flat %d, want the cum of global %d", flat, global)
+	}
+
+	lines := make(map[string]int)
+	for _, l := range p.Lines() {
+		lines[l.Func+":"+strconv.Itoa(l.Line)] = l.Count
+	}
+	expect := map[string]int{
+		"global:1": 2, "global:7": 2, "global:8": 2, "global:9": 6, "global:10": 6,
+		"fib:2": 54, "fib:3": 30, "fib:5": 24,
+	}
+	for k, n := range expect {
+		if lines[k] != n {
+			t.Errorf("executions of %s = %d, want %d", k, lines[k], n)
+		}
+	}
+
+	var text bytes.Buffer
+	if err := p.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Duration: ", "flat  ", "calls  function\n", "54  fib\n", "count  line  function\n", "54     2  fib\n"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("text report doesn't contain %q:\n%s", s, text.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := decodeProtobuf(t, data)
+	var strs []string
+	for _, s := range fields[6] {
+		strs = append(strs, string(s))
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table = %q", strs)
+	}
+	for _, s := range []string{"executions", "count", "time", "nanoseconds", "fib", "len", spiker.ProfileGlobal} {
+		if !strings.Contains(strings.Join(strs, "\n")+"\n", "\n"+s+"\n") {
+			t.Errorf("string table doesn't contain %q: %q", s, strs)
+		}
+	}
+	// sample types, functions, and the samples with 2 values
+	if len(fields[1]) != 2 || len(fields[5]) != 3 || len(fields[2]) == 0 || len(fields[4]) == 0 {
+		t.Errorf("fields = %d sample types, %d functions, %d samples, %d locations", len(fields[1]), len(fields[5]), len(fields[2]), len(fields[4]))
+	}
+	var executions uint64
+	for _, sample := range fields[2] {
+		values := decodeProtobuf(t, sample)[2]
+		if len(values) != 1 {
+			t.Fatalf("sample = %v", sample)
+		}
+		executions += decodeVarints(t, values[0])[0]
+	}
+	// statements and calls
+	if executions != 2+2+2+6+6+54+30+24+54+6 {
+		t.Errorf("executions = %d", executions)
+	}
+
+	p.Reset()
+	if len(p.Functions()) != 0 || len(p.Lines()) != 0 {
+		t.Error("Reset() should discard the profile")
+	}
+}
+
+// decode the length-delimited fields of message, by the field number
+func decodeProtobuf(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := decodeVarint(t, data)
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			_, n = decodeVarint(t, data)
+			data = data[n:]
+		case 2:
+			size, n := decodeVarint(t, data)
+			data = data[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:size])
+			data = data[size:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// decode the packed varints
+func decodeVarints(t *testing.T, data []byte) (xs []uint64) {
+	for len(data) > 0 {
+		x, n := decodeVarint(t, data)
+		xs = append(xs, x)
+		data = data[n:]
+	}
+	return
+}
+
+func decodeVarint(t *testing.T, data []byte) (x uint64, n int) {
+	for shift := uint(0); n < len(data); shift += 7 {
+		b := data[n]
+		n++
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return
+		}
+	}
+	t.Fatal("truncated varint")
+	return
+}
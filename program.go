@@ -0,0 +1,226 @@
+package spiker
+
+import (
+	"context"
+	"sort"
+)
+
+// Program compiled program, it is immutable and safe for concurrent use,
+// could be run many times with different scopes
+type Program struct {
+	engine    *Engine
+	source    string
+	ast       []AstNode
+	variables []string
+	functions []string
+	code      *bytecode
+}
+
+// Compile parse and validate the code with the default engine
+func Compile(code string) (*Program, error) {
+	return defaultEngine.Compile(code)
+}
+
+// Compile parse and validate the code, return a reusable program
+func (e *Engine) Compile(code string) (*Program, error) {
+	ast, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate(ast); err != nil {
+		return nil, err
+	}
+	if e.optimize {
+		ast = Optimize(ast)
+	}
+
+	c := &programCollector{
+		assigned:  make(map[string]bool),
+		variables: make(map[string]bool),
+		defined:   make(map[string]bool),
+		calls:     make(map[string]bool),
+	}
+	c.collectList(ast, true)
+
+	p := &Program{
+		engine: e,
+		source: code,
+		ast:    ast,
+	}
+	if e.bytecode {
+		// fallback to the tree-walking evaluator if unsupported
+		if code, err := compileBytecode(ast); err == nil {
+			p.code = code
+		}
+	}
+
+	for name := range c.variables {
+		p.variables = append(p.variables, name)
+	}
+	for name := range c.calls {
+		if !c.defined[name] {
+			p.functions = append(p.functions, name)
+		}
+	}
+	sort.Strings(p.variables)
+	sort.Strings(p.functions)
+
+	return p, nil
+}
+
+// Run evaluate the program with scope, a new global scope is used if scope is nil
+func (p *Program) Run(scope *VariableScope) (interface{}, error) {
+	return p.RunContext(context.Background(), scope)
+}
+
+// RunContext same as Run, the evaluation is interrupted
+// when the context is canceled or its deadline is exceeded
+func (p *Program) RunContext(ctx context.Context, scope *VariableScope) (interface{}, error) {
+	if scope == nil {
+		scope = NewScopeTable("GLOBAL", 1, nil)
+	}
+
+	if p.code != nil && p.engine.tracer == nil {
+		defer p.engine.bind(ctx, scope)()
+		return p.code.run(scope)
+	}
+
+	return p.engine.EvaluateContext(ctx, p.ast, scope)
+}
+
+// Bytecode report whether the program runs on the virtual machine
+func (p *Program) Bytecode() bool {
+	return p.code != nil
+}
+
+// Source return the source code of the program
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Ast return a deep copy of the ast nodes, modifying them doesn't change the program
+func (p *Program) Ast() []AstNode {
+	nodes := make([]AstNode, 0, len(p.ast))
+	for _, node := range p.ast {
+		// the identity rewrite copies the nodes with children, the leaves are copied by copyLeaf
+		c, _ := Rewrite(node, copyLeaf)
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+// return a copy of the leaf node, the others are returned as is
+func copyLeaf(node AstNode) AstNode {
+	switch n := node.(type) {
+	case *NodeVariable:
+		c := *n
+		return &c
+	case *NodeString:
+		c := *n
+		return &c
+	case *NodeNumber:
+		c := *n
+		return &c
+	case *NodeBool:
+		c := *n
+		return &c
+	case *NodeBreak:
+		c := *n
+		return &c
+	case *NodeContinue:
+		c := *n
+		return &c
+	}
+	return node
+}
+
+// Variables return the names of variables which are read before assigned,
+// they are expected to be provided by the host scope
+func (p *Program) Variables() []string {
+	return append([]string(nil), p.variables...)
+}
+
+// Functions return the names of functions which are called but not defined
+// by the program, they are expected to be builtin functions
+func (p *Program) Functions() []string {
+	return append([]string(nil), p.functions...)
+}
+
+// validate the ast nodes, report the unsupported expression
+func validate(nodes []AstNode) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoverSyntaxError(e)
+		}
+	}()
+
+	for _, node := range nodes {
+		if node == nil {
+			panic(nodeSyntaxError(nil, "unsupported expression"))
+		}
+		Inspect(node, validateNode)
+	}
+
+	return
+}
+
+// report the unsupported expression, which is the nil child of node
+func validateNode(node AstNode) bool {
+	for _, child := range children(node) {
+		if child == nil {
+			panic(nodeSyntaxError(node, "unsupported expression"))
+		}
+	}
+	return true
+}
+
+// collect the variables and functions of program
+type programCollector struct {
+	assigned  map[string]bool // assigned variables of global scope
+	variables map[string]bool // variables read before assigned
+	defined   map[string]bool // defined functions
+	calls     map[string]bool // called functions
+}
+
+// `global` means the nodes run in the global scope,
+// the function body can not read the variables of host scope
+func (c *programCollector) collectList(nodes []AstNode, global bool) {
+	for _, node := range nodes {
+		c.collect(node, global)
+	}
+}
+
+func (c *programCollector) collect(node AstNode, global bool) {
+	Inspect(node, func(node AstNode) bool {
+		switch node := node.(type) {
+		case *NodeVariable:
+			if global && !c.assigned[node.Value] {
+				c.variables[node.Value] = true
+			}
+
+		case *NodeAssignOp:
+			// the variable is assigned after the expression is evaluated
+			c.collect(node.Expr, global)
+			if node.Op != SymbolAssign {
+				c.collect(&node.Var, global)
+			}
+			if global {
+				c.assigned[node.Var.Value] = true
+			}
+			return false
+
+		case *NodeFuncCallOp:
+			// the name of function isn't a variable
+			c.calls[node.Name.Value] = true
+			c.collectList(node.Params, global)
+			return false
+
+		case *NodeFuncDef:
+			c.defined[node.Name.Value] = true
+			c.collectList(node.Body, false)
+			return false
+		}
+		return true
+	})
+}
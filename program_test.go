@@ -0,0 +1,140 @@
+package spiker_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestCompile(t *testing.T) {
+	for _, file := range srcTests {
+		if _, err := spiker.Compile(readFile(file)); err != nil {
+			t.Errorf("Compile(%s) error = %v", file, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{"valid", `a = 1 + b;`, false},
+		{"syntax-error", `a = ;`, true},
+		{"unsupported-tuple", `a = (1, 2);`, true},
+		{"unsupported-none", `a = [none];`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := spiker.Compile(tt.code); (err != nil) != tt.wantErr {
+				t.Errorf("Compile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProgram_Introspection(t *testing.T) {
+	src := `
+total = price * count;
+add = (a, b) -> {
+    c = a + b;
+    return max(c, limit);
+};
+if (vip) {
+    total = add(total, discount);
+}
+total += fee;
+export(total);`
+
+	p, err := spiker.Compile(src)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if p.Source() != src {
+		t.Errorf("Source() = %q", p.Source())
+	}
+	if len(p.Ast()) != 5 {
+		t.Errorf("Ast() length = %d, want %d", len(p.Ast()), 5)
+	}
+
+	// the returned nodes are a copy
+	ast := p.Ast()
+	spiker.Inspect(ast[0], func(node spiker.AstNode) bool {
+		switch n := node.(type) {
+		case *spiker.NodeVariable:
+			n.Value = "changed"
+		case *spiker.NodeBinaryOp:
+			n.Op = spiker.SymbolAdd
+		}
+		return true
+	})
+	ast[1].(*spiker.NodeFuncDef).Body = nil
+	if got, _ := spiker.FormatAst(p.Ast()[:2]); got != "total = price * count;\nadd = (a, b) -> {\n    c = a + b;\n    return max(c, limit);\n};" {
+		t.Errorf("Ast() is modified by the copy:\n%s", got)
+	}
+
+	wantVars := []string{"count", "discount", "fee", "price", "vip"}
+	if !reflect.DeepEqual(p.Variables(), wantVars) {
+		t.Errorf("Variables() = %v, want %v", p.Variables(), wantVars)
+	}
+
+	wantFuncs := []string{"export", "max"}
+	if !reflect.DeepEqual(p.Functions(), wantFuncs) {
+		t.Errorf("Functions() = %v, want %v", p.Functions(), wantFuncs)
+	}
+}
+
+func TestProgram_Run(t *testing.T) {
+	p, err := spiker.Compile(`
+double = x -> x * 2;
+export(double(a) + b);`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if val, err := p.Run(nil); err != nil || val != "0" {
+		t.Errorf("Run(nil) = %v, %v", val, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for n := 0; n < 100; n++ {
+				scope := spiker.NewScopeTable("run", 1, nil)
+				scope.Set("a", i)
+				scope.Set("b", n)
+
+				val, err := p.Run(scope)
+				if err != nil {
+					t.Errorf("Run() error = %v", err)
+					return
+				}
+				if val != float64(i*2+n) {
+					t.Errorf("Run() = %v, want %v", val, i*2+n)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkProgram_Run(b *testing.B) {
+	p, err := spiker.Compile(readFile("testdata/collect.src"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := p.Run(nil); err != nil {
+			b.Log(err)
+			b.Fail()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package spiker
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Result the value of script, could be decoded to the Go value
+type Result struct {
+	value interface{}
+}
+
+// NewResult return the Result of the value returned by Execute or Evaluate,
+// the values of multi-value `return` are treated as ValueList
+func NewResult(val interface{}) *Result {
+	if tuples, ok := val.([]interface{}); ok {
+		val = ValueList(tuples)
+	}
+	return &Result{value: val}
+}
+
+// ExecuteInto execute the code with the default engine, and decode the result into target
+func ExecuteInto(code string, scope *VariableScope, target interface{}) error {
+	return defaultEngine.ExecuteInto(code, scope, target)
+}
+
+// ExecuteInto execute the code, and decode the result into target,
+// a new global scope is used if scope is nil
+func (e *Engine) ExecuteInto(code string, scope *VariableScope, target interface{}) error {
+	if scope == nil {
+		scope = NewScopeTable("GLOBAL", 1, nil)
+	}
+	val, err := e.ExecuteWithScope(code, scope)
+	if err != nil {
+		return err
+	}
+
+	return NewResult(val).Decode(target)
+}
+
+// Value return the original value
+func (r *Result) Value() interface{} {
+	return r.value
+}
+
+// IsNil whether the value is nil
+func (r *Result) IsNil() bool {
+	return r.value == nil
+}
+
+// Decode store the value in the Go value pointed to by target, the values
+// are converted in the reverse way of ToValue:
+//
+// - number is converted to int, uint and float kinds, but the fraction or overflow is an error
+// - list is converted to slice and array
+// - map is converted to map and struct, the fields are matched the same as ToValue
+// - string is converted to []byte, and time.Time in RFC3339 format
+// - nil is converted to pointer, slice, map and interface
+// - interface{} receives the value as it is
+func (r *Result) Decode(target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer, but got %T", target)
+	}
+
+	d := valueDecoder{}
+	return d.decodeInto(r.value, rv.Elem())
+}
+
+// Int return the value as int
+func (r *Result) Int() (n int, err error) {
+	err = r.Decode(&n)
+	return
+}
+
+// Float return the value as float64
+func (r *Result) Float() (f float64, err error) {
+	err = r.Decode(&f)
+	return
+}
+
+// AsString return the value as string
+func (r *Result) AsString() (s string, err error) {
+	err = r.Decode(&s)
+	return
+}
+
+// Bool return the value as bool
+func (r *Result) Bool() (b bool, err error) {
+	err = r.Decode(&b)
+	return
+}
+
+// List return the value as ValueList
+func (r *Result) List() (ValueList, error) {
+	list, ok := r.value.(ValueList)
+	if !ok {
+		return nil, fmt.Errorf("cannot use %s as list", valueTypeName(r.value))
+	}
+	return list, nil
+}
+
+// Map return the value as ValueMap
+func (r *Result) Map() (ValueMap, error) {
+	dict, ok := r.value.(ValueMap)
+	if !ok {
+		return nil, fmt.Errorf("cannot use %s as map", valueTypeName(r.value))
+	}
+	return dict, nil
+}
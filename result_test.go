@@ -0,0 +1,187 @@
+package spiker_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shockerli/spiker"
+)
+
+type resultLine struct {
+	SKU   string  `spiker:"sku"`
+	Qty   uint16  `spiker:"qty"`
+	Price float32 `spiker:"price"`
+}
+
+type resultMeta struct {
+	Source string `spiker:"source"`
+}
+
+type resultOrder struct {
+	resultMeta
+	ID      int64             `spiker:"id"`
+	Lines   []resultLine      `spiker:"lines"`
+	Tags    [2]string         `spiker:"tags"`
+	Attrs   map[string]int    `spiker:"attrs"`
+	Flags   map[int]bool      `spiker:"flags"`
+	Paid    *bool             `spiker:"paid"`
+	Created time.Time         `spiker:"created"`
+	Note    []byte            `spiker:"note"`
+	Extra   interface{}       `spiker:"extra"`
+	Skip    string            `spiker:"-"`
+	Other   map[string]string `spiker:"other"`
+	Name    string
+}
+
+func TestExecuteInto(t *testing.T) {
+	code := `
+lines = [["sku": "A1", "qty": 2, "price": 1.5], ["sku": "B2", "qty": 1, "price": 0.1]];
+[
+    "source": "web",
+    "id": 1001,
+    "lines": lines,
+    "tags": ["new", "vip"],
+    "attrs": ["x": 1],
+    "flags": ["7": true],
+    "paid": true,
+    "created": "2021-03-04T05:06:07Z",
+    "note": "hello",
+    "extra": [1, "a"],
+    "Skip": "skip",
+    "other": nil,
+    "Name": "n",
+    "unknown": 1,
+];
+`
+	var got resultOrder
+	got.Skip = "keep"
+	if err := spiker.ExecuteInto(code, nil, &got); err != nil {
+		t.Fatalf("ExecuteInto() error = %v", err)
+	}
+
+	paid := true
+	want := resultOrder{
+		resultMeta: resultMeta{Source: "web"},
+		ID:         1001,
+		Lines:      []resultLine{{"A1", 2, 1.5}, {"B2", 1, 0.1}},
+		Tags:       [2]string{"new", "vip"},
+		Attrs:      map[string]int{"x": 1},
+		Flags:      map[int]bool{7: true},
+		Paid:       &paid,
+		Created:    time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Note:       []byte("hello"),
+		Extra:      spiker.ValueList{float64(1), "a"},
+		Skip:       "keep",
+		Name:       "n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExecuteInto() = %#v, want %#v", got, want)
+	}
+}
+
+func TestExecuteInto_Error(t *testing.T) {
+	var order resultOrder
+	var n int
+	tests := []struct {
+		code   string
+		target interface{}
+		err    string
+	}{
+		{`["lines": [["qty": -1]]];`, &order, "cannot use -1 as uint16 at lines[0].qty"},
+		{`["lines": [["sku": 1]]];`, &order, "cannot use number as string at lines[0].sku"},
+		{`["tags": ["a"]];`, &order, "cannot use list of length 1 as [2]string at tags"},
+		{`["flags": ["x": true]];`, &order, "cannot use string as number at flags.x"},
+		{`["created": "today"];`, &order, `cannot parse "today" as time at created`},
+		{`["id": nil];`, &order, "cannot use nil as number at id"},
+		{`[1];`, &order, "cannot use list as map"},
+		{`1.5;`, &n, "cannot use 1.5 as int"},
+		{`1;`, n, "decode target must be a non-nil pointer, but got int"},
+		{`1;`, nil, "decode target must be a non-nil pointer, but got <nil>"},
+		{`a +;`, &n, `syntax error: unexpected ";" on line 1:4`},
+	}
+	for _, tt := range tests {
+		err := spiker.ExecuteInto(tt.code, nil, tt.target)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ExecuteInto(%q) error = %v, want %s", tt.code, err, tt.err)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	val, err := spiker.Execute(`f = price -> { return (price * 2, "total", [1]); }; f(2.5);`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	var tuple struct {
+		Total float64
+		Label string
+		Items []int
+	}
+	var values []interface{}
+	var first float64
+	r := spiker.NewResult(val)
+	if err := r.Decode(&values); err != nil || len(values) != 3 {
+		t.Errorf("Decode() = %v, %v", values, err)
+	}
+	if list, err := r.List(); err != nil || len(list) != 3 {
+		t.Errorf("List() = %v, %v", list, err)
+	}
+	if err := spiker.NewResult(values[0]).Decode(&first); err != nil || first != 5 {
+		t.Errorf("Decode() = %v, %v", first, err)
+	}
+	if err := r.Decode(&tuple); err == nil {
+		t.Errorf("Decode() = %v, want error", tuple)
+	}
+
+	tests := []struct {
+		val  interface{}
+		fn   string
+		want interface{}
+		err  string
+	}{
+		{val: 3, fn: "Int", want: 3},
+		{val: float64(3), fn: "Int", want: 3},
+		{val: 3.5, fn: "Int", err: "cannot use 3.5 as int"},
+		{val: "3", fn: "Int", err: "cannot use string as number"},
+		{val: 3, fn: "Float", want: float64(3)},
+		{val: nil, fn: "Float", err: "cannot use nil as number"},
+		{val: "s", fn: "AsString", want: "s"},
+		{val: true, fn: "AsString", err: "cannot use bool as string"},
+		{val: true, fn: "Bool", want: true},
+		{val: 1, fn: "Bool", err: "cannot use number as bool"},
+		{val: spiker.ValueList{1}, fn: "List", want: spiker.ValueList{1}},
+		{val: spiker.ValueMap{}, fn: "List", err: "cannot use map as list"},
+		{val: spiker.ValueMap{"a": 1}, fn: "Map", want: spiker.ValueMap{"a": 1}},
+		{val: nil, fn: "Map", err: "cannot use nil as map"},
+	}
+	for _, tt := range tests {
+		r := spiker.NewResult(tt.val)
+		var got interface{}
+		var err error
+		switch tt.fn {
+		case "Int":
+			got, err = r.Int()
+		case "Float":
+			got, err = r.Float()
+		case "AsString":
+			got, err = r.AsString()
+		case "Bool":
+			got, err = r.Bool()
+		case "List":
+			got, err = r.List()
+		case "Map":
+			got, err = r.Map()
+		}
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s(%#v) error = %v, want %s", tt.fn, tt.val, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s(%#v) = %#v, %v, want %#v", tt.fn, tt.val, got, err, tt.want)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package spiker
 
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
 // VariableScope variable scope
 type VariableScope struct {
 	scopeName      string
 	scopeLevel     int
 	vars           map[string]interface{}
 	enclosingScope *VariableScope
+	exec           *execution
+	version        uint64 // increased on every change
 }
 
 // NewScopeTable return a new VariableScope
@@ -15,12 +23,32 @@ func NewScopeTable(scopeName string, scopeLevel int, scope *VariableScope) *Vari
 	vs.scopeName = scopeName
 	vs.scopeLevel = scopeLevel
 	vs.enclosingScope = scope
+	if scope != nil {
+		vs.exec = scope.exec
+	}
 	return vs
 }
 
-// Set store variable values
+// Set store variable values, the Go value is converted by ToValue,
+// the variable is not changed if the conversion fails, see SetValue
 func (scope *VariableScope) Set(variable string, val interface{}) {
+	_ = scope.SetValue(variable, val)
+}
+
+// SetValue store variable values as Set, and report the error of conversion
+func (scope *VariableScope) SetValue(variable string, val interface{}) error {
+	v, err := ToValue(val)
+	if err != nil {
+		return err
+	}
+	scope.set(variable, v)
+	return nil
+}
+
+// store the value of script
+func (scope *VariableScope) set(variable string, val interface{}) {
 	scope.vars[variable] = val
+	scope.version++
 }
 
 // Get fetch variable values
@@ -38,9 +66,66 @@ func (scope *VariableScope) Get(variable string) (interface{}, bool) {
 // Del delete a variable
 func (scope *VariableScope) Del(variable string) {
 	delete(scope.vars, variable)
+	scope.version++
 }
 
 // Clean clean all of the vars
 func (scope *VariableScope) Clean() {
 	scope.vars = make(map[string]interface{})
+	scope.version++
+}
+
+// Name return the name of scope
+func (scope *VariableScope) Name() string {
+	return scope.scopeName
+}
+
+// Level return the level of scope, the function call increases it
+func (scope *VariableScope) Level() int {
+	return scope.scopeLevel
+}
+
+// Enclosing return the enclosing scope, nil if none
+func (scope *VariableScope) Enclosing() *VariableScope {
+	return scope.enclosingScope
+}
+
+// Vars return a copy of the variables of scope, not include the enclosing scopes and functions
+func (scope *VariableScope) Vars() map[string]interface{} {
+	vars := make(map[string]interface{}, len(scope.vars))
+	for name, val := range scope.vars {
+		if !strings.HasPrefix(name, "_custom_func_") {
+			vars[name] = val
+		}
+	}
+	return vars
+}
+
+// Funcs return the functions defined by script in scope, sorted by name
+func (scope *VariableScope) Funcs() []*NodeFuncDef {
+	var funcs []*NodeFuncDef
+	for name, val := range scope.vars {
+		if fnd, ok := val.(*NodeFuncDef); ok && strings.HasPrefix(name, "_custom_func_") {
+			funcs = append(funcs, fnd)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Name.Value < funcs[j].Name.Value
+	})
+	return funcs
+}
+
+// return the execution state bound to the scope,
+// fallback to the default engine when evaluating outside of an engine
+func (scope *VariableScope) execution() *execution {
+	if scope.exec != nil {
+		return scope.exec
+	}
+	return &execution{engine: defaultEngine, ctx: context.Background(), limits: defaultEngine.limits}
+}
+
+// Context return the context of the current evaluation,
+// builtin functions could use it to honour cancellation
+func (scope *VariableScope) Context() context.Context {
+	return scope.execution().ctx
 }
@@ -0,0 +1,39 @@
+package spiker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestVariableScope_VarsFuncs(t *testing.T) {
+	code := `a = 1; b = [1, "x"]; sum = (x, y) -> x + y; dbl = x -> x * 2; c = sum(a, 2);`
+
+	for _, bytecode := range []bool{false, true} {
+		parent := spiker.NewScopeTable("parent", 1, nil)
+		parent.Set("p", 1)
+		scope := spiker.NewScopeTable("vars", 2, parent)
+		if _, err := spiker.New(spiker.WithBytecode(bytecode)).ExecuteWithScope(code, scope); err != nil {
+			t.Fatalf("ExecuteWithScope() error = %v", err)
+		}
+
+		want := map[string]interface{}{"a": float64(1), "b": spiker.ValueList{float64(1), "x"}, "c": float64(3)}
+		if got := scope.Vars(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Vars() = %v, want %v", got, want)
+		}
+
+		var names []string
+		for _, fnd := range scope.Funcs() {
+			names = append(names, fnd.Name.Value)
+		}
+		if !reflect.DeepEqual(names, []string{"dbl", "sum"}) {
+			t.Errorf("Funcs() = %v", names)
+		}
+
+		scope.Clean()
+		if len(scope.Vars()) != 0 || len(scope.Funcs()) != 0 {
+			t.Error("Clean() should remove the variables and functions")
+		}
+	}
+}
@@ -1,17 +1,15 @@
 package spiker
 
 import (
-	"crypto/sha1"
+	"context"
+	"sort"
 	"strings"
-	"sync"
+	"unicode"
 )
 
-// EnableAstCache enable ast cache, default is false
+// EnableAstCache enable ast cache of the default engine, default is false
 var EnableAstCache = false
 
-// cachedAst cached ast node map
-var cachedAst = sync.Map{}
-
 // Execute return the computed result of a string expression
 func Execute(code string) (val interface{}, err error) {
 	ast, err := ParseAst(code)
@@ -32,12 +30,26 @@ func ExecuteWithScope(code string, scope *VariableScope) (val interface{}, err e
 	return EvaluateWithScope(ast, scope)
 }
 
+// ExecuteContext same as ExecuteWithScope, the execution is interrupted
+// when the context is canceled or its deadline is exceeded
+func ExecuteContext(ctx context.Context, code string, scope *VariableScope) (val interface{}, err error) {
+	ast, err := ParseAst(code)
+	if err != nil {
+		return
+	}
+
+	return EvaluateContext(ctx, ast, scope)
+}
+
 // Format return the formatted expression
 func Format(code string) (s string, err error) {
 	ast, err := ParseAst(code)
 	if err != nil {
 		return
 	}
+	if len(ast) == 0 {
+		return formatComments(code)
+	}
 
 	return FormatAst(ast)
 }
@@ -45,14 +57,44 @@ func Format(code string) (s string, err error) {
 // ParseAst lexer, statements, transform, and return the ast nodes
 // if EnableAstCache is true, it will cache the ast nodes
 func ParseAst(code string) (ast []AstNode, err error) {
-	// get cached ast nodes
-	hashKey := sha1.Sum([]byte(code))
-	if EnableAstCache {
-		if ast, ok := cachedAst.Load(hashKey); ok {
-			return ast.([]AstNode), nil
+	return defaultEngine.parseAst(code, EnableAstCache)
+}
+
+// ParseAstRecover same as ParseAst, but keep parsing after syntax error,
+// return the ast nodes of valid statements, and all syntax errors as SyntaxErrors
+func ParseAstRecover(code string) (ast []AstNode, err error) {
+	p := Parser{Lexer: NewLexer(padSemicolon(code))}
+	stmts, err := p.StatementsRecover()
+
+	var errs SyntaxErrors
+	if err != nil {
+		errs = err.(SyntaxErrors)
+	}
+
+	// transform the statements one by one, drop the broken statement
+	var toks []*Token
+	for _, stmt := range stmts {
+		nodes, err := Transform([]*Token{stmt})
+		if err != nil {
+			errs = append(errs, err.(*SyntaxError))
+			continue
 		}
+		ast = append(ast, nodes...)
+		toks = append(toks, stmt)
 	}
+	attachComments(ast, toks, p.Lexer.Comments())
 
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Offset < errs[j].Offset
+		})
+		return ast, errs
+	}
+	return ast, nil
+}
+
+// lexer, parser, transform
+func parse(code string) (ast []AstNode, err error) {
 	// padding semicolon
 	code = padSemicolon(code)
 
@@ -72,20 +114,58 @@ func ParseAst(code string) (ast []AstNode, err error) {
 		return
 	}
 
-	// cache ast nodes
-	if EnableAstCache {
-		cachedAst.Store(hashKey, ast)
-	}
-
+	// keep the comments for formatting
+	attachComments(ast, stmts, lexer.Comments())
 	return
 }
 
-// padding semicolon
+// padding semicolon, keep the leading spaces for the token positions
 func padSemicolon(code string) string {
-	code = strings.TrimSpace(code)
-	last := code[len(code)-1:]
+	code = strings.TrimRightFunc(code, unicode.IsSpace)
+	stmts := trimComments(code)
+	if len(stmts) == 0 {
+		return code
+	}
+	last := stmts[len(stmts)-1:]
 	if last != SymbolSemicolon.String() && last != SymbolRbrace.String() {
+		// not in the comment at the end
+		if len(stmts) < len(code) {
+			code += "\n"
+		}
 		code += SymbolSemicolon.String()
 	}
 	return code
 }
+
+// remove the comments and spaces at the end of code
+func trimComments(code string) string {
+	for {
+		code = strings.TrimRightFunc(code, unicode.IsSpace)
+		start := strings.LastIndexByte(code, '\n') + 1
+		idx := commentIndex(code[start:])
+		if idx < 0 {
+			return code
+		}
+		code = code[:start+idx]
+	}
+}
+
+// return the index of comment in line, -1 if none
+func commentIndex(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
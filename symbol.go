@@ -37,6 +37,7 @@ const (
 	SymbolLbrace      Symbol = "{"
 	SymbolRbrace      Symbol = "}"
 	SymbolComma       Symbol = ","
+	SymbolDot         Symbol = "."
 	SymbolFuncDeclare Symbol = "->"
 
 	// mathematical
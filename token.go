@@ -15,11 +15,17 @@ type Token struct {
 	value        string
 	line         int // Line
 	col          int // Column
+	offset       int // Byte offset
+	endLine      int // the position after the token
+	endCol       int
+	endOffset    int
 	bindingPower int // Priority
 	nud          nudFn
 	led          ledFn
 	std          stdFn
 	key          *Token // for NodeMap
+	end          *Token // the closing token of group, such as ")", "]" and "}"
+	paren        *Token // the enclosing "(" of grouped expression
 	children     []*Token
 }
 
@@ -4,12 +4,13 @@ type tokenRegistry struct {
 	symTable map[Symbol]*Token
 }
 
-func (reg *tokenRegistry) token(sym Symbol, value string, line int, col int) *Token {
+func (reg *tokenRegistry) token(sym Symbol, value string, line int, col int, offset int) *Token {
 	return &Token{
 		sym:          sym,
 		value:        value,
 		line:         line,
 		col:          col,
+		offset:       offset,
 		bindingPower: reg.symTable[sym].bindingPower,
 		nud:          reg.symTable[sym].nud,
 		led:          reg.symTable[sym].led,
@@ -0,0 +1,146 @@
+package spiker
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// TokenKind the kind of token for highlighting
+type TokenKind int
+
+// Supported token kinds
+const (
+	TokenInvalid     TokenKind = iota // the invalid character or unterminated string
+	TokenKeyword                      // if, else, while, in, true, ...
+	TokenIdent                        // the name of variable or function
+	TokenNumber                       // 123, 1.23
+	TokenString                       // "abc"
+	TokenOperator                     // +, ==, =, ->, ...
+	TokenPunctuation                  // (, ), [, ], {, }, ",", ";", ":" and "."
+	TokenComment                      // # comment
+)
+
+var tokenKindNames = map[TokenKind]string{
+	TokenInvalid:     "invalid",
+	TokenKeyword:     "keyword",
+	TokenIdent:       "identifier",
+	TokenNumber:      "number",
+	TokenString:      "string",
+	TokenOperator:    "operator",
+	TokenPunctuation: "punctuation",
+	TokenComment:     "comment",
+}
+
+func (kind TokenKind) String() string {
+	return tokenKindNames[kind]
+}
+
+// TokenInfo the token in source
+type TokenInfo struct {
+	Kind   TokenKind
+	Symbol Symbol   // the symbol of token, empty for the invalid token and comment
+	Text   string   // the source text of token, such as the quoted string
+	Pos    Position // the position of the first character
+	End    Position // the position after the token
+}
+
+// Tokenize return the tokens and comments of code in source order,
+// stop at the first invalid token, and return the scanned tokens with SyntaxError
+func Tokenize(code string) ([]TokenInfo, error) {
+	return tokenize(code, false)
+}
+
+// TokenizeRecover same as Tokenize, but the invalid character or unterminated string
+// is returned as the invalid token, and keep going.
+// Return all tokens, and the errors of invalid tokens as SyntaxErrors
+func TokenizeRecover(code string) ([]TokenInfo, error) {
+	return tokenize(code, true)
+}
+
+func tokenize(code string, recovery bool) (tokens []TokenInfo, err error) {
+	lexer := NewLexer(code)
+
+	var errs SyntaxErrors
+	for {
+		tok, se := scanToken(lexer)
+		if se != nil {
+			if !recovery {
+				err = se
+				break
+			}
+			// skip one character at least
+			if lexer.index <= se.Offset {
+				_, size := utf8.DecodeRuneInString(code[se.Offset:])
+				lexer.index, lexer.col = se.Offset+size, se.Column+1
+			}
+			errs = append(errs, se)
+			tokens = append(tokens, TokenInfo{
+				Kind: TokenInvalid,
+				Text: code[se.Offset:lexer.index],
+				Pos:  Position{Line: se.Line, Column: se.Column, Offset: se.Offset},
+				End:  Position{Line: lexer.line, Column: lexer.col, Offset: lexer.index},
+			})
+			continue
+		}
+		if tok.sym == SymbolEOF {
+			break
+		}
+
+		tokens = append(tokens, TokenInfo{
+			Kind:   tokenKind(tok.sym),
+			Symbol: tok.sym,
+			Text:   code[tok.offset:tok.endOffset],
+			Pos:    tokenPos(tok),
+			End:    tokenEnd(tok),
+		})
+	}
+
+	// the comments between tokens
+	for _, c := range lexer.Comments() {
+		tokens = append(tokens, TokenInfo{Kind: TokenComment, Text: c.Text, Pos: c.Pos, End: c.End})
+	}
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].Pos.Offset < tokens[j].Pos.Offset
+	})
+
+	if len(errs) > 0 {
+		err = errs
+	}
+	return
+}
+
+// scan the next token, return the syntax error instead of panic
+func scanToken(lexer *Lexer) (tok *Token, err *SyntaxError) {
+	defer func() {
+		if e := recover(); e != nil {
+			se, ok := e.(*SyntaxError)
+			if !ok {
+				panic(e)
+			}
+			err = se
+		}
+	}()
+
+	return lexer.next(), nil
+}
+
+// return the kind of token symbol
+func tokenKind(sym Symbol) TokenKind {
+	switch sym {
+	case SymbolIdent:
+		return TokenIdent
+	case SymbolNumber:
+		return TokenNumber
+	case SymbolString:
+		return TokenString
+	case SymbolLparen, SymbolRparen, SymbolLbrack, SymbolRbrack, SymbolLbrace, SymbolRbrace,
+		SymbolComma, SymbolSemicolon, SymbolColon, SymbolDot:
+		return TokenPunctuation
+	}
+
+	// the registered words, such as `if` and `in`
+	if r, _ := utf8.DecodeRuneInString(string(sym)); isFirstIdentChar(r) {
+		return TokenKeyword
+	}
+	return TokenOperator
+}
@@ -0,0 +1,108 @@
+package spiker_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+// return the kind, text and span of tokens
+func tokenStrings(tokens []spiker.TokenInfo) []string {
+	var list []string
+	for _, t := range tokens {
+		list = append(list, fmt.Sprintf("%s %s %v-%v", t.Kind, t.Text, t.Pos, t.End))
+	}
+	return list
+}
+
+func TestTokenize(t *testing.T) {
+	code := "# total\nif (a.b >= 1) { x = \"中\"; } # end\nf = y -> y ** 2 in [1.5];"
+	tokens, err := spiker.Tokenize(code)
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+
+	want := []string{
+		"comment # total 1:1-1:8",
+		"keyword if 2:1-2:3",
+		"punctuation ( 2:4-2:5",
+		"identifier a 2:5-2:6",
+		"punctuation . 2:6-2:7",
+		"identifier b 2:7-2:8",
+		"operator >= 2:9-2:11",
+		"number 1 2:12-2:13",
+		"punctuation ) 2:13-2:14",
+		"punctuation { 2:15-2:16",
+		"identifier x 2:17-2:18",
+		"operator = 2:19-2:20",
+		"string \"中\" 2:21-2:24",
+		"punctuation ; 2:24-2:25",
+		"punctuation } 2:26-2:27",
+		"comment # end 2:28-2:33",
+		"identifier f 3:1-3:2",
+		"operator = 3:3-3:4",
+		"identifier y 3:5-3:6",
+		"operator -> 3:7-3:9",
+		"identifier y 3:10-3:11",
+		"operator ** 3:12-3:14",
+		"number 2 3:15-3:16",
+		"keyword in 3:17-3:19",
+		"punctuation [ 3:20-3:21",
+		"number 1.5 3:21-3:24",
+		"punctuation ] 3:24-3:25",
+		"punctuation ; 3:25-3:26",
+	}
+	if got := tokenStrings(tokens); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize() = %q\nwant %q", got, want)
+	}
+
+	// the text is the source between positions
+	for _, tok := range tokens {
+		if text := code[tok.Pos.Offset:tok.End.Offset]; text != tok.Text {
+			t.Errorf("Text = %q, source %q", tok.Text, text)
+		}
+	}
+	if tokens[1].Symbol != spiker.SymbolIf || tokens[2].Symbol != spiker.SymbolLparen || tokens[0].Symbol != "" {
+		t.Errorf("Symbol = %q, %q, %q", tokens[0].Symbol, tokens[1].Symbol, tokens[2].Symbol)
+	}
+}
+
+func TestTokenize_Error(t *testing.T) {
+	tokens, err := spiker.Tokenize("a = 1;\nb = @;")
+	if err == nil || err.Error() != `syntax error: invalid character '@' on line 2:5` {
+		t.Errorf("Tokenize() error = %v", err)
+	}
+	if len(tokens) != 6 {
+		t.Errorf("Tokenize() = %q", tokenStrings(tokens))
+	}
+}
+
+func TestTokenizeRecover(t *testing.T) {
+	tokens, err := spiker.TokenizeRecover("a = \"abc\nb = $ + 1;")
+
+	want := []string{
+		"identifier a 1:1-1:2",
+		"operator = 1:3-1:4",
+		"invalid \"abc 1:5-1:9",
+		"identifier b 2:1-2:2",
+		"operator = 2:3-2:4",
+		"invalid $ 2:5-2:6",
+		"operator + 2:7-2:8",
+		"number 1 2:9-2:10",
+		"punctuation ; 2:10-2:11",
+	}
+	if got := tokenStrings(tokens); !reflect.DeepEqual(got, want) {
+		t.Errorf("TokenizeRecover() = %q\nwant %q", got, want)
+	}
+
+	errs, ok := err.(spiker.SyntaxErrors)
+	if !ok || len(errs) != 2 || errs[0].Message != "unterminated string" || errs[1].Message != `invalid character '$'` {
+		t.Errorf("TokenizeRecover() error = %#v", err)
+	}
+
+	if tokens, err := spiker.TokenizeRecover(""); len(tokens) != 0 || err != nil {
+		t.Errorf("TokenizeRecover() = %v, %v", tokens, err)
+	}
+}
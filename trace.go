@@ -0,0 +1,99 @@
+package spiker
+
+import "time"
+
+// TraceKind the kind of traced event
+type TraceKind int
+
+// Supported trace kinds
+const (
+	TraceStatement TraceKind = iota // statement
+	TraceFunc                       // custom function call
+	TraceBuiltin                    // builtin function call
+)
+
+// String .
+func (k TraceKind) String() string {
+	switch k {
+	case TraceStatement:
+		return "statement"
+	case TraceFunc:
+		return "func"
+	case TraceBuiltin:
+		return "builtin"
+	}
+	return "unknown"
+}
+
+// TraceEvent the execution of a statement or function call,
+// the same event is passed to Tracer.Enter and Tracer.Exit
+type TraceEvent struct {
+	Kind   TraceKind
+	Name   string      // the name of function, empty for statement
+	Node   AstNode     // the statement, or *NodeFuncCallOp of function call
+	Pos    Position    // the position of node
+	Parent *TraceEvent // the enclosing event, nil for the top level statement
+	Depth  int         // the number of enclosing events
+	Start  time.Time
+
+	// set before Exit
+	Duration time.Duration
+	Value    interface{} // the value of statement, or the result of function
+	Err      error
+
+	begin    time.Time     // the time before tracing, includes the overhead of tracer
+	children time.Duration // the duration of nested events, includes the overhead of tracer
+}
+
+// Self return the duration excluding the nested events
+func (ev *TraceEvent) Self() time.Duration {
+	return ev.Duration - ev.children
+}
+
+// Tracer receives the events of evaluation, it should be safe for concurrent use
+// if the engine evaluates concurrently. The events of an evaluation are sequential
+type Tracer interface {
+	Enter(ev *TraceEvent)
+	Exit(ev *TraceEvent)
+}
+
+// WithTracer set the tracer of the engine, the programs run on the tree-walking
+// evaluator when tracing, even if the bytecode is enabled
+func WithTracer(tracer Tracer) Option {
+	return func(e *Engine) {
+		e.tracer = tracer
+	}
+}
+
+// start the traced event, return nil if not tracing
+func (ex *execution) traceEnter(kind TraceKind, name string, node AstNode) *TraceEvent {
+	if ex.tracer == nil {
+		return nil
+	}
+
+	ev := &TraceEvent{Kind: kind, Name: name, Node: node, Pos: node.Pos(), Parent: ex.event, begin: time.Now()}
+	if ev.Parent != nil {
+		ev.Depth = ev.Parent.Depth + 1
+	}
+	ex.event = ev
+	ex.tracer.Enter(ev)
+	ev.Start = time.Now()
+	return ev
+}
+
+// end the traced event
+func (ex *execution) traceExit(ev *TraceEvent, val interface{}, err error) {
+	if ev == nil {
+		return
+	}
+
+	ev.Duration = time.Since(ev.Start)
+	ev.Value, ev.Err = val, err
+	ex.event = ev.Parent
+	ex.tracer.Exit(ev)
+
+	// the tracer doesn't slow down the enclosing event
+	if ev.Parent != nil {
+		ev.Parent.children += time.Since(ev.begin)
+	}
+}
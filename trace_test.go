@@ -0,0 +1,84 @@
+package spiker_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+// record the events as lines, indented by depth
+type traceRecorder struct {
+	events []string
+}
+
+func (r *traceRecorder) Enter(ev *spiker.TraceEvent) {
+	r.events = append(r.events, fmt.Sprintf("%s> %s %s %s", strings.Repeat("  ", ev.Depth), ev.Kind, ev.Name, ev.Pos))
+}
+
+func (r *traceRecorder) Exit(ev *spiker.TraceEvent) {
+	if ev.Duration < 0 || ev.Self() < 0 || ev.Self() > ev.Duration {
+		panic(fmt.Sprintf("invalid duration %s, self %s", ev.Duration, ev.Self()))
+	}
+	line := fmt.Sprintf("%s< %s %s %s", strings.Repeat("  ", ev.Depth), ev.Kind, ev.Name, spiker.FormatValue(ev.Value))
+	if ev.Err != nil {
+		line += " error: " + ev.Err.Error()
+	}
+	r.events = append(r.events, line)
+}
+
+func TestWithTracer(t *testing.T) {
+	code := "add = (a, b) -> {\n    return a + b;\n};\nx = add(1, len([2]));\nexport(x);"
+	expect := []string{
+		"> statement  1:1", "< statement  none",
+		"> statement  4:1",
+		"  > builtin len 4:12", "  < builtin len 1",
+		"  > func add 4:5",
+		"    > statement  2:5", "    < statement  2",
+		"  < func add 2",
+		"< statement  2",
+		"> statement  5:1",
+		"  > builtin export 5:1", "  < builtin export 2",
+		"< statement  2",
+	}
+
+	tests := []struct {
+		name string
+		run  func(e *spiker.Engine) (interface{}, error)
+	}{
+		{"execute", func(e *spiker.Engine) (interface{}, error) {
+			return e.Execute(code)
+		}},
+		{"bytecode program", func(e *spiker.Engine) (interface{}, error) {
+			p, err := e.Compile(code)
+			if err != nil {
+				return nil, err
+			}
+			return p.Run(nil)
+		}},
+	}
+
+	for _, tt := range tests {
+		r := &traceRecorder{}
+		val, err := tt.run(spiker.New(spiker.WithTracer(r), spiker.WithBytecode(true)))
+		if err != nil || val != float64(2) {
+			t.Fatalf("%s: %v, %v", tt.name, val, err)
+		}
+		if got := strings.Join(r.events, "\n"); got != strings.Join(expect, "\n") {
+			t.Errorf("%s: events =\n%s", tt.name, got)
+		}
+	}
+
+	// the error of statement
+	r := &traceRecorder{}
+	_, err := spiker.New(spiker.WithTracer(r)).Execute("f = x -> {\n    b = g(x);\n};\nf(1);")
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	last := r.events[len(r.events)-3:]
+	if !strings.HasPrefix(last[0], "    < statement  none error: RUNTIME ERROR:") ||
+		!strings.HasPrefix(last[1], "  < func f none error:") || !strings.HasPrefix(last[2], "< statement  none error:") {
+		t.Errorf("events =\n%s", strings.Join(r.events, "\n"))
+	}
+}
@@ -1,7 +1,6 @@
 package spiker
 
 import (
-	"fmt"
 	"strconv"
 )
 
@@ -9,7 +8,7 @@ import (
 func Transform(tokList []*Token) (nodeList []AstNode, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = fmt.Errorf("%v", e)
+			err = recoverSyntaxError(e)
 		}
 	}()
 
@@ -34,7 +33,7 @@ func transNode(token *Token) AstNode {
 	// Assignment
 	case SymbolAssign, SymbolAssignAdd, SymbolAssignSub, SymbolAssignMul, SymbolAssignDiv, SymbolAssignMod:
 		if token.children[0].sym != SymbolIdent {
-			panic(fmt.Sprintf("EXPECTED IDENT, BUT GOT: %v", token.children[0].sym))
+			panic(newSyntaxError(token.children[0], "expected identifier, but got %s", token.children[0].describe()))
 		}
 
 		// Function declare
@@ -46,7 +45,7 @@ func transNode(token *Token) AstNode {
 		return &NodeAssignOp{
 			Ast: Ast{raw: token},
 			Var: NodeVariable{
-				Ast:   Ast{raw: token},
+				Ast:   Ast{raw: token.children[0]},
 				Value: token.children[0].value,
 			},
 			Op:   token.sym,
@@ -123,7 +122,7 @@ func transNode(token *Token) AstNode {
 	// [A,B,...]
 	case SymbolArray:
 		arr := &NodeList{
-			Ast:  Ast{raw: token},
+			Ast:  Ast{raw: token, end: token.end},
 			List: make([]AstNode, 0),
 		}
 		for _, subNode := range token.children {
@@ -136,7 +135,7 @@ func transNode(token *Token) AstNode {
 	case SymbolMap:
 		var index float64
 		dict := &NodeMap{
-			Ast: Ast{raw: token},
+			Ast: Ast{raw: token, end: token.end},
 			Map: make(map[AstNode]AstNode),
 		}
 
@@ -147,8 +146,10 @@ func transNode(token *Token) AstNode {
 				key = item
 				item = transNode(subNode.key)
 			} else {
+				// the implicit index is an empty range before the value
+				pos := item.Pos()
 				key = &NodeNumber{
-					Ast:   Ast{raw: nil},
+					Ast:   Ast{raw: spanToken(pos, pos)},
 					Value: index,
 				}
 
@@ -162,13 +163,25 @@ func transNode(token *Token) AstNode {
 	// var[i]
 	case SymbolLbrack:
 		idx := &NodeVarIndex{
-			Ast:   Ast{raw: token},
+			Ast:   Ast{raw: token, end: token.end},
 			Var:   transNode(token.children[0]),
 			Index: transNode(token.children[1]),
 		}
 
 		return idx
 
+	// Member, same as the index of string
+	case SymbolDot:
+		return &NodeVarIndex{
+			Ast: Ast{raw: token},
+			Var: transNode(token.children[0]),
+			Index: &NodeString{
+				Ast:   Ast{raw: token.children[1]},
+				Value: token.children[1].value,
+			},
+			Member: true,
+		}
+
 	// If
 	case SymbolIf:
 		return transIfStmt(token)
@@ -178,7 +191,7 @@ func transNode(token *Token) AstNode {
 		// function call
 		if len(token.children) > 0 && token.children[0].sym == SymbolIdent {
 			fc := &NodeFuncCallOp{
-				Ast: Ast{raw: token},
+				Ast: Ast{raw: token, end: token.end},
 				Name: NodeVariable{
 					Ast:   Ast{raw: token.children[0]},
 					Value: token.children[0].value,
@@ -194,7 +207,7 @@ func transNode(token *Token) AstNode {
 	// while
 	case SymbolWhile:
 		if len(token.children) < 2 {
-			panic("Missing judgment expression for while")
+			panic(newSyntaxError(token, "missing condition of while"))
 		}
 
 		nws := &NodeWhile{
@@ -204,6 +217,7 @@ func transNode(token *Token) AstNode {
 		}
 
 		if token.children[1].sym == SymbolLbrace {
+			nws.end = token.children[1].end
 			for _, stmt := range token.children[1].children {
 				nws.Body = append(nws.Body, transNode(stmt))
 			}
@@ -231,6 +245,14 @@ func transNode(token *Token) AstNode {
 
 		if len(token.children) > 0 {
 			for _, v := range token.children {
+				// multiple values, return (a, b)
+				if v.sym == SymbolTuple {
+					nr.end = v.end
+					for _, t := range v.children {
+						nr.Tuples = append(nr.Tuples, transNode(t))
+					}
+					continue
+				}
 				nr.Tuples = append(nr.Tuples, transNode(v))
 			}
 		}
@@ -255,7 +277,7 @@ func transFuncDef(token *Token) *NodeFuncDef {
 
 	tokFnd := token.children[1]
 	if len(tokFnd.children) < 2 {
-		panic("FUNC DECLARE EXPECTED PARAMS AND BODY")
+		panic(newSyntaxError(tokFnd, "function declaration expects parameters and body"))
 	}
 
 	// params
@@ -285,6 +307,7 @@ func transFuncDef(token *Token) *NodeFuncDef {
 
 	// body
 	if tokFnd.children[1].sym == SymbolLbrace {
+		fnd.end = tokFnd.children[1].end
 		for _, v := range tokFnd.children[1].children {
 			fnd.Body = append(fnd.Body, transNode(v))
 		}
@@ -311,6 +334,7 @@ func transIfStmt(token *Token) *NodeIf {
 
 	// if ... { ... <body> ... }
 	if token.children[1] != nil && token.children[1].sym == SymbolLbrace {
+		ifStmt.end = token.children[1].end
 		for _, ifBodyNode := range token.children[1].children {
 			ifStmt.Body = append(ifStmt.Body, transNode(ifBodyNode))
 		}
@@ -327,6 +351,7 @@ func transIfStmt(token *Token) *NodeIf {
 
 	// if ... <else> ...
 	if token.children[2] != nil && token.children[2].sym == SymbolLbrace {
+		ifStmt.end = token.children[2].end
 		ifStmt.Else = make([]AstNode, 0)
 		for _, elseBodyNode := range token.children[2].children {
 			ifStmt.Else = append(ifStmt.Else, transNode(elseBodyNode))
@@ -354,7 +379,7 @@ func isSingleFuncStmt(token *Token) bool {
 		SymbolIn: // in
 		return true
 
-	case SymbolLbrack, SymbolMap, SymbolArray, SymbolNumber, SymbolString, SymbolTrue, SymbolFalse:
+	case SymbolLbrack, SymbolDot, SymbolMap, SymbolArray, SymbolNumber, SymbolString, SymbolTrue, SymbolFalse:
 		return true
 
 	}
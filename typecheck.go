@@ -0,0 +1,608 @@
+package spiker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TypeKind kind of the static type
+type TypeKind int
+
+// Supported type kind
+const (
+	TypeAny TypeKind = iota // unknown type, compatible with all types
+	TypeNil
+	TypeNumber
+	TypeString
+	TypeBool
+	TypeList
+	TypeMap
+	TypeFunc
+)
+
+// Type static type of value, for the type checking
+type Type struct {
+	Kind   TypeKind
+	Elem   *Type   // element type of list and map
+	Params []*Type // parameter types of function, nil means unchecked
+	Result *Type   // result type of function
+}
+
+// Basic types
+var (
+	AnyType    = &Type{Kind: TypeAny}
+	NilType    = &Type{Kind: TypeNil}
+	NumberType = &Type{Kind: TypeNumber}
+	StringType = &Type{Kind: TypeString}
+	BoolType   = &Type{Kind: TypeBool}
+)
+
+// ListOf return the list type of element type
+func ListOf(elem *Type) *Type {
+	return &Type{Kind: TypeList, Elem: elem}
+}
+
+// MapOf return the map type of element type, the key is always string
+func MapOf(elem *Type) *Type {
+	return &Type{Kind: TypeMap, Elem: elem}
+}
+
+// FuncOf return the function type of result and parameter types
+func FuncOf(result *Type, params ...*Type) *Type {
+	return &Type{Kind: TypeFunc, Params: append([]*Type{}, params...), Result: result}
+}
+
+// String .
+func (t *Type) String() string {
+	if t == nil {
+		return "any"
+	}
+
+	switch t.Kind {
+	case TypeNil:
+		return "nil"
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	case TypeList:
+		return "list<" + t.elem().String() + ">"
+	case TypeMap:
+		return "map<" + t.elem().String() + ">"
+	case TypeFunc:
+		var ps []string
+		for _, p := range t.Params {
+			ps = append(ps, p.String())
+		}
+		return "func(" + strings.Join(ps, ", ") + ") " + t.result().String()
+	}
+	return "any"
+}
+
+// return the element type, any if it isn't specified
+func (t *Type) elem() *Type {
+	if t.Elem == nil {
+		return AnyType
+	}
+	return t.Elem
+}
+
+// return the result type, any if it isn't specified
+func (t *Type) result() *Type {
+	if t.Result == nil {
+		return AnyType
+	}
+	return t.Result
+}
+
+// report whether the type is unknown, nil is treated as unknown
+func (t *Type) unknown() bool {
+	return t == nil || t.Kind == TypeAny || t.Kind == TypeNil
+}
+
+// report whether the value of type `from` could be assigned to type `t`
+func (t *Type) assignable(from *Type) bool {
+	if t.unknown() || from.unknown() {
+		return true
+	}
+	if t.Kind != from.Kind {
+		return false
+	}
+	switch t.Kind {
+	case TypeList, TypeMap:
+		return t.elem().assignable(from.elem())
+	}
+	return true
+}
+
+// return the common type of a and b, any if they are different,
+// nil is absorbed by the other type
+func joinType(a *Type, b *Type) *Type {
+	switch {
+	case a == nil || a.Kind == TypeNil:
+		return b
+	case b == nil || b.Kind == TypeNil:
+		return a
+	case a.Kind == TypeAny || b.Kind == TypeAny:
+		return AnyType
+	case a.String() == b.String():
+		return a
+	case a.Kind == b.Kind && a.Kind == TypeList:
+		return ListOf(joinType(a.elem(), b.elem()))
+	case a.Kind == b.Kind && a.Kind == TypeMap:
+		return MapOf(joinType(a.elem(), b.elem()))
+	}
+	return AnyType
+}
+
+// TypeCheckOptions options of the type checking
+type TypeCheckOptions struct {
+	Variables map[string]*Type // types of variables provided by the host scope
+	Functions map[string]*Type // function types of the host functions
+}
+
+// TypeCheck report the type mismatches of the ast nodes without running them, sorted by position.
+//
+// The types are inferred through the literals, operators, assignments, builtin functions
+// and function bodies, the script function is checked with the argument types of each call.
+// The declared variable can only be assigned with its type.
+// Unknown types are compatible with all types, so only the certain mismatches are reported.
+func TypeCheck(nodeList []AstNode, opts TypeCheckOptions) []Diagnostic {
+	c := &typeChecker{
+		opts:     opts,
+		reported: make(map[string]bool),
+		calling:  make(map[*NodeFuncDef]bool),
+	}
+
+	c.global = newTypeScope(nil)
+	for name, t := range opts.Variables {
+		c.global.vars[name] = t
+		c.global.declared[name] = t
+	}
+	c.checkList(c.global, nodeList)
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.diags[i].Offset < c.diags[j].Offset
+	})
+	return c.diags
+}
+
+// maximum depth of the nested function checking
+const maxTypeCheckDepth = 32
+
+type typeChecker struct {
+	opts     TypeCheckOptions
+	global   *typeScope
+	diags    []Diagnostic
+	reported map[string]bool       // reported diagnostics, by position and message
+	silent   int                   // do not report when greater than 0
+	calling  map[*NodeFuncDef]bool // the functions being checked, for recursion
+	depth    int                   // depth of the nested function checking
+}
+
+// types of the global scope or a function body
+type typeScope struct {
+	parent   *typeScope              // the global scope of function body, for the functions
+	vars     map[string]*Type        // types of variables
+	declared map[string]*Type        // declared types of host variables
+	funcs    map[string]*NodeFuncDef // defined functions
+	result   *Type                   // joined type of return values
+}
+
+func newTypeScope(parent *typeScope) *typeScope {
+	return &typeScope{
+		parent:   parent,
+		vars:     make(map[string]*Type),
+		declared: make(map[string]*Type),
+		funcs:    make(map[string]*NodeFuncDef),
+	}
+}
+
+// return a copy of the variable types
+func (s *typeScope) snapshot() map[string]*Type {
+	vars := make(map[string]*Type, len(s.vars))
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// merge the variable types of branches
+func (s *typeScope) merge(branches ...map[string]*Type) {
+	vars := make(map[string]*Type)
+	for _, b := range branches {
+		for k, v := range b {
+			if t, ok := vars[k]; ok {
+				vars[k] = joinType(t, v)
+			} else {
+				vars[k] = v
+			}
+		}
+	}
+	s.vars = vars
+}
+
+// return the script function visible in scope
+func (s *typeScope) lookupFunc(name string) *NodeFuncDef {
+	for ; s != nil; s = s.parent {
+		if fnd, ok := s.funcs[name]; ok {
+			return fnd
+		}
+	}
+	return nil
+}
+
+func (c *typeChecker) report(node AstNode, format string, args ...interface{}) {
+	if c.silent > 0 {
+		return
+	}
+	d := Diagnostic{Kind: DiagnosticTypeMismatch, Message: fmt.Sprintf(format, args...), Node: node}
+	d.Line, d.Column, d.Offset = nodePosition(node)
+
+	// the function body is checked for each call
+	key := fmt.Sprintf("%d:%s", d.Offset, d.Message)
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	c.diags = append(c.diags, d)
+}
+
+// check the statements, return the type of the last statement value
+func (c *typeChecker) checkList(s *typeScope, nodes []AstNode) *Type {
+	t := NilType
+	for _, node := range nodes {
+		t = c.check(s, node)
+	}
+	return t
+}
+
+// check the node, return the type of its value
+func (c *typeChecker) check(s *typeScope, node AstNode) *Type {
+	switch node := node.(type) {
+	case *NodeNumber:
+		return NumberType
+
+	case *NodeString:
+		return StringType
+
+	case *NodeBool:
+		return BoolType
+
+	case *NodeVariable:
+		if t, ok := s.vars[node.Value]; ok {
+			return t
+		}
+		return AnyType
+
+	case *NodeList:
+		var elem *Type
+		for idx, v := range node.List {
+			if t := c.check(s, v); idx == 0 {
+				elem = t
+			} else {
+				elem = joinType(elem, t)
+			}
+		}
+		return ListOf(elem)
+
+	case *NodeMap:
+		var elem *Type
+		first := true
+		for k, v := range node.Map {
+			c.check(s, k)
+			if t := c.check(s, v); first {
+				elem, first = t, false
+			} else {
+				elem = joinType(elem, t)
+			}
+		}
+		return MapOf(elem)
+
+	case *NodeAssignOp:
+		return c.checkAssign(s, node)
+
+	case *NodeUnaryOp:
+		return c.checkUnary(node, c.check(s, node.Right))
+
+	case *NodeBinaryOp:
+		return c.checkBinary(node, node.Op, c.check(s, node.Left), c.check(s, node.Right))
+
+	case *NodeVarIndex:
+		return c.checkIndex(node, c.check(s, node.Var), c.check(s, node.Index))
+
+	case *NodeFuncCallOp:
+		return c.checkCall(s, node)
+
+	case *NodeFuncDef:
+		s.funcs[node.Name.Value] = node
+		// check the body without argument types
+		c.checkFunc(node, nil)
+		return NilType
+
+	case *NodeIf:
+		return c.checkIf(s, node)
+
+	case *NodeWhile:
+		c.check(s, node.Expr)
+		entry := s.snapshot()
+
+		// the body may run many times, check it with the types after the first run
+		c.silent++
+		c.checkList(s, node.Body)
+		c.silent--
+		s.merge(entry, s.vars)
+		entry = s.snapshot()
+		c.checkList(s, node.Body)
+		s.merge(entry, s.vars)
+		return AnyType
+
+	case *NodeReturn:
+		t := AnyType
+		switch len(node.Tuples) {
+		case 0:
+			t = NilType
+		case 1:
+			t = c.check(s, node.Tuples[0])
+		default:
+			for _, v := range node.Tuples {
+				c.check(s, v)
+			}
+		}
+		s.result = joinType(s.result, t)
+		return NilType
+	}
+
+	return AnyType
+}
+
+func (c *typeChecker) checkIf(s *typeScope, node *NodeIf) *Type {
+	var branches []map[string]*Type
+	var result *Type
+	entry := s.snapshot()
+	for n := node; n != nil; n = n.ElseIf {
+		s.vars = entry
+		c.check(s, n.Expr)
+		entry = s.snapshot()
+		result = joinType(result, c.checkList(s, n.Body))
+		branches = append(branches, s.vars)
+	}
+
+	s.vars = entry
+	result = joinType(result, c.checkList(s, node.Else))
+	branches = append(branches, s.vars)
+
+	s.merge(branches...)
+	if result == nil {
+		return NilType
+	}
+	return result
+}
+
+func (c *typeChecker) checkAssign(s *typeScope, node *NodeAssignOp) *Type {
+	name := node.Var.Value
+	t := c.check(s, node.Expr)
+	if node.Op != SymbolAssign {
+		t = c.checkBinary(node, assignOperator(node.Op), c.check(s, &node.Var), t)
+	}
+
+	if want, ok := s.declared[name]; ok {
+		if !want.assignable(t) {
+			c.report(node, "cannot assign %s to %s (%s)", t, name, want)
+		}
+		return t
+	}
+	s.vars[name] = t
+	return t
+}
+
+// return the binary operator of compound assignment
+func assignOperator(op Symbol) Symbol {
+	switch op {
+	case SymbolAssignAdd:
+		return SymbolAdd
+	case SymbolAssignSub:
+		return SymbolSub
+	case SymbolAssignMul:
+		return SymbolMul
+	case SymbolAssignDiv:
+		return SymbolDiv
+	case SymbolAssignMod:
+		return SymbolMod
+	}
+	return op
+}
+
+func (c *typeChecker) checkUnary(node *NodeUnaryOp, right *Type) *Type {
+	switch node.Op {
+	case SymbolLogicNot:
+		return BoolType
+	case SymbolSub, SymbolNot:
+		if !right.unknown() && right.Kind != TypeNumber {
+			c.report(node, "invalid operation: %s%s", node.Op, right)
+		}
+		return NumberType
+	}
+	return AnyType
+}
+
+func (c *typeChecker) checkBinary(node AstNode, op Symbol, left *Type, right *Type) *Type {
+	mismatch := func() {
+		c.report(node, "invalid operation: %s %s %s", left, op, right)
+	}
+	known := !left.unknown() && !right.unknown()
+
+	switch op {
+	case SymbolAdd:
+		if known && (left.Kind != right.Kind || (left.Kind != TypeNumber && left.Kind != TypeString)) {
+			mismatch()
+			return AnyType
+		}
+		for _, t := range []*Type{left, right} {
+			if !t.unknown() && t.Kind != TypeNumber && t.Kind != TypeString {
+				mismatch()
+				return AnyType
+			}
+		}
+		if known {
+			return left
+		}
+		return AnyType
+
+	case SymbolSub, SymbolMul, SymbolDiv, SymbolMod, SymbolPow,
+		SymbolAnd, SymbolOr, SymbolXor, SymbolSHR, SymbolSHL:
+		if (!left.unknown() && left.Kind != TypeNumber) || (!right.unknown() && right.Kind != TypeNumber) {
+			mismatch()
+		}
+		return NumberType
+
+	case SymbolLogicAnd, SymbolLogicOr:
+		return BoolType
+
+	case SymbolGTR, SymbolGTE, SymbolLSS, SymbolLTE:
+		if known && (left.Kind != right.Kind || (left.Kind != TypeNumber && left.Kind != TypeString)) {
+			mismatch()
+		}
+		return BoolType
+
+	case SymbolEQL, SymbolNEQ:
+		if known && left.Kind != right.Kind {
+			mismatch()
+		}
+		return BoolType
+
+	case SymbolIn:
+		switch right.Kind {
+		case TypeBool, TypeFunc:
+			mismatch()
+		}
+		return BoolType
+	}
+
+	return AnyType
+}
+
+func (c *typeChecker) checkIndex(node *NodeVarIndex, v *Type, index *Type) *Type {
+	switch v.Kind {
+	case TypeList, TypeString:
+		if !index.unknown() && index.Kind != TypeNumber {
+			c.report(node, "invalid index type %s of %s", index, v)
+		}
+		if v.Kind == TypeString {
+			return StringType
+		}
+		return v.elem()
+
+	case TypeMap:
+		if !index.unknown() && index.Kind != TypeNumber && index.Kind != TypeString {
+			c.report(node, "invalid index type %s of %s", index, v)
+		}
+		return v.elem()
+
+	case TypeNumber, TypeBool, TypeFunc:
+		c.report(node, "invalid operation: %s is not indexable", v)
+		return NilType
+	}
+
+	return AnyType
+}
+
+func (c *typeChecker) checkCall(s *typeScope, fnc *NodeFuncCallOp) *Type {
+	name := fnc.Name.Value
+
+	// script function
+	if fnd := s.lookupFunc(name); fnd != nil {
+		args := make([]*Type, len(fnc.Params))
+		for i, p := range fnc.Params {
+			args[i] = c.check(s, p)
+		}
+		return c.checkFunc(fnd, args)
+	}
+
+	// host function
+	if ft, ok := c.opts.Functions[name]; ok && ft != nil {
+		for i, p := range fnc.Params {
+			t := c.check(s, p)
+			if ft.Params != nil && i < len(ft.Params) && !ft.Params[i].assignable(t) {
+				c.report(p, "cannot use %s as %s in argument %d of %s()", t, ft.Params[i], i+1, name)
+			}
+		}
+		if ft.Params != nil && len(ft.Params) != len(fnc.Params) {
+			c.report(&fnc.Name, "%s() expects %d parameters, %d given", name, len(ft.Params), len(fnc.Params))
+		}
+		return ft.result()
+	}
+
+	// builtin function
+	switch name {
+	case "exist":
+		return BoolType
+	case "del":
+		return NilType
+	case "len":
+		t := AnyType
+		for _, p := range fnc.Params {
+			t = c.check(s, p)
+		}
+		if len(fnc.Params) == 1 {
+			switch t.Kind {
+			case TypeNumber, TypeBool, TypeFunc:
+				c.report(fnc.Params[0], "cannot use %s as argument of len()", t)
+			}
+		}
+		return NumberType
+	case "export":
+		t := AnyType
+		for _, p := range fnc.Params {
+			t = c.check(s, p)
+		}
+		return t
+	}
+
+	for _, p := range fnc.Params {
+		c.check(s, p)
+	}
+	if name == "print" {
+		return NilType
+	}
+	return AnyType
+}
+
+// check the function body with the argument types, return the result type,
+// the nil args means unknown arguments
+func (c *typeChecker) checkFunc(fnd *NodeFuncDef, args []*Type) *Type {
+	// the recursive call is unknown
+	if c.calling[fnd] || c.depth >= maxTypeCheckDepth {
+		return AnyType
+	}
+	c.calling[fnd] = true
+	c.depth++
+	defer func() {
+		delete(c.calling, fnd)
+		c.depth--
+	}()
+
+	// the function body can only call the functions of itself and the global scope
+	fs := newTypeScope(c.global)
+	for i, p := range fnd.Params {
+		t := AnyType
+		if i < len(args) {
+			t = args[i]
+		}
+		fs.vars[p.Name.Value] = t
+	}
+
+	last := c.checkList(fs, fnd.Body)
+	if len(fnd.Body) > 0 {
+		if _, ok := fnd.Body[len(fnd.Body)-1].(*NodeReturn); ok {
+			last = nil
+		}
+	}
+	if t := joinType(fs.result, last); t != nil {
+		return t
+	}
+	return NilType
+}
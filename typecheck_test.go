@@ -0,0 +1,167 @@
+package spiker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+func TestTypeCheck(t *testing.T) {
+	opts := spiker.TypeCheckOptions{
+		Variables: map[string]*spiker.Type{
+			"price": spiker.NumberType,
+			"name":  spiker.StringType,
+			"vip":   spiker.BoolType,
+			"items": spiker.ListOf(spiker.MapOf(spiker.NumberType)),
+		},
+		Functions: map[string]*spiker.Type{
+			"round": spiker.FuncOf(spiker.NumberType, spiker.NumberType, spiker.NumberType),
+		},
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"valid", `
+total = price * 2 + 1;
+label = "name: " + name;
+qty = items[0]["qty"] * price;
+r = round(total, 2);
+ok = vip && total > 100;
+`, nil},
+		{"operators", `
+a = "abc" + 1;
+b = "abc" - 1;
+c = name * 2;
+d = -name;
+e = name > 1;
+f = price[0];
+`, []string{
+			"2:5: invalid operation: string + number (type-mismatch)",
+			"3:5: invalid operation: string - number (type-mismatch)",
+			"4:5: invalid operation: string * number (type-mismatch)",
+			"5:5: invalid operation: -string (type-mismatch)",
+			"6:5: invalid operation: string > number (type-mismatch)",
+			"7:5: invalid operation: number is not indexable (type-mismatch)",
+		}},
+		{"declared-variable", `
+price = "free";
+price += 1;
+name += 1;
+`, []string{
+			"2:1: cannot assign string to price (number) (type-mismatch)",
+			"4:1: invalid operation: string + number (type-mismatch)",
+		}},
+		{"collections", `
+a = items["a"];
+b = items[0]["qty"] + name;
+l = [1, 2];
+c = l[0] + "x";
+m = ["a": "x"];
+d = m["a"] * 2;
+`, []string{
+			"2:5: invalid index type string of list<map<number>> (type-mismatch)",
+			"3:5: invalid operation: number + string (type-mismatch)",
+			"5:5: invalid operation: number + string (type-mismatch)",
+			"7:5: invalid operation: string * number (type-mismatch)",
+		}},
+		{"assignment-inference", `
+a = 1;
+b = a + "x";
+a = "y";
+c = a + "x";
+if (vip) {
+    d = 1;
+} else {
+    d = "x";
+}
+e = d - 1;
+i = 0;
+while (i < 3) {
+    i += 1;
+}
+s = i + "x";
+`, []string{
+			"3:5: invalid operation: number + string (type-mismatch)",
+			"16:5: invalid operation: number + string (type-mismatch)",
+		}},
+		{"functions", `
+double = x -> x * 2;
+a = double(2) + "x";
+double("b");
+g = (a, b) -> {
+    if (a) {
+        return b;
+    }
+    return b + 1;
+};
+h = g(true, "s");
+fib = n -> {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+};
+z = fib(10) + 1;
+`, []string{
+			"2:15: invalid operation: string * number (type-mismatch)",
+			"3:5: invalid operation: number + string (type-mismatch)",
+			"9:12: invalid operation: string + number (type-mismatch)",
+		}},
+		{"builtins", `
+a = len(price);
+b = len(name) + name;
+c = exist(x) + 1;
+`, []string{
+			"2:9: cannot use number as argument of len() (type-mismatch)",
+			"3:5: invalid operation: number + string (type-mismatch)",
+			"4:5: invalid operation: bool + number (type-mismatch)",
+		}},
+		{"host-functions", `
+a = round(price, "2");
+b = round(1);
+c = round(price, 2) + name;
+`, []string{
+			"2:18: cannot use string as number in argument 2 of round() (type-mismatch)",
+			"3:5: round() expects 2 parameters, 1 given (type-mismatch)",
+			"4:5: invalid operation: number + string (type-mismatch)",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, err := spiker.ParseAst(tt.code)
+			if err != nil {
+				t.Fatalf("ParseAst() error = %v", err)
+			}
+
+			var got []string
+			for _, d := range spiker.TypeCheck(ast, opts) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TypeCheck() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestType_String(t *testing.T) {
+	tests := []struct {
+		typ  *spiker.Type
+		want string
+	}{
+		{spiker.AnyType, "any"},
+		{spiker.NumberType, "number"},
+		{spiker.ListOf(spiker.StringType), "list<string>"},
+		{spiker.MapOf(spiker.ListOf(nil)), "map<list<any>>"},
+		{spiker.FuncOf(spiker.BoolType, spiker.NumberType, spiker.StringType), "func(number, string) bool"},
+	}
+	for _, tt := range tests {
+		if got := tt.typ.String(); got != tt.want {
+			t.Errorf("Type.String() = %q, want %q", got, tt.want)
+		}
+	}
+}
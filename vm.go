@@ -0,0 +1,385 @@
+package spiker
+
+import "fmt"
+
+// marks the slot has no variable
+type undefinedValue struct{}
+
+var undefined interface{} = &undefinedValue{}
+
+// frame of function call
+type vmFrame struct {
+	proto   *proto
+	slots   []interface{}
+	dirty   []bool // assigned slots, not stored into scope yet
+	scope   *VariableScope
+	version uint64 // scope version of the last synchronization
+	level   int
+}
+
+func newFrame(p *proto, level int) *vmFrame {
+	f := &vmFrame{
+		proto: p,
+		slots: make([]interface{}, len(p.names)),
+		dirty: make([]bool, len(p.names)),
+		level: level,
+	}
+	for i := range f.slots {
+		f.slots[i] = undefined
+	}
+	return f
+}
+
+// virtual machine, run the bytecode with resolved variable slots
+type machine struct {
+	bc     *bytecode
+	main   *vmFrame
+	ex     *execution
+	stack  []interface{}
+	result interface{}
+
+	// the checks are skipped if there is no limit, or the context can't be done
+	steps  bool
+	values bool
+	done   <-chan struct{}
+}
+
+// run the bytecode, the execution state must be bound to the scope
+func (bc *bytecode) run(scope *VariableScope) (res interface{}, err error) {
+	ex := scope.exec
+	vm := &machine{
+		bc:     bc,
+		ex:     ex,
+		stack:  make([]interface{}, 0, 64),
+		steps:  ex.limits.MaxSteps > 0,
+		values: ex.limits.MaxStringLength > 0 || ex.limits.MaxCollectionSize > 0,
+		done:   ex.ctx.Done(),
+	}
+
+	f := newFrame(bc.main, scope.scopeLevel)
+	f.scope = scope
+	vm.main = f
+	vm.reload(f, true)
+
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e)
+		}
+		vm.flush(f)
+	}()
+
+	c, err := vm.run(f)
+	if c.typ == completionExport {
+		return c.val, err
+	}
+	return vm.result, err
+}
+
+// store the assigned slots into scope
+func (vm *machine) flush(f *vmFrame) {
+	if f.scope == nil {
+		f.scope = NewScopeTable("custom_func_"+f.proto.name, f.level, nil)
+		f.scope.exec = vm.ex
+	}
+
+	for i, name := range f.proto.names {
+		if name != "" && f.dirty[i] {
+			f.scope.set(name, f.slots[i])
+			f.dirty[i] = false
+		}
+	}
+	f.version = f.scope.version
+}
+
+// load the slots from scope if it's changed
+func (vm *machine) reload(f *vmFrame, force bool) {
+	if !force && f.scope.version == f.version {
+		return
+	}
+
+	for i, name := range f.proto.names {
+		if name == "" {
+			continue
+		}
+		if val, ok := f.scope.Get(name); ok {
+			f.slots[i] = val
+		} else {
+			f.slots[i] = undefined
+		}
+	}
+	f.version = f.scope.version
+}
+
+func (vm *machine) push(val interface{}) {
+	vm.stack = append(vm.stack, val)
+}
+
+func (vm *machine) pop() interface{} {
+	val := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return val
+}
+
+// pop the n values
+func (vm *machine) popN(n int) []interface{} {
+	vals := make([]interface{}, n)
+	copy(vals, vm.stack[len(vm.stack)-n:])
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return vals
+}
+
+// read the slot value
+func slotValue(val interface{}) interface{} {
+	if val == undefined {
+		return nil
+	}
+	return val
+}
+
+// return the custom function of call site
+func (vm *machine) resolve(f *vmFrame, site *callSite) *NodeFuncDef {
+	val := undefined
+	if site.local >= 0 {
+		val = f.slots[site.local]
+	}
+	// fallback to the global scope
+	if val == undefined {
+		val = vm.main.slots[site.global]
+	}
+	def, _ := val.(*NodeFuncDef)
+	return def
+}
+
+// run the frame, return the completion of function
+func (vm *machine) run(f *vmFrame) (c completion, err error) {
+	ex := vm.ex
+	code := f.proto.code
+	base := len(vm.stack)
+
+	var pc int
+	defer func() {
+		if err != nil {
+			err = runtimeError(err, f.proto.nodes[pc])
+		}
+	}()
+
+	for pc = 0; pc < len(code); pc++ {
+		in := &code[pc]
+		switch in.op {
+		case opStep:
+			if vm.steps {
+				if err := ex.step(f.proto.nodes[pc]); err != nil {
+					return completion{}, err
+				}
+			}
+
+		case opNil:
+			vm.push(nil)
+
+		case opConst:
+			vm.push(vm.bc.consts[in.a])
+
+		case opPop:
+			vm.pop()
+
+		case opLoad:
+			vm.push(slotValue(f.slots[in.a]))
+
+		case opStore:
+			f.slots[in.a] = vm.pop()
+
+		case opAssign:
+			init := f.slots[in.a]
+			val, err := calcAssign(in.sym, slotValue(init), init != undefined, vm.pop())
+			if err == nil && vm.values {
+				err = ex.checkValue(f.proto.nodes[pc], val)
+			}
+			if err != nil {
+				return completion{}, err
+			}
+			f.slots[in.a] = val
+			f.dirty[in.a] = true
+			vm.push(val)
+
+		case opUnary:
+			vm.push(calcUnary(in.sym, vm.pop()))
+
+		case opBinary:
+			right := vm.pop()
+			left := vm.pop()
+			val, err := calcBinary(in.sym, left, right)
+			if err == nil && vm.values {
+				err = ex.checkValue(f.proto.nodes[pc], val)
+			}
+			if err != nil {
+				return completion{}, err
+			}
+			vm.push(val)
+
+		case opList:
+			list := make(ValueList, in.a)
+			copy(list, vm.stack[len(vm.stack)-in.a:])
+			vm.stack = vm.stack[:len(vm.stack)-in.a]
+			if err := ex.checkValue(f.proto.nodes[pc], list); err != nil {
+				return completion{}, err
+			}
+			vm.push(list)
+
+		case opMap:
+			dict := make(ValueMap)
+			kvs := vm.stack[len(vm.stack)-in.a*2:]
+			for i := 0; i < len(kvs); i += 2 {
+				dict[Interface2String(kvs[i])] = kvs[i+1]
+			}
+			vm.stack = vm.stack[:len(vm.stack)-in.a*2]
+			if err := ex.checkValue(f.proto.nodes[pc], dict); err != nil {
+				return completion{}, err
+			}
+			vm.push(dict)
+
+		case opIndexable:
+			if !isIndexable(vm.stack[len(vm.stack)-1]) {
+				vm.stack[len(vm.stack)-1] = nil
+				pc = in.a - 1
+			}
+
+		case opIndex:
+			index := vm.pop()
+			val, err := calcIndex(vm.pop(), index)
+			if err != nil {
+				return completion{}, err
+			}
+			vm.push(val)
+
+		case opDefFunc:
+			f.slots[in.a] = vm.bc.defs[in.b]
+			f.dirty[in.a] = true
+
+		case opCall:
+			site := &vm.bc.calls[in.a]
+			def := vm.resolve(f, site)
+			if def != nil {
+				if _, ok := vm.bc.funcs[def]; ok {
+					if err := ex.checkContext(); err != nil {
+						return completion{}, err
+					}
+					if err := ex.enterCall(site.node); err != nil {
+						return completion{}, err
+					}
+					if len(site.node.Params) != len(def.Params) {
+						return completion{}, fmt.Errorf(
+							"%s() expects at least %d parameters, %d given",
+							site.name, len(def.Params), len(site.node.Params),
+						)
+					}
+					vm.push(def)
+					continue
+				}
+			}
+
+			// builtin function, or custom function defined out of the program.
+			// The tree-walking evaluator reads the functions of the global scope
+			vm.flush(f)
+			if f != vm.main {
+				vm.flush(vm.main)
+			}
+			var c completion
+			var err error
+			if def != nil {
+				c, err = execCustomFunc(site.node, def, f.scope)
+			} else if bfn, ok := ex.engine.lookupFunc(site.name); ok {
+				if err = ex.checkContext(); err == nil {
+					c, err = callBuiltin(site.node, bfn, f.scope)
+				}
+			} else {
+				err = fmt.Errorf("call to undefined function %s()", site.name)
+			}
+			vm.reload(f, false)
+			if f != vm.main {
+				vm.reload(vm.main, false)
+			}
+			if err == nil && !c.abrupt() {
+				err = ex.checkValue(site.node, c.val)
+			}
+			if err != nil || c.abrupt() {
+				return c, err
+			}
+			vm.push(c.val)
+			pc = in.b - 1
+
+		case opCallCustom:
+			n := len(vm.bc.calls[in.a].node.Params)
+			args := vm.stack[len(vm.stack)-n:]
+			def := vm.stack[len(vm.stack)-n-1].(*NodeFuncDef)
+			p := vm.bc.funcs[def]
+
+			callee := newFrame(p, f.level+1)
+			for i := range args {
+				callee.slots[i] = args[i]
+				callee.dirty[i] = true
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n-1]
+
+			c, err := vm.run(callee)
+			ex.leaveCall()
+			if err == nil && !c.abrupt() {
+				err = ex.checkValue(f.proto.nodes[pc], c.val)
+			}
+			if err != nil || c.abrupt() {
+				return c, err
+			}
+			vm.push(c.val)
+
+		case opJump:
+			pc = in.a - 1
+
+		case opJumpIfFalse:
+			if !IsTrue(vm.pop()) {
+				pc = in.a - 1
+			}
+
+		case opLoop, opCheckContext:
+			if vm.done != nil {
+				if err := ex.checkContext(); err != nil {
+					return completion{}, err
+				}
+			}
+
+		case opResult:
+			if val := vm.pop(); val != nil {
+				vm.result = val
+			}
+
+		case opReturn:
+			val := vm.pop()
+			vm.stack = vm.stack[:base]
+			return normal(val), nil
+
+		case opReturnTuple:
+			val := tupleValue(vm.popN(in.a))
+			vm.stack = vm.stack[:base]
+			return normal(val), nil
+
+		case opExit:
+			if val := tupleValue(vm.popN(in.a)); val != nil {
+				vm.result = val
+			}
+			vm.stack = vm.stack[:base]
+			return completion{typ: completionReturn}, nil
+		}
+	}
+
+	vm.stack = vm.stack[:base]
+	return normal(nil), nil
+}
+
+// return the value of `return` tuples
+func tupleValue(tuples []interface{}) interface{} {
+	switch len(tuples) {
+	case 0:
+		return nil
+	case 1:
+		return tuples[0]
+	}
+	return tuples
+}
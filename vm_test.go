@@ -0,0 +1,349 @@
+package spiker_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+var bytecodeTests = []string{
+	`10;`,
+	`1 + 2 - 3 * 4 / 5;`,
+	`1 + "0.234a";`,
+	`23 in "abc234";`,
+	`2 in [1:111,2:222,3:333];`,
+	`!a`,
+	`~8`,
+	`(1 > 2) || (1 < 2)`,
+	`a += "abc"; a += 1;`,
+	`a -= 3; a *= "2"; a /= 4; a %= 5;`,
+	`list = [1, "a", [2, 3]]; export(list[2][1]);`,
+	`dict = ["a": 1, 2: "b"]; export(dict["a"] + dict[2]);`,
+	`s = "hello"; export(s[1]);`,
+	`n = 123; export(n[1]);`,
+	`x = none_var[1];`,
+	`a = [1, 2]; a[5];`,
+	`a = 1 / 0;`,
+	`a = 0 / 0;`,
+	`a = 1 % 0;`,
+	`undefined_func(1);`,
+	`add = (a, b) -> { return a + b; }; add(1);`,
+	`f = x -> x + 1; g = y -> len([f(y)]); a = g(1);`,
+	`f = x -> x + 1; g = y -> { h = z -> z * 2; return export([f(y), h(y)]); }; a = g(1);`,
+	`
+add = (a, b) -> {
+  return a + b;
+};
+
+a = 0;
+b = 3;
+while (true) {
+	a += add(a, 3);
+	if (a > 10) {
+		break;
+	}
+}
+export(a);
+`,
+	`
+a = 1;
+while (true) {
+	a += 2;
+	if (a > 10) {
+		break;
+	} else if (a < 10) {
+		a -= 1;
+	} else {
+		continue;
+	}
+}
+export(a);
+`,
+	`
+i = 0;
+s = 0;
+while (i < 10) {
+	i += 1;
+	if (i % 2 == 0) {
+		continue;
+	}
+	s += i;
+}
+export([i, s]);
+`,
+	`
+fib = n -> {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+};
+export(fib(15));
+`,
+	`
+swap = (a, b) -> {
+    return (b, a);
+};
+export(swap(1, 2));
+`,
+	`
+f = () -> {
+    g = x -> x * 3;
+    return g(2);
+};
+export(f());
+`,
+	`
+f = x -> {
+    x += 1;
+    x;
+};
+export(f(1));
+`,
+	`
+f = x -> {
+    break;
+    x + 1;
+};
+f(1);
+`,
+	`
+f = () -> {
+    return;
+};
+f();
+`,
+	`
+a = 1;
+b = [2];
+del(a, b[0]);
+export([exist(a), exist(b[0]), len(b)]);
+`,
+	`
+a = 1;
+if (a) {
+    return a;
+}
+`,
+	`
+if (true) {
+    break;
+}
+`,
+	`
+a = 1;
+if (a > 0) {
+    b = "positive";
+} else if (a < 0) {
+    b = "negative";
+} else {
+    b = "zero";
+}
+`,
+	`
+if (false) {
+    b = 1;
+}
+`,
+	`
+i = 0;
+while (i < 3) {
+    i += 1;
+    j = 0;
+    while (true) {
+        j += 1;
+        if (j > i) {
+            break;
+        }
+    }
+}
+export([i, j]);
+`,
+	`
+export(1);
+a = 2;
+`,
+	`
+f = x -> {
+    if (x > 1) {
+        break;
+    }
+    return x;
+};
+i = 0;
+while (i < 3) {
+    i += 1;
+    a = f(i);
+}
+export(i);
+`,
+	`
+f = () -> {
+    a = 1;
+    export(a + 1);
+};
+b = f();
+`,
+	`
+i = 0;
+while (true) {
+    i += 1;
+    if (i > 3) {
+        return i * 10;
+    }
+}
+a = 1;
+`,
+	`
+a = 1;
+if (a) {
+    continue;
+}
+a = 2;
+`,
+}
+
+func TestBytecode_SameAsTree(t *testing.T) {
+	var cases []string
+	for _, file := range srcTests {
+		cases = append(cases, readFile(file))
+	}
+	cases = append(cases, bytecodeTests...)
+
+	// the step limit trips at the same node in both backends
+	for _, steps := range []int{0, 10, 100} {
+		limits := spiker.Limits{MaxSteps: steps}
+		tree := spiker.New(spiker.WithLimits(limits))
+		vm := spiker.New(spiker.WithLimits(limits), spiker.WithBytecode(true))
+
+		for idx, code := range cases {
+			t.Run(fmt.Sprintf("%d/steps=%d", idx, steps), func(t *testing.T) {
+				tp, err := tree.Compile(code)
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				vp, err := vm.Compile(code)
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				if !vp.Bytecode() {
+					t.Fatalf("Compile() should compile to bytecode: %s", code)
+				}
+
+				tScope := spiker.NewScopeTable("tree", 1, nil)
+				vScope := spiker.NewScopeTable("vm", 1, nil)
+				tVal, tErr := tp.Run(tScope)
+				vVal, vErr := vp.Run(vScope)
+
+				if fmt.Sprint(tErr) != fmt.Sprint(vErr) {
+					t.Errorf("error: tree = %v, vm = %v", tErr, vErr)
+				}
+				if !reflect.DeepEqual(tVal, vVal) {
+					t.Errorf("result: tree = %#v, vm = %#v", tVal, vVal)
+				}
+
+				for _, name := range []string{"a", "b", "i", "j", "s", "list", "dict"} {
+					tv, tok := tScope.Get(name)
+					vv, vok := vScope.Get(name)
+					if tok != vok || !reflect.DeepEqual(tv, vv) {
+						t.Errorf("variable %s: tree = %#v, vm = %#v", name, tv, vv)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBytecode_Scope(t *testing.T) {
+	// builtin function reads the variable from scope by name
+	e := spiker.New(spiker.WithBytecode(true), spiker.WithFunc("lookup", func(fnc *spiker.NodeFuncCallOp, scope *spiker.VariableScope) interface{} {
+		val, _ := scope.Get(fnc.Params[0].(*spiker.NodeVariable).Value)
+		return val
+	}))
+
+	p, err := e.Compile(`
+total = price * count;
+total = lookup(total) + 1;
+f = () -> {
+    local = 1;
+    return lookup(local) + 1;
+};
+export([total, f()]);`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	parent := spiker.NewScopeTable("parent", 1, nil)
+	parent.Set("price", 2.5)
+	scope := spiker.NewScopeTable("child", 2, parent)
+	scope.Set("count", 4)
+
+	val, err := p.Run(scope)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !reflect.DeepEqual(val, spiker.ValueList{float64(11), float64(2)}) {
+		t.Errorf("Run() = %#v", val)
+	}
+	if v, _ := scope.Get("total"); v != float64(11) {
+		t.Errorf("scope total = %v, want %v", v, 11)
+	}
+	if _, ok := parent.Get("total"); ok {
+		t.Error("variable should be assigned in the scope, not its enclosing scope")
+	}
+}
+
+func TestBytecode_Limits(t *testing.T) {
+	e := spiker.New(spiker.WithBytecode(true), spiker.WithLimits(spiker.Limits{MaxSteps: 1000, MaxCallDepth: 10}))
+
+	for _, tt := range []struct {
+		code string
+		want error
+	}{
+		{`while (true) { a = 1; }`, spiker.ErrMaxSteps},
+		{`f = x -> f(x); f(1);`, spiker.ErrMaxCallDepth},
+	} {
+		p, err := e.Compile(tt.code)
+		if err != nil {
+			t.Fatalf("Compile() error = %v", err)
+		}
+		if _, err := p.Run(nil); !errors.Is(err, tt.want) {
+			t.Errorf("Run() error = %v, want %v", err, tt.want)
+		}
+	}
+}
+
+const benchLoop = `
+i = 0;
+sum = 0;
+while (i < 10000) {
+    sum += i * 2 - i % 7;
+    i += 1;
+}
+export(sum);
+`
+
+func BenchmarkLoop_Tree(b *testing.B) {
+	benchmarkProgram(b, spiker.New(), benchLoop)
+}
+
+func BenchmarkLoop_Bytecode(b *testing.B) {
+	benchmarkProgram(b, spiker.New(spiker.WithBytecode(true)), benchLoop)
+}
+
+func benchmarkProgram(b *testing.B, e *spiker.Engine, code string) {
+	p, err := e.Compile(code)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := p.Run(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package spiker
+
+import "fmt"
+
+// Visitor the Visit method is invoked for each node encountered by Walk,
+// if the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil)
+type Visitor interface {
+	Visit(node AstNode) (w Visitor)
+}
+
+// Walk traverse the ast in depth-first order, it starts by calling v.Visit(node),
+// the children are visited in the order of source, the entries of NodeMap
+// are visited as key and value in turn
+func Walk(node AstNode, v Visitor) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range children(node) {
+		Walk(child, v)
+	}
+
+	v.Visit(nil)
+}
+
+// return the children of node in the order of source, the entries of NodeMap
+// are key and value in turn. The required children are included even if nil
+func children(node AstNode) []AstNode {
+	switch n := node.(type) {
+	case *NodeList:
+		return n.List
+
+	case *NodeMap:
+		list := make([]AstNode, 0, 2*len(n.Map))
+		for _, e := range sortedEntries(n.Map) {
+			list = append(list, e.key, e.value)
+		}
+		return list
+
+	case *NodeBinaryOp:
+		return []AstNode{n.Left, n.Right}
+
+	case *NodeUnaryOp:
+		return []AstNode{n.Right}
+
+	case *NodeAssignOp:
+		return []AstNode{&n.Var, n.Expr}
+
+	case *NodeFuncCallOp:
+		return append([]AstNode{&n.Name}, n.Params...)
+
+	case *NodeVarIndex:
+		return []AstNode{n.Var, n.Index}
+
+	case *NodeFuncDef:
+		list := make([]AstNode, 0, 1+len(n.Params)+len(n.Body))
+		list = append(list, &n.Name)
+		for i := range n.Params {
+			list = append(list, &n.Params[i])
+		}
+		return append(list, n.Body...)
+
+	case *NodeParam:
+		return []AstNode{&n.Name}
+
+	case *NodeIf:
+		list := append([]AstNode{n.Expr}, n.Body...)
+		if n.ElseIf != nil {
+			list = append(list, n.ElseIf)
+		}
+		return append(list, n.Else...)
+
+	case *NodeWhile:
+		return append([]AstNode{n.Expr}, n.Body...)
+
+	case *NodeReturn:
+		return n.Tuples
+	}
+
+	return nil
+}
+
+// visitor of Inspect
+type inspector func(AstNode) bool
+
+func (f inspector) Visit(node AstNode) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverse the ast in depth-first order, it starts by calling f(node),
+// if f returns true, Inspect invokes f recursively for each of the children
+// of node, followed by a call of f(nil)
+func Inspect(node AstNode, f func(AstNode) bool) {
+	Walk(node, inspector(f))
+}
+
+// Rewrite traverse the ast in depth-first order, and replace each node with
+// the result of fn, the children are rewritten before their parent.
+// It returns the new node, the original nodes are not modified.
+//
+// Return nil to remove the node from the list, such as the statements of body
+// and the entries of NodeMap, or to remove the NodeIf of `else if`.
+// The other children can't be removed, such as the operands of operator, the
+// condition of if and the names, it returns an error if fn returns nil for them.
+// The NodeVariable of names, the NodeParam of parameters and the NodeIf of
+// `else if` are only replaced by the same type, otherwise they are kept.
+func Rewrite(node AstNode, fn func(AstNode) AstNode) (n AstNode, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			re, ok := e.(*rewriteError)
+			if !ok {
+				panic(e)
+			}
+			n, err = nil, re
+		}
+	}()
+
+	return rewrite(node, fn), nil
+}
+
+// rewriteError the required child is removed by Rewrite
+type rewriteError struct {
+	node  AstNode // the parent of the removed child
+	child string  // the field name of the removed child
+}
+
+func (e *rewriteError) Error() string {
+	return fmt.Sprintf("rewrite: the %s of %T can't be nil", e.child, e.node)
+}
+
+// rewrite the node, panic if the required child is removed
+func rewrite(node AstNode, fn func(AstNode) AstNode) AstNode {
+	if node == nil {
+		return nil
+	}
+
+	// the child can't be nil
+	required := func(parent AstNode, child AstNode, name string) AstNode {
+		if child = rewrite(child, fn); child == nil {
+			panic(&rewriteError{node: parent, child: name})
+		}
+		return child
+	}
+
+	switch n := node.(type) {
+	case *NodeList:
+		c := *n
+		c.List = rewriteList(n.List, fn)
+		node = &c
+
+	case *NodeMap:
+		c := *n
+		if n.Map != nil {
+			c.Map = make(map[AstNode]AstNode, len(n.Map))
+			for _, e := range sortedEntries(n.Map) {
+				k := rewrite(e.key, fn)
+				if k == nil {
+					continue
+				}
+				c.Map[k] = required(n, e.value, "Value")
+			}
+		}
+		node = &c
+
+	case *NodeBinaryOp:
+		c := *n
+		c.Left = required(n, n.Left, "Left")
+		c.Right = required(n, n.Right, "Right")
+		node = &c
+
+	case *NodeUnaryOp:
+		c := *n
+		c.Right = required(n, n.Right, "Right")
+		node = &c
+
+	case *NodeAssignOp:
+		c := *n
+		c.Var = rewriteVariable(n, n.Var, "Var", fn)
+		c.Expr = required(n, n.Expr, "Expr")
+		node = &c
+
+	case *NodeFuncCallOp:
+		c := *n
+		c.Name = rewriteVariable(n, n.Name, "Name", fn)
+		c.Params = rewriteList(n.Params, fn)
+		node = &c
+
+	case *NodeVarIndex:
+		c := *n
+		c.Var = required(n, n.Var, "Var")
+		c.Index = required(n, n.Index, "Index")
+		node = &c
+
+	case *NodeFuncDef:
+		c := *n
+		c.Name = rewriteVariable(n, n.Name, "Name", fn)
+		if n.Params != nil {
+			c.Params = make([]NodeParam, 0, len(n.Params))
+			for i := range n.Params {
+				p := n.Params[i]
+				switch r := rewrite(&p, fn).(type) {
+				case nil:
+				case *NodeParam:
+					c.Params = append(c.Params, *r)
+				default:
+					c.Params = append(c.Params, p)
+				}
+			}
+		}
+		c.Body = rewriteList(n.Body, fn)
+		node = &c
+
+	case *NodeParam:
+		c := *n
+		c.Name = rewriteVariable(n, n.Name, "Name", fn)
+		node = &c
+
+	case *NodeIf:
+		c := *n
+		c.Expr = required(n, n.Expr, "Expr")
+		c.Body = rewriteList(n.Body, fn)
+		if n.ElseIf != nil {
+			switch r := rewrite(n.ElseIf, fn).(type) {
+			case nil:
+				c.ElseIf = nil
+			case *NodeIf:
+				c.ElseIf = r
+			}
+		}
+		c.Else = rewriteList(n.Else, fn)
+		node = &c
+
+	case *NodeWhile:
+		c := *n
+		c.Expr = required(n, n.Expr, "Expr")
+		c.Body = rewriteList(n.Body, fn)
+		node = &c
+
+	case *NodeReturn:
+		c := *n
+		c.Tuples = rewriteList(n.Tuples, fn)
+		node = &c
+	}
+
+	return fn(node)
+}
+
+// rewrite the node list, the removed nodes are dropped
+func rewriteList(nodes []AstNode, fn func(AstNode) AstNode) []AstNode {
+	if nodes == nil {
+		return nil
+	}
+
+	list := make([]AstNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node = rewrite(node, fn); node != nil {
+			list = append(list, node)
+		}
+	}
+	return list
+}
+
+// rewrite the variable field of parent, only replaced by NodeVariable, it can't be nil
+func rewriteVariable(parent AstNode, nv NodeVariable, child string, fn func(AstNode) AstNode) NodeVariable {
+	switch r := rewrite(&nv, fn).(type) {
+	case nil:
+		panic(&rewriteError{node: parent, child: child})
+	case *NodeVariable:
+		if r != nil {
+			return *r
+		}
+	}
+	return nv
+}
@@ -0,0 +1,231 @@
+package spiker_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shockerli/spiker"
+)
+
+const walkCode = `
+m = ["a": [1, -x], 2];
+f = (p, q) -> {
+    if (p > 1) {
+        return (p, q);
+    } else if (!p) {
+        continue;
+    } else {
+        break;
+    }
+    while (m.z[0]) { print(q); }
+};
+`
+
+// return the short name of node type
+func nodeName(node spiker.AstNode) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*spiker.Node")
+}
+
+func TestInspect(t *testing.T) {
+	ast, err := spiker.ParseAst(walkCode)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	var got []string
+	for _, node := range ast {
+		spiker.Inspect(node, func(n spiker.AstNode) bool {
+			if n != nil {
+				got = append(got, nodeName(n))
+			}
+			return true
+		})
+	}
+
+	want := []string{
+		// m = ["a": [1, -x], 2]
+		"AssignOp", "Variable", "Map", "String", "List", "Number", "UnaryOp", "Variable", "Number", "Number",
+		// f = (p, q) -> {
+		"FuncDef", "Variable", "Param", "Variable", "Param", "Variable",
+		// if (p > 1) { return (p, q); }
+		"If", "BinaryOp", "Variable", "Number", "Return", "Variable", "Variable",
+		// else if (!p) { continue; } else { break; }
+		"If", "UnaryOp", "Variable", "Continue", "Break",
+		// while (m.z[0]) { print(q); }
+		"While", "VarIndex", "VarIndex", "Variable", "String", "Number", "FuncCallOp", "Variable", "Variable",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inspect() = %q\nwant %q", got, want)
+	}
+
+	// skip the children
+	got = nil
+	for _, node := range ast {
+		spiker.Inspect(node, func(n spiker.AstNode) bool {
+			if n != nil {
+				got = append(got, nodeName(n))
+			}
+			_, isFunc := n.(*spiker.NodeFuncDef)
+			return !isFunc
+		})
+	}
+	if len(got) != 11 || got[10] != "FuncDef" {
+		t.Errorf("Inspect() = %q", got)
+	}
+}
+
+// visitor records the depth of nodes
+type depthVisitor struct {
+	depth int
+	lines *[]string
+}
+
+func (v depthVisitor) Visit(node spiker.AstNode) spiker.Visitor {
+	if node == nil {
+		*v.lines = append(*v.lines, strings.Repeat(" ", v.depth-1)+"end")
+		return nil
+	}
+	*v.lines = append(*v.lines, strings.Repeat(" ", v.depth)+nodeName(node))
+	return depthVisitor{depth: v.depth + 1, lines: v.lines}
+}
+
+func TestWalk(t *testing.T) {
+	ast, err := spiker.ParseAst(`a = b[1] + 2;`)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+
+	var lines []string
+	spiker.Walk(ast[0], depthVisitor{lines: &lines})
+
+	want := []string{
+		"AssignOp",
+		" Variable",
+		" end",
+		" BinaryOp",
+		"  VarIndex",
+		"   Variable",
+		"   end",
+		"   Number",
+		"   end",
+		"  end",
+		"  Number",
+		"  end",
+		" end",
+		"end",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Walk() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ast, err := spiker.ParseAst(walkCode)
+	if err != nil {
+		t.Fatalf("ParseAst() error = %v", err)
+	}
+	original, _ := spiker.FormatAst(ast)
+
+	var got []spiker.AstNode
+	for _, node := range ast {
+		rewritten, err := spiker.Rewrite(node, func(n spiker.AstNode) spiker.AstNode {
+			switch n := n.(type) {
+			// rename
+			case *spiker.NodeVariable:
+				if n.Value == "q" {
+					return &spiker.NodeVariable{Value: "y"}
+				}
+				if n.Value == "f" {
+					// ignored, the name of function is NodeVariable
+					return &spiker.NodeString{Value: "f"}
+				}
+			// remove the statement
+			case *spiker.NodeFuncCallOp:
+				if n.Name.Value == "print" {
+					return nil
+				}
+			// remove the `else if`
+			case *spiker.NodeIf:
+				if _, ok := n.Expr.(*spiker.NodeUnaryOp); ok {
+					return nil
+				}
+			// remove the entry
+			case *spiker.NodeString:
+				if n.Value == "a" {
+					return nil
+				}
+			}
+			return n
+		})
+		if err != nil {
+			t.Fatalf("Rewrite() error = %v", err)
+		}
+		got = append(got, rewritten)
+	}
+
+	formatted, err := spiker.FormatAst(got)
+	if err != nil {
+		t.Fatalf("FormatAst() error = %v", err)
+	}
+	want := `m = [0: 2];
+f = (p, y) -> {
+    if (p > 1) {
+        return (p, y);
+    }
+    while (m.z[0]) {
+    }
+};`
+	if formatted != want {
+		t.Errorf("Rewrite() =\n%s\nwant\n%s", formatted, want)
+	}
+
+	// the original is not modified
+	if again, _ := spiker.FormatAst(ast); again != original {
+		t.Errorf("Rewrite() modified the original:\n%s", again)
+	}
+}
+
+func TestRewrite_Nil(t *testing.T) {
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`a = b + 1;`, "rewrite: the Left of *spiker.NodeBinaryOp can't be nil"},
+		{`a = -b;`, "rewrite: the Right of *spiker.NodeUnaryOp can't be nil"},
+		{`a = b;`, "rewrite: the Expr of *spiker.NodeAssignOp can't be nil"},
+		{`a = b[0];`, "rewrite: the Var of *spiker.NodeVarIndex can't be nil"},
+		{`a = [1: b];`, "rewrite: the Value of *spiker.NodeMap can't be nil"},
+		{`if (b) { a = 1; }`, "rewrite: the Expr of *spiker.NodeIf can't be nil"},
+		{`while (b) { a = 1; }`, "rewrite: the Expr of *spiker.NodeWhile can't be nil"},
+		{`b = 1;`, "rewrite: the Var of *spiker.NodeAssignOp can't be nil"},
+		{`b(1);`, "rewrite: the Name of *spiker.NodeFuncCallOp can't be nil"},
+		{`b = x -> x;`, "rewrite: the Name of *spiker.NodeFuncDef can't be nil"},
+		{`f = b -> 1;`, "rewrite: the Name of *spiker.NodeParam can't be nil"},
+		{`f(b, 1);`, ""},
+		{`a = [b, 1];`, ""},
+	}
+	for _, tt := range tests {
+		ast, err := spiker.ParseAst(tt.code)
+		if err != nil {
+			t.Fatalf("ParseAst() error = %v", err)
+		}
+		// remove the variable b
+		got, err := spiker.Rewrite(ast[0], func(n spiker.AstNode) spiker.AstNode {
+			if v, ok := n.(*spiker.NodeVariable); ok && v.Value == "b" {
+				return nil
+			}
+			return n
+		})
+		if tt.err == "" {
+			if err != nil || got == nil {
+				t.Errorf("Rewrite(%q) = %v, %v", tt.code, got, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err || got != nil {
+			t.Errorf("Rewrite(%q) = %v, %v, want error %s", tt.code, got, err, tt.err)
+		}
+	}
+}